@@ -0,0 +1,80 @@
+// Command auditverify checks the integrity of an audit log's hash chain.
+//
+// It reads the log from a JSON lines file or from the audit_events table of
+// a SQL database, and reports the first event at which the chain is broken.
+//
+//	go run ./cmd/auditverify -file audit.jsonl
+//	go run ./cmd/auditverify -driver sqlite -dsn audit.db
+//
+// The HMAC key, if the log was written with one, is read from the
+// AUDIT_HMAC_KEY environment variable.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"learn/internal/audit"
+	"os"
+
+	_ "modernc.org/sqlite" // SQLite driver for SQL audit logs
+)
+
+func main() {
+	file := flag.String("file", "", "JSON lines audit log file")
+	driver := flag.String("driver", "sqlite", "SQL driver of the audit database")
+	dsn := flag.String("dsn", "", "data source name of the audit database")
+	flag.Parse()
+
+	if (*file == "") == (*dsn == "") {
+		fmt.Fprintln(os.Stderr, "exactly one of -file or -dsn is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	verifier := audit.NewVerifier([]byte(os.Getenv("AUDIT_HMAC_KEY")))
+	var err error
+	if *file != "" {
+		err = verifyFile(*file, verifier)
+	} else {
+		err = verifyDatabase(*driver, *dsn, verifier)
+	}
+
+	var chainErr *audit.ChainError
+	switch {
+	case errors.As(err, &chainErr):
+		fmt.Printf("FAILED: %v (%d events verified before it)\n", chainErr, verifier.Count())
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Failed to read audit log: %v\n", err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("OK: %d events verified, last hash %s\n", verifier.Count(), verifier.LastHash())
+}
+
+func verifyFile(path string, verifier *audit.Verifier) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return audit.ReadEvents(file, verifier.Check)
+}
+
+func verifyDatabase(driver, dsn string, verifier *audit.Verifier) error {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	sink, err := audit.NewSQLSink(db)
+	if err != nil {
+		_ = db.Close()
+		return err
+	}
+	defer sink.Close()
+
+	return sink.Events(verifier.Check)
+}
@@ -0,0 +1,105 @@
+// Package audit records security-relevant events in a hash-chained log.
+// Each event carries the hash of the event before it, so editing, removing
+// or reordering recorded events breaks the chain and is detected by Verify.
+package audit
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Outcomes of an audited action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Audited authentication actions
+const (
+	ActionRegister            = "auth.register"
+	ActionLogin               = "auth.login"
+	ActionRefresh             = "auth.refresh"
+	ActionLogout              = "auth.logout"
+	ActionPasswordReset       = "auth.password_reset"
+	ActionPasswordChange      = "user.password_change"
+	ActionRevokeSession       = "user.session.revoke"
+	ActionRevokeOtherSessions = "user.sessions.revoke_others"
+	ActionCreateAccessToken   = "user.token.create"
+	ActionRevokeAccessToken   = "user.token.revoke"
+)
+
+// Audited administrative actions
+const (
+	ActionAdminListUsers     = "admin.users.list"
+	ActionAdminViewUser      = "admin.user.view"
+	ActionAdminDisableUser   = "admin.user.disable"
+	ActionAdminEnableUser    = "admin.user.enable"
+	ActionAdminSetStatus     = "admin.user.set_status"
+	ActionAdminResetPassword = "admin.user.reset_password"
+	ActionAdminLogoutUser    = "admin.user.logout"
+	ActionAdminAssignRole    = "admin.user.assign_role"
+	ActionAdminDeleteUser    = "admin.user.delete"
+
+	ActionAdminListWebhooks         = "admin.webhooks.list"
+	ActionAdminCreateWebhook        = "admin.webhook.create"
+	ActionAdminDeleteWebhook        = "admin.webhook.delete"
+	ActionAdminListDeliveries       = "admin.webhook.deliveries.list"
+	ActionAdminReplayDelivery       = "admin.webhook.delivery.replay"
+	ActionAdminReplayDeadDeliveries = "admin.webhook.deliveries.replay_dead"
+)
+
+// Actor identifies who performed an action and from where
+type Actor struct {
+	ID        string
+	IPAddress string
+	UserAgent string
+}
+
+// Event is one entry in the audit log
+type Event struct {
+	// Sequence numbers events from 1 in the order they were recorded
+	Sequence  uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	Action    string    `json:"action"`
+	TargetID  string    `json:"target_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Outcome   string    `json:"outcome"`
+	Reason    string    `json:"reason,omitempty"`
+	// PrevHash is the hash of the previous event, empty for the first
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// NewEvent creates an event for an action performed by an actor. A non-nil
+// err marks the action as failed, with the error as the reason.
+func NewEvent(actor Actor, action, targetID string, err error) *Event {
+	event := &Event{
+		Time:      time.Now().UTC(),
+		ActorID:   actor.ID,
+		Action:    action,
+		TargetID:  targetID,
+		IPAddress: actor.IPAddress,
+		UserAgent: actor.UserAgent,
+		Outcome:   OutcomeSuccess,
+	}
+	if err != nil {
+		event.Outcome = OutcomeFailure
+		event.Reason = err.Error()
+	}
+	return event
+}
+
+// Logger records audit events
+type Logger interface {
+	Record(event *Event) error
+}
+
+// Write records an event. A failure to audit is logged but not returned,
+// since the audited action has already taken effect.
+func Write(logger Logger, event *Event) {
+	if err := logger.Record(event); err != nil {
+		slog.Error("Failed to record audit event", "action", event.Action, "error", err)
+	}
+}
@@ -0,0 +1,267 @@
+package audit
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+// recordEvents records n events on a chain writing to a buffer and returns
+// the events read back from it
+func recordEvents(t *testing.T, key []byte, n int) []*Event {
+	t.Helper()
+	var buf bytes.Buffer
+	chain, err := NewChain(key, NewWriterSink(&buf))
+	require.NoError(t, err)
+
+	actor := Actor{ID: "admin", IPAddress: "192.0.2.1", UserAgent: "test"}
+	for i := 0; i < n; i++ {
+		var err error
+		if i%2 == 1 {
+			err = errors.New("user not found")
+		}
+		require.NoError(t, chain.Record(NewEvent(actor, ActionAdminViewUser, "user", err)))
+	}
+
+	var events []*Event
+	require.NoError(t, ReadEvents(&buf, func(event *Event) error {
+		events = append(events, event)
+		return nil
+	}))
+	require.Len(t, events, n)
+	return events
+}
+
+// verify checks events in order and returns the first error
+func verify(key []byte, events []*Event) error {
+	verifier := NewVerifier(key)
+	for _, event := range events {
+		if err := verifier.Check(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestChainVerify(t *testing.T) {
+	key := []byte("secret")
+
+	tests := []struct {
+		name     string
+		tamper   func(events []*Event) []*Event
+		key      []byte
+		sequence uint64 // Where the chain is reported broken, 0 if intact
+	}{
+		{
+			name:   "Intact",
+			tamper: func(events []*Event) []*Event { return events },
+			key:    key,
+		},
+		{
+			name:   "Truncated tail is not detectable",
+			tamper: func(events []*Event) []*Event { return events[:3] },
+			key:    key,
+		},
+		{
+			name: "Modified field",
+			tamper: func(events []*Event) []*Event {
+				events[2].Outcome = OutcomeSuccess
+				events[1].Reason = ""
+				return events
+			},
+			key:      key,
+			sequence: 2,
+		},
+		{
+			name: "Modified field with recomputed hash",
+			tamper: func(events []*Event) []*Event {
+				events[1].Reason = ""
+				events[1].Hash = HashEvent(events[1], []byte("guess"))
+				return events
+			},
+			key:      key,
+			sequence: 2,
+		},
+		{
+			name: "Deleted event",
+			tamper: func(events []*Event) []*Event {
+				return append(events[:2], events[3:]...)
+			},
+			key:      key,
+			sequence: 3,
+		},
+		{
+			name: "Deleted and renumbered event",
+			tamper: func(events []*Event) []*Event {
+				events = append(events[:2], events[3:]...)
+				for _, event := range events[2:] {
+					event.Sequence--
+				}
+				return events
+			},
+			key:      key,
+			sequence: 3,
+		},
+		{
+			name: "Reordered events",
+			tamper: func(events []*Event) []*Event {
+				events[1], events[2] = events[2], events[1]
+				return events
+			},
+			key:      key,
+			sequence: 2,
+		},
+		{
+			name:     "Wrong key",
+			tamper:   func(events []*Event) []*Event { return events },
+			key:      []byte("other"),
+			sequence: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := tt.tamper(recordEvents(t, key, 5))
+			err := verify(tt.key, events)
+			if tt.sequence == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var chainErr *ChainError
+			require.ErrorAs(t, err, &chainErr)
+			assert.Equal(t, tt.sequence, chainErr.Sequence)
+		})
+	}
+}
+
+func TestChainWithoutKey(t *testing.T) {
+	events := recordEvents(t, nil, 3)
+	assert.NoError(t, verify(nil, events))
+
+	// Without a key anyone can recompute the chain after a change
+	events[1].Reason = ""
+	events[1].Hash = HashEvent(events[1], nil)
+	events[2].PrevHash = events[1].Hash
+	events[2].Hash = HashEvent(events[2], nil)
+	assert.NoError(t, verify(nil, events))
+}
+
+func TestFileSinkResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	key := []byte("secret")
+	actor := Actor{ID: "admin"}
+
+	for run := 0; run < 3; run++ {
+		sink, err := NewFileSink(path)
+		require.NoError(t, err)
+		chain, err := NewChain(key, sink)
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			require.NoError(t, chain.Record(NewEvent(actor, ActionAdminListUsers, "", nil)))
+		}
+		require.NoError(t, chain.Close())
+	}
+
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+	defer sink.Close()
+	last, err := sink.Last()
+	require.NoError(t, err)
+	require.NotNil(t, last)
+	assert.Equal(t, uint64(6), last.Sequence)
+
+	verifier := NewVerifier(key)
+	require.NoError(t, ReadEvents(sink.file, verifier.Check))
+	assert.Equal(t, uint64(6), verifier.Count())
+	assert.Equal(t, last.Hash, verifier.LastHash())
+}
+
+func TestFileSinkTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	key := []byte("secret")
+	actor := Actor{ID: "admin"}
+
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+	chain, err := NewChain(key, sink)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, chain.Record(NewEvent(actor, ActionAdminListUsers, "", nil)))
+	}
+	require.NoError(t, chain.Close())
+
+	// A crash in the middle of writing the third event leaves part of it
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"sequence":3,"action":"admin.li`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// The torn line is dropped and the chain continues from the second event
+	sink, err = NewFileSink(path)
+	require.NoError(t, err)
+	chain, err = NewChain(key, sink)
+	require.NoError(t, err)
+	require.NoError(t, chain.Record(NewEvent(actor, ActionAdminListUsers, "", nil)))
+	require.NoError(t, chain.Close())
+
+	sink, err = NewFileSink(path)
+	require.NoError(t, err)
+	defer sink.Close()
+	verifier := NewVerifier(key)
+	require.NoError(t, ReadEvents(sink.file, verifier.Check))
+	assert.Equal(t, uint64(3), verifier.Count())
+}
+
+func TestFileSinkLastEmpty(t *testing.T) {
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	last, err := sink.Last()
+	require.NoError(t, err)
+	assert.Nil(t, last)
+}
+
+func TestSQLSinkResume(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "audit.db")
+	key := []byte("secret")
+	actor := Actor{ID: "admin", IPAddress: "192.0.2.1"}
+
+	for run := 0; run < 2; run++ {
+		db, err := sql.Open("sqlite", dsn)
+		require.NoError(t, err)
+		sink, err := NewSQLSink(db)
+		require.NoError(t, err)
+		chain, err := NewChain(key, sink)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, chain.Record(NewEvent(actor, ActionAdminDeleteUser, "user", nil)))
+		}
+		require.NoError(t, chain.Close())
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	sink, err := NewSQLSink(db)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	verifier := NewVerifier(key)
+	require.NoError(t, sink.Events(verifier.Check))
+	assert.Equal(t, uint64(6), verifier.Count())
+
+	_, err = db.Exec(`UPDATE audit_events SET outcome = 'failure' WHERE seq = 4`)
+	require.NoError(t, err)
+	var chainErr *ChainError
+	require.ErrorAs(t, sink.Events(NewVerifier(key).Check), &chainErr)
+	assert.Equal(t, uint64(4), chainErr.Sequence)
+}
@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Sink stores audit events
+type Sink interface {
+	Write(event *Event) error
+	Close() error
+}
+
+// Tailer is implemented by sinks that can report the last event they
+// stored, so that a chain can continue across restarts
+type Tailer interface {
+	// Last returns the last event stored, or nil if there is none
+	Last() (*Event, error)
+}
+
+// WriterSink implements Sink by writing events as JSON lines, e.g. to stdout
+type WriterSink struct {
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+// NewWriterSink creates a sink that writes events to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{encoder: json.NewEncoder(w)}
+}
+
+// Write writes an event as one line of JSON
+func (s *WriterSink) Write(event *Event) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.encoder.Encode(event)
+}
+
+// Close does nothing, the writer is owned by the caller
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// FileSink implements Sink by appending events as JSON lines to a file
+type FileSink struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// NewFileSink opens, or creates, a JSON lines audit log file for appending.
+// A final line without a newline was torn by a crash in the middle of a
+// write, which never succeeded, so it is removed and the log continues
+// from the last complete event.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := dropTornLine(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileSink{file: file}, nil
+}
+
+// dropTornLine truncates a file after its last newline
+func dropTornLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	const chunkSize = 4096
+	for offset := info.Size(); offset > 0; {
+		n := min(int64(chunkSize), offset)
+		offset -= n
+		chunk := make([]byte, n)
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return err
+		}
+		i := bytes.LastIndexByte(chunk, '\n')
+		if i < 0 {
+			continue
+		}
+		end := offset + int64(i) + 1
+		if end == info.Size() {
+			return nil
+		}
+		return truncateTornLine(file, end, info.Size())
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	return truncateTornLine(file, 0, info.Size())
+}
+
+// truncateTornLine removes the bytes of a file from end to size
+func truncateTornLine(file *os.File, end, size int64) error {
+	slog.Warn("Removing a torn final line from the audit log", "file", file.Name(), "bytes", size-end)
+	if err := file.Truncate(end); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Write appends an event to the file and syncs it to disk
+func (s *FileSink) Write(event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Last reads the last event in the file, reading backwards from the end so
+// that large logs need not be scanned
+func (s *FileSink) Last() (*Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	info, err := s.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 4096
+	var tail []byte
+	for offset := info.Size(); offset > 0; {
+		n := min(int64(chunkSize), offset)
+		offset -= n
+		chunk := make([]byte, n)
+		if _, err := s.file.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		tail = append(chunk, tail...)
+
+		// Stop once the tail holds a complete last line
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return decodeEvent(trimmed[i+1:])
+		}
+		if offset == 0 && len(trimmed) > 0 {
+			return decodeEvent(trimmed)
+		}
+	}
+	return nil, nil
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// ReadEvents reads JSON lines audit events from r, calling fn for each in turn
+func ReadEvents(r io.Reader, fn func(*Event) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		event, err := decodeEvent(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func decodeEvent(line []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SQLSink implements Sink by inserting events into an audit_events table.
+// Queries use numbered placeholders ($1), as supported by SQLite and
+// PostgreSQL.
+type SQLSink struct {
+	db *sql.DB
+}
+
+// NewSQLSink creates a sink writing to db, creating the table if needed.
+// The sink takes ownership of db and closes it when it is closed.
+func NewSQLSink(db *sql.DB) (*SQLSink, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS audit_events (
+		seq BIGINT PRIMARY KEY,
+		time TEXT NOT NULL,
+		actor_id TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_id TEXT NOT NULL,
+		ip_address TEXT NOT NULL,
+		user_agent TEXT NOT NULL,
+		outcome TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		prev_hash TEXT NOT NULL,
+		hash TEXT NOT NULL
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLSink{db: db}, nil
+}
+
+const selectEvents = `SELECT seq, time, actor_id, action, target_id, ip_address, user_agent, outcome, reason, prev_hash, hash FROM audit_events`
+
+// Write inserts an event
+func (s *SQLSink) Write(event *Event) error {
+	_, err := s.db.Exec(`INSERT INTO audit_events
+		(seq, time, actor_id, action, target_id, ip_address, user_agent, outcome, reason, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		event.Sequence, event.Time.UTC().Format(time.RFC3339Nano), event.ActorID, event.Action, event.TargetID,
+		event.IPAddress, event.UserAgent, event.Outcome, event.Reason, event.PrevHash, event.Hash)
+	return err
+}
+
+// Last returns the event with the highest sequence number
+func (s *SQLSink) Last() (*Event, error) {
+	rows, err := s.db.Query(selectEvents + ` ORDER BY seq DESC LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	return scanEvent(rows)
+}
+
+// Events calls fn for every stored event in sequence order
+func (s *SQLSink) Events(fn func(*Event) error) error {
+	rows, err := s.db.Query(selectEvents + ` ORDER BY seq`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Close closes the database
+func (s *SQLSink) Close() error {
+	return s.db.Close()
+}
+
+func scanEvent(rows *sql.Rows) (*Event, error) {
+	var event Event
+	var eventTime string
+	err := rows.Scan(&event.Sequence, &eventTime, &event.ActorID, &event.Action, &event.TargetID,
+		&event.IPAddress, &event.UserAgent, &event.Outcome, &event.Reason, &event.PrevHash, &event.Hash)
+	if err != nil {
+		return nil, err
+	}
+	event.Time, err = time.Parse(time.RFC3339Nano, eventTime)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -1,80 +1,637 @@
 package config
 
 import (
-	"os"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"text/tabwriter"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig
-	JWT      JWTConfig
-	Database DatabaseConfig
+	// Environment is "development" or "production", which refuses to start
+	// with example or short secrets
+	Environment string
+	Server      ServerConfig
+	JWT         JWTConfig
+	Database    DatabaseConfig
+	Password    PasswordConfig
+	Auth        AuthConfig
+	Mail        MailConfig
+	Cookie      CookieConfig
+	Audit       AuditConfig
+	Webhook     WebhookConfig
+	Log         LogConfig
+	Metrics     MetricsConfig
+	Tracing     TracingConfig
+	Health      HealthConfig
+
+	// settings records where each value came from, for PrintSettings
+	settings []Setting
 }
 
+// minSecretLength is the shortest JWT secret or audit HMAC key accepted in
+// production, in bytes
+const minSecretLength = 32
+
+// exampleSecrets are secrets from the documentation and the example .env
+// file, which must never be used in production
+var exampleSecrets = []string{"your-secret-key", "your-secret-key-change-in-production"}
+
+// secretKeys are the settings whose values PrintSettings redacts
+var secretKeys = []string{"JWT_SECRET", "MAIL_SMTP_PASSWORD", "AUDIT_HMAC_KEY"}
+
+// redacted replaces secrets in printed settings
+const redacted = "[REDACTED]"
+
+// dsnPassword matches a password in a key=value DSN, such as
+// "host=db user=auth password='s3cret'", or in a URL query
+var dsnPassword = regexp.MustCompile(`(?i)\b(password=)('(?:[^'\\]|\\.)*'|[^\s;&]*)`)
+
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
-	Port         string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
+	Port string
+	// PublicURL is the scheme and host clients reach the server at, e.g.
+	// "https://api.example.com", when it differs from the request's because
+	// of a proxy. DPoP proofs are checked against it.
+	PublicURL string
+	// ReadTimeout bounds reading a whole request, ReadHeaderTimeout its
+	// headers, and WriteTimeout handling it and writing the response
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	// IdleTimeout is how long a keep-alive connection waits for the next
+	// request
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+	// DrainDelay is how long readiness fails on shutdown before the server
+	// stops accepting connections, giving load balancers time to notice
+	DrainDelay time.Duration
+	// ShutdownTimeout bounds waiting for in-flight requests on shutdown
+	ShutdownTimeout time.Duration
+	// TLS makes the server terminate TLS itself
+	TLS TLSConfig
+}
+
+// TLSConfig holds the server's TLS configuration
+type TLSConfig struct {
+	// CertFile and KeyFile hold the PEM certificate chain and private key;
+	// the server speaks plain HTTP if they are empty
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.2" or "1.3"
+	MinVersion string
+	// CipherSuites lists the TLS 1.2 cipher suites offered by name, empty
+	// for Go's defaults. TLS 1.3 suites are not configurable.
+	CipherSuites []string
+	// ClientAuth is "none", "optional" (a client certificate is verified if
+	// one is sent) or "require"
+	ClientAuth string
+	// ClientCAFile holds the PEM bundle of CAs trusted to issue client certificates
+	ClientCAFile string
+	// ReloadInterval is how often the files are checked for changes
+	ReloadInterval time.Duration
 }
 
 // JWTConfig holds JWT-related configuration
 type JWTConfig struct {
-	Secret          string
-	AccessTokenTTL  time.Duration
+	Secret         string
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is the session idle timeout: a session expires unless
+	// it is refreshed within this long of its last use
 	RefreshTokenTTL time.Duration
+	// SessionMaxLifetime is the absolute session lifetime from the original
+	// login, which refreshes cannot extend
+	SessionMaxLifetime time.Duration
+	// SessionOverrides replace the idle timeout and maximum lifetime for
+	// sessions of a user role ("role:<name>"), or shorten them for a client
+	// ("client:<id>"), whose ID is not authenticated
+	SessionOverrides map[string]SessionLifetime
+	// PurgeInterval is how often expired refresh tokens are purged
+	PurgeInterval time.Duration
+}
+
+// SessionLifetime holds the idle timeout and maximum lifetime of a session
+type SessionLifetime struct {
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
 }
 
 // DatabaseConfig holds database-related configuration
 type DatabaseConfig struct {
-	// In a real application, you would include database connection details
-	// For this example, we'll use an in-memory store
-	InMemory bool
+	// Backend stores users, sessions and the event outbox in "memory" or "sql"
+	Backend   string
+	SQLDriver string
+	SQLDSN    string
+	// OutboxPollInterval is how often the outbox is checked for events to
+	// relay, in case the relay missed a notification or an event was stored
+	// by another process
+	OutboxPollInterval time.Duration
+	// OutboxMaxAttempts is how many times an event is dispatched to its
+	// asynchronous subscribers before it is dead-lettered
+	OutboxMaxAttempts int
+	// OutboxRetryBaseDelay is the delay before the first retry, doubling
+	// with each further attempt up to OutboxRetryMaxDelay
+	OutboxRetryBaseDelay time.Duration
+	OutboxRetryMaxDelay  time.Duration
+}
+
+// PasswordConfig holds password hashing configuration
+type PasswordConfig struct {
+	// Algorithm is the preferred algorithm for new hashes: bcrypt, argon2id or scrypt
+	Algorithm         string
+	BcryptCost        int
+	Argon2Memory      uint32 // Memory in KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	ScryptLogN        uint8 // CPU/memory cost as a power of two
+	ScryptR           int
+	ScryptP           int
+
+	// Password policy
+	MinLength        int
+	MaxLength        int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	MaxRepeats       int
+	DisallowUserInfo bool
+	MinStrength      int // zxcvbn-style score from 0 to 4
+	// BreachedCorpusDir holds SHA-1 prefix files of breached passwords, empty disables screening
+	BreachedCorpusDir string
+}
+
+// AuthConfig holds authentication flow configuration
+type AuthConfig struct {
+	// EnumerationSafeRegistration accepts every well-formed registration with
+	// the same response and notifies the owner by email when the username or
+	// email is already taken, so registration cannot reveal existing accounts
+	EnumerationSafeRegistration bool
+	// PasswordResetTTL is how long a password reset token stays valid
+	PasswordResetTTL time.Duration
+	// StatusCheck verifies the account status on every authenticated
+	// request, so suspensions take effect within StatusCacheTTL
+	StatusCheck    bool
+	StatusCacheTTL time.Duration
+	// SessionCacheTTL is how long whether a session is active is cached, so
+	// access tokens stop working within it after their session ends
+	SessionCacheTTL time.Duration
+	// DPoPProofLifetime is how far the issue time of a DPoP proof may lie
+	// from the present
+	DPoPProofLifetime time.Duration
+}
+
+// MailConfig holds outgoing mail configuration
+type MailConfig struct {
+	// Host is the SMTP server host, empty logs messages instead of sending them
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// CookieConfig holds configuration for delivering tokens to browser clients in cookies
+type CookieConfig struct {
+	// Enabled sets the refresh token in an HttpOnly cookie instead of the response body
+	Enabled bool
+	// AccessToken also sets the access token in an HttpOnly cookie
+	AccessToken bool
+	Secure      bool
+	// SameSite is "strict", "lax" or "none"
+	SameSite string
+	Domain   string
+}
+
+// AuditConfig holds audit log configuration
+type AuditConfig struct {
+	// Sinks lists where events are written: "stdout", "file" and/or "sql"
+	Sinks     []string
+	FilePath  string
+	SQLDriver string
+	SQLDSN    string
+	// HMACKey, if set, keys the hash chain so it cannot be recomputed
+	// by someone who can edit the log but does not know the key
+	HMACKey string
 }
 
-// LoadConfig loads configuration from environment variables
-func LoadConfig() (*Config, error) {
-	// Load .env file if it exists
-	_ = godotenv.Load()
+// WebhookConfig holds outbound webhook configuration
+type WebhookConfig struct {
+	// Store keeps subscriptions and the delivery outbox in "memory" or "sql"
+	Store     string
+	SQLDriver string
+	SQLDSN    string
+	// MaxAttempts is how many times a delivery is tried before it is dead-lettered
+	MaxAttempts int
+	// RetryBaseDelay is the delay before the first retry, doubling with
+	// each further attempt up to RetryMaxDelay
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// Timeout bounds each delivery request
+	Timeout time.Duration
+	// PollInterval is how often the outbox is checked for due deliveries
+	PollInterval time.Duration
+}
+
+// LogConfig holds application log configuration
+type LogConfig struct {
+	// Level is "debug", "info", "warn" or "error"
+	Level string
+	// Format is "json" or "text"
+	Format string
+}
+
+// MetricsConfig holds Prometheus metrics configuration
+type MetricsConfig struct {
+	Enabled bool
+	// Addr is the address of the listener that serves the metrics, kept
+	// apart from the API port since the metrics are not authenticated
+	Addr string
+	// Path is where the metrics are served on that listener
+	Path string
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig struct {
+	// Exporter is "none", "stdout" or "otlp"
+	Exporter string
+	// OTLPEndpoint is the URL of an OTLP/HTTP collector
+	OTLPEndpoint string
+	ServiceName  string
+	// SampleRatio is the fraction of traces recorded, unless the caller
+	// already decided whether to sample
+	SampleRatio float64
+}
+
+// HealthConfig holds health and readiness check configuration
+type HealthConfig struct {
+	// CheckTimeout bounds each readiness check
+	CheckTimeout time.Duration
+}
+
+// LoadConfig loads configuration from environment variables, a YAML or TOML
+// config file and the .env file, in that order of precedence. The file is
+// read from path, or from CONFIG_FILE if path is empty. Every invalid or
+// inconsistent setting is reported in the error returned.
+func LoadConfig(path string) (*Config, error) {
+	l := newLoader(path)
+	environment := l.choice("APP_ENV", "development", "development", "production")
 
 	// Server config
-	port := getEnv("SERVER_PORT", "8080")
-	readTimeout, _ := strconv.Atoi(getEnv("SERVER_READ_TIMEOUT", "10"))
-	writeTimeout, _ := strconv.Atoi(getEnv("SERVER_WRITE_TIMEOUT", "10"))
+	port := l.integer("SERVER_PORT", 8080, 1, 65535)
+	publicURL := strings.TrimSuffix(l.string("SERVER_PUBLIC_URL", ""), "/")
+	readTimeout := l.duration("SERVER_READ_TIMEOUT", 10*time.Second, time.Second, 0)
+	writeTimeout := l.duration("SERVER_WRITE_TIMEOUT", 10*time.Second, time.Second, 0)
+	readHeaderTimeout := l.duration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second, time.Second, 0)
+	idleTimeout := l.duration("SERVER_IDLE_TIMEOUT", 120*time.Second, time.Second, 0)
+	maxHeaderBytes := l.integer("SERVER_MAX_HEADER_BYTES", 1<<20, 1, math.MaxInt) // 1 MiB
+	drainDelay := l.duration("SERVER_DRAIN_DELAY", 0, time.Second, 0)
+	shutdownTimeout := l.duration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second, time.Second, time.Second)
+
+	// TLS config
+	tlsConfig := TLSConfig{
+		CertFile:       l.string("SERVER_TLS_CERT_FILE", ""),
+		KeyFile:        l.string("SERVER_TLS_KEY_FILE", ""),
+		MinVersion:     l.choice("SERVER_TLS_MIN_VERSION", "1.2", "1.2", "1.3"),
+		CipherSuites:   l.list("SERVER_TLS_CIPHER_SUITES", ""),
+		ClientAuth:     l.choice("SERVER_TLS_CLIENT_AUTH", "none", "none", "optional", "require"),
+		ClientCAFile:   l.string("SERVER_TLS_CLIENT_CA_FILE", ""),
+		ReloadInterval: l.duration("SERVER_TLS_RELOAD_INTERVAL", 10*time.Second, time.Second, time.Second),
+	}
+	if (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+		l.fail(fmt.Errorf("SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set together"))
+	}
+	if tlsConfig.ClientAuth != "none" && (tlsConfig.CertFile == "" || tlsConfig.ClientCAFile == "") {
+		l.fail(fmt.Errorf("SERVER_TLS_CLIENT_AUTH %q requires SERVER_TLS_CERT_FILE and SERVER_TLS_CLIENT_CA_FILE", tlsConfig.ClientAuth))
+	}
 
 	// JWT config
-	jwtSecret := getEnv("JWT_SECRET", "your-secret-key")
-	accessTokenTTL, _ := strconv.Atoi(getEnv("JWT_ACCESS_TOKEN_TTL", "15"))      // 15 minutes
-	refreshTokenTTL, _ := strconv.Atoi(getEnv("JWT_REFRESH_TOKEN_TTL", "10080")) // 7 days
+	jwtSecret := l.string("JWT_SECRET", "")
+	accessTokenTTL := l.duration("JWT_ACCESS_TOKEN_TTL", 15*time.Minute, time.Minute, time.Second)
+	refreshTokenTTL := l.duration("JWT_REFRESH_TOKEN_TTL", 7*24*time.Hour, time.Minute, time.Second)
+	sessionMaxLifetime := l.duration("JWT_SESSION_MAX_LIFETIME", 30*24*time.Hour, time.Minute, time.Second)
+	sessionOverrides, err := parseSessionOverrides(l.string("JWT_SESSION_OVERRIDES", ""))
+	if err != nil {
+		l.fail(err)
+	}
+	for _, key := range slices.Sorted(maps.Keys(sessionOverrides)) {
+		override := sessionOverrides[key]
+		if strings.HasPrefix(key, "client:") && (override.IdleTimeout > refreshTokenTTL || override.MaxLifetime > sessionMaxLifetime) {
+			l.fail(fmt.Errorf("JWT_SESSION_OVERRIDES entry %s can only shorten sessions, not exceed JWT_REFRESH_TOKEN_TTL %s or JWT_SESSION_MAX_LIFETIME %s", key, refreshTokenTTL, sessionMaxLifetime))
+		}
+	}
+	purgeInterval := l.duration("JWT_PURGE_INTERVAL", time.Hour, time.Minute, time.Second)
+
+	// Password hashing config
+	passwordAlgorithm := l.choice("PASSWORD_HASH_ALGORITHM", "argon2id", "bcrypt", "argon2id", "scrypt")
+	bcryptCost := l.integer("PASSWORD_BCRYPT_COST", 10, 4, 31)
+	argon2Memory := l.integer("PASSWORD_ARGON2_MEMORY", 65536, 1, math.MaxInt32) // 64 MiB
+	argon2Iterations := l.integer("PASSWORD_ARGON2_ITERATIONS", 3, 1, math.MaxInt32)
+	argon2Parallelism := l.integer("PASSWORD_ARGON2_PARALLELISM", 4, 1, math.MaxUint8)
+	scryptLogN := l.integer("PASSWORD_SCRYPT_LOGN", 15, 1, 31)
+	scryptR := l.integer("PASSWORD_SCRYPT_R", 8, 1, math.MaxInt)
+	scryptP := l.integer("PASSWORD_SCRYPT_P", 1, 1, math.MaxInt)
+
+	// Password policy config
+	passwordMinLength := l.integer("PASSWORD_MIN_LENGTH", 8, 0, math.MaxInt)
+	passwordMaxLength := l.integer("PASSWORD_MAX_LENGTH", 72, 0, math.MaxInt)
+	if passwordMaxLength > 0 && passwordMaxLength < passwordMinLength {
+		l.fail(fmt.Errorf("PASSWORD_MAX_LENGTH %d is less than PASSWORD_MIN_LENGTH %d", passwordMaxLength, passwordMinLength))
+	}
+	requireUppercase := l.boolean("PASSWORD_REQUIRE_UPPERCASE", false)
+	requireLowercase := l.boolean("PASSWORD_REQUIRE_LOWERCASE", false)
+	requireDigit := l.boolean("PASSWORD_REQUIRE_DIGIT", false)
+	requireSymbol := l.boolean("PASSWORD_REQUIRE_SYMBOL", false)
+	maxRepeats := l.integer("PASSWORD_MAX_REPEATS", 3, 0, math.MaxInt)
+	disallowUserInfo := l.boolean("PASSWORD_DISALLOW_USER_INFO", true)
+	minStrength := l.integer("PASSWORD_MIN_STRENGTH", 2, 0, 4)
+	breachedCorpusDir := l.string("PASSWORD_BREACHED_CORPUS_DIR", "")
+
+	// Auth config
+	enumerationSafeRegistration := l.boolean("AUTH_ENUMERATION_SAFE_REGISTRATION", false)
+	// Registering no longer grants the admin role, so the setting that did
+	// is refused rather than silently ignored
+	if adminEmails, _ := l.lookup("AUTH_ADMIN_EMAILS"); adminEmails != "" {
+		l.fail(fmt.Errorf("AUTH_ADMIN_EMAILS is no longer supported: promote an existing account with -promote-admin"))
+	}
+	passwordResetTTL := l.duration("AUTH_PASSWORD_RESET_TTL", time.Hour, time.Minute, time.Second)
+	statusCheck := l.boolean("AUTH_STATUS_CHECK", true)
+	statusCacheTTL := l.duration("AUTH_STATUS_CACHE_TTL", 5*time.Second, time.Second, 0)
+	sessionCacheTTL := l.duration("AUTH_SESSION_CACHE_TTL", 5*time.Second, time.Second, 0)
+	dpopProofLifetime := l.duration("AUTH_DPOP_PROOF_LIFETIME", time.Minute, time.Second, time.Second)
+
+	// Mail config
+	mailConfig := MailConfig{
+		Host:     l.string("MAIL_SMTP_HOST", ""),
+		Port:     l.string("MAIL_SMTP_PORT", "587"),
+		Username: l.string("MAIL_SMTP_USERNAME", ""),
+		Password: l.string("MAIL_SMTP_PASSWORD", ""),
+		From:     l.string("MAIL_FROM", "no-reply@localhost"),
+	}
+
+	// Cookie config
+	cookiesEnabled := l.boolean("COOKIE_TOKENS_ENABLED", false)
+	cookieAccessToken := l.boolean("COOKIE_ACCESS_TOKEN", false)
+	cookieSecure := l.boolean("COOKIE_SECURE", true)
+	cookieSameSite := l.choice("COOKIE_SAMESITE", "strict", "strict", "lax", "none")
+	cookieDomain := l.string("COOKIE_DOMAIN", "")
+
+	// Audit config
+	auditSinks := l.list("AUDIT_SINKS", "stdout")
+	for _, sink := range auditSinks {
+		switch sink {
+		case "stdout", "file", "sql":
+		default:
+			l.fail(fmt.Errorf("unsupported audit sink %q in AUDIT_SINKS", sink))
+		}
+	}
+	auditConfig := AuditConfig{
+		Sinks:     auditSinks,
+		FilePath:  l.string("AUDIT_FILE", "audit.jsonl"),
+		SQLDriver: l.string("AUDIT_SQL_DRIVER", "sqlite"),
+		SQLDSN:    l.string("AUDIT_SQL_DSN", "audit.db"),
+		HMACKey:   l.string("AUDIT_HMAC_KEY", ""),
+	}
+
+	// Database config
+	databaseConfig := DatabaseConfig{
+		Backend:              l.choice("DATABASE_BACKEND", "memory", "memory", "sql"),
+		SQLDriver:            l.string("DATABASE_SQL_DRIVER", "sqlite"),
+		SQLDSN:               l.string("DATABASE_SQL_DSN", "file:auth.db?_pragma=busy_timeout(5000)"),
+		OutboxPollInterval:   l.duration("OUTBOX_POLL_INTERVAL", time.Second, time.Second, time.Second),
+		OutboxMaxAttempts:    l.integer("OUTBOX_MAX_ATTEMPTS", 10, 1, math.MaxInt),
+		OutboxRetryBaseDelay: l.duration("OUTBOX_RETRY_BASE_DELAY", 5*time.Second, time.Second, time.Second),
+		OutboxRetryMaxDelay:  l.duration("OUTBOX_RETRY_MAX_DELAY", time.Hour, time.Second, time.Second),
+	}
+	if databaseConfig.OutboxRetryMaxDelay < databaseConfig.OutboxRetryBaseDelay {
+		l.fail(fmt.Errorf("OUTBOX_RETRY_MAX_DELAY %s is less than OUTBOX_RETRY_BASE_DELAY %s", databaseConfig.OutboxRetryMaxDelay, databaseConfig.OutboxRetryBaseDelay))
+	}
+
+	// Webhook config
+	webhookConfig := WebhookConfig{
+		Store:          l.choice("WEBHOOK_STORE", "memory", "memory", "sql"),
+		SQLDriver:      l.string("WEBHOOK_SQL_DRIVER", "sqlite"),
+		SQLDSN:         l.string("WEBHOOK_SQL_DSN", "webhooks.db"),
+		MaxAttempts:    l.integer("WEBHOOK_MAX_ATTEMPTS", 10, 1, math.MaxInt),
+		RetryBaseDelay: l.duration("WEBHOOK_RETRY_BASE_DELAY", 30*time.Second, time.Second, time.Second),
+		RetryMaxDelay:  l.duration("WEBHOOK_RETRY_MAX_DELAY", 6*time.Hour, time.Second, time.Second),
+		Timeout:        l.duration("WEBHOOK_TIMEOUT", 10*time.Second, time.Second, time.Second),
+		PollInterval:   l.duration("WEBHOOK_POLL_INTERVAL", 5*time.Second, time.Second, time.Second),
+	}
+	if webhookConfig.RetryMaxDelay < webhookConfig.RetryBaseDelay {
+		l.fail(fmt.Errorf("WEBHOOK_RETRY_MAX_DELAY %s is less than WEBHOOK_RETRY_BASE_DELAY %s", webhookConfig.RetryMaxDelay, webhookConfig.RetryBaseDelay))
+	}
+
+	// Log config
+	logConfig := LogConfig{
+		Level:  l.choice("LOG_LEVEL", "info", "debug", "info", "warn", "error"),
+		Format: l.choice("LOG_FORMAT", "json", "json", "text"),
+	}
+
+	// Metrics config
+	metricsConfig := MetricsConfig{
+		Enabled: l.boolean("METRICS_ENABLED", true),
+		Addr:    l.string("METRICS_ADDR", "localhost:9090"),
+		Path:    l.string("METRICS_PATH", "/metrics"),
+	}
+
+	// Tracing config
+	tracingConfig := TracingConfig{
+		Exporter:     l.choice("TRACING_EXPORTER", "none", "none", "stdout", "otlp"),
+		OTLPEndpoint: l.string("TRACING_OTLP_ENDPOINT", "http://localhost:4318"),
+		ServiceName:  l.string("TRACING_SERVICE_NAME", "learn"),
+		SampleRatio:  l.float("TRACING_SAMPLE_RATIO", 1, 0, 1),
+	}
+
+	// Health config
+	healthCheckTimeout := l.duration("HEALTH_CHECK_TIMEOUT", 2*time.Second, time.Second, time.Second)
+
+	// Secrets
+	if jwtSecret == "" {
+		l.fail(fmt.Errorf("JWT_SECRET is required"))
+	}
+	if environment == "production" {
+		checkSecret(l, "JWT_SECRET", jwtSecret)
+		if auditConfig.HMACKey != "" {
+			checkSecret(l, "AUDIT_HMAC_KEY", auditConfig.HMACKey)
+		}
+	}
+
+	if err := l.err(); err != nil {
+		return nil, err
+	}
 
 	config := &Config{
+		Environment: environment,
 		Server: ServerConfig{
-			Port:         port,
-			ReadTimeout:  time.Duration(readTimeout) * time.Second,
-			WriteTimeout: time.Duration(writeTimeout) * time.Second,
+			Port:              strconv.Itoa(port),
+			PublicURL:         publicURL,
+			ReadTimeout:       readTimeout,
+			ReadHeaderTimeout: readHeaderTimeout,
+			WriteTimeout:      writeTimeout,
+			IdleTimeout:       idleTimeout,
+			MaxHeaderBytes:    maxHeaderBytes,
+			DrainDelay:        drainDelay,
+			ShutdownTimeout:   shutdownTimeout,
+			TLS:               tlsConfig,
 		},
 		JWT: JWTConfig{
-			Secret:          jwtSecret,
-			AccessTokenTTL:  time.Duration(accessTokenTTL) * time.Minute,
-			RefreshTokenTTL: time.Duration(refreshTokenTTL) * time.Minute,
+			Secret:             jwtSecret,
+			AccessTokenTTL:     accessTokenTTL,
+			RefreshTokenTTL:    refreshTokenTTL,
+			SessionMaxLifetime: sessionMaxLifetime,
+			SessionOverrides:   sessionOverrides,
+			PurgeInterval:      purgeInterval,
+		},
+		Database: databaseConfig,
+		Password: PasswordConfig{
+			Algorithm:         passwordAlgorithm,
+			BcryptCost:        bcryptCost,
+			Argon2Memory:      uint32(argon2Memory),
+			Argon2Iterations:  uint32(argon2Iterations),
+			Argon2Parallelism: uint8(argon2Parallelism),
+			ScryptLogN:        uint8(scryptLogN),
+			ScryptR:           scryptR,
+			ScryptP:           scryptP,
+			MinLength:         passwordMinLength,
+			MaxLength:         passwordMaxLength,
+			RequireUppercase:  requireUppercase,
+			RequireLowercase:  requireLowercase,
+			RequireDigit:      requireDigit,
+			RequireSymbol:     requireSymbol,
+			MaxRepeats:        maxRepeats,
+			DisallowUserInfo:  disallowUserInfo,
+			MinStrength:       minStrength,
+			BreachedCorpusDir: breachedCorpusDir,
+		},
+		Auth: AuthConfig{
+			EnumerationSafeRegistration: enumerationSafeRegistration,
+			PasswordResetTTL:            passwordResetTTL,
+			StatusCheck:                 statusCheck,
+			StatusCacheTTL:              statusCacheTTL,
+			SessionCacheTTL:             sessionCacheTTL,
+			DPoPProofLifetime:           dpopProofLifetime,
 		},
-		Database: DatabaseConfig{
-			InMemory: true,
+		Mail: mailConfig,
+		Cookie: CookieConfig{
+			Enabled:     cookiesEnabled,
+			AccessToken: cookieAccessToken,
+			Secure:      cookieSecure,
+			SameSite:    cookieSameSite,
+			Domain:      cookieDomain,
 		},
+		Audit:   auditConfig,
+		Webhook: webhookConfig,
+		Log:     logConfig,
+		Metrics: metricsConfig,
+		Tracing: tracingConfig,
+		Health: HealthConfig{
+			CheckTimeout: healthCheckTimeout,
+		},
+		settings: l.settings,
 	}
 
 	return config, nil
 }
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
+// checkSecret refuses a secret that is one of the examples shipped with
+// the server or too short to resist guessing
+func checkSecret(l *loader, key, secret string) {
+	for _, example := range exampleSecrets {
+		if secret == example {
+			l.fail(fmt.Errorf("%s must be changed from its example value in production", key))
+			return
+		}
+	}
+	if len(secret) < minSecretLength {
+		l.fail(fmt.Errorf("%s must be at least %d bytes long in production, got %d", key, minSecretLength, len(secret)))
+	}
+}
+
+// PrintSettings writes the effective value and source of every setting,
+// one per line in the form of the .env file, with secrets redacted
+func (c *Config) PrintSettings(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, setting := range c.settings {
+		fmt.Fprintf(tw, "%s=%s\t# %s\n", setting.Key, redact(setting.Key, setting.Value), setting.Source)
+	}
+	return tw.Flush()
+}
+
+// redact hides the value of a secret setting, and the password in a URL
+// such as a data source name
+func redact(key, value string) string {
 	if value == "" {
-		return defaultValue
+		return value
+	}
+	for _, secret := range secretKeys {
+		if key == secret {
+			return redacted
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			value = u.Redacted()
+		}
+	}
+	return dsnPassword.ReplaceAllString(value, "${1}xxxxx")
+}
+
+// parseSessionOverrides parses session lifetime overrides of the form
+// "client:mobile=43200/129600,role:admin=30m/12h", mapping a client or role
+// to an idle timeout and maximum lifetime, in minutes unless a unit is given
+func parseSessionOverrides(value string) (map[string]SessionLifetime, error) {
+	overrides := make(map[string]SessionLifetime)
+	if strings.TrimSpace(value) == "" {
+		return overrides, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		key, lifetimes, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || !(strings.HasPrefix(key, "client:") || strings.HasPrefix(key, "role:")) {
+			return nil, fmt.Errorf("invalid JWT_SESSION_OVERRIDES entry %q", entry)
+		}
+		idle, max, ok := strings.Cut(lifetimes, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid JWT_SESSION_OVERRIDES entry %q", entry)
+		}
+		idleTimeout, err := parseDuration(idle, time.Minute)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_SESSION_OVERRIDES entry %q: %w", entry, err)
+		}
+		maxLifetime, err := parseDuration(max, time.Minute)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_SESSION_OVERRIDES entry %q: %w", entry, err)
+		}
+		if idleTimeout <= 0 || maxLifetime <= 0 {
+			return nil, fmt.Errorf("invalid JWT_SESSION_OVERRIDES entry %q: lifetimes must be positive", entry)
+		}
+		if idleTimeout > maxLifetime {
+			return nil, fmt.Errorf("invalid JWT_SESSION_OVERRIDES entry %q: idle timeout %s exceeds maximum lifetime %s", entry, idleTimeout, maxLifetime)
+		}
+		overrides[key] = SessionLifetime{
+			IdleTimeout: idleTimeout,
+			MaxLifetime: maxLifetime,
+		}
+	}
+	return overrides, nil
+}
+
+// parseList parses a comma-separated list, dropping empty entries
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	return value
+	return items
 }
@@ -0,0 +1,309 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of a setting, from the lowest precedence to the highest
+const (
+	sourceDefault     = "default"
+	sourceDotEnv      = ".env"
+	sourceEnvironment = "environment"
+)
+
+// Setting is the effective value of a configuration key and where it came
+// from: "default", ".env", the config file's path or "environment"
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// loader resolves settings from the environment, a config file, the .env
+// file and defaults, in that order of precedence. Rather than stopping at
+// the first invalid value it collects every error, so that a broken
+// configuration can be fixed in one go.
+type loader struct {
+	dotEnv   map[string]string
+	file     map[string]string
+	filePath string
+	// used records the file's keys that were looked up, so that unknown,
+	// probably misspelt, keys can be reported
+	used     map[string]bool
+	settings []Setting
+	errs     []error
+}
+
+// newLoader reads the .env file, if there is one, and the config file, if
+// a path is given or set in CONFIG_FILE
+func newLoader(filePath string) *loader {
+	l := &loader{used: make(map[string]bool)}
+
+	dotEnv, err := godotenv.Read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		l.fail(fmt.Errorf("reading .env: %w", err))
+	}
+	l.dotEnv = dotEnv
+
+	if filePath == "" {
+		filePath, _ = l.lookup("CONFIG_FILE")
+	}
+	if filePath != "" {
+		file, err := readFile(filePath)
+		if err != nil {
+			l.fail(err)
+		}
+		l.file = file
+		l.filePath = filePath
+	}
+	return l
+}
+
+// fail records an error
+func (l *loader) fail(err error) {
+	l.errs = append(l.errs, err)
+}
+
+// err returns every error recorded, including one for each key in the
+// config file that was never looked up
+func (l *loader) err() error {
+	var unknown []string
+	for key := range l.file {
+		if !l.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		l.fail(fmt.Errorf("unknown setting %s in %s", key, l.filePath))
+	}
+	return errors.Join(l.errs...)
+}
+
+// lookup returns the raw value of a key and its source. Empty values count
+// as unset, so that a layer can leave a key to the ones below it.
+func (l *loader) lookup(key string) (string, string) {
+	l.used[key] = true
+	if value := os.Getenv(key); value != "" {
+		return value, sourceEnvironment
+	}
+	if value := l.file[key]; value != "" {
+		return value, l.filePath
+	}
+	if value := l.dotEnv[key]; value != "" {
+		return value, sourceDotEnv
+	}
+	return "", sourceDefault
+}
+
+// record keeps the effective value of a key for printing
+func (l *loader) record(key, value, source string) {
+	l.settings = append(l.settings, Setting{Key: key, Value: value, Source: source})
+}
+
+// string gets a string setting
+func (l *loader) string(key, defaultValue string) string {
+	value, source := l.lookup(key)
+	if source == sourceDefault {
+		value = defaultValue
+	}
+	l.record(key, value, source)
+	return value
+}
+
+// choice gets a case-insensitive setting that must be one of options
+func (l *loader) choice(key, defaultValue string, options ...string) string {
+	value := strings.ToLower(l.string(key, defaultValue))
+	for _, option := range options {
+		if value == option {
+			return value
+		}
+	}
+	l.fail(fmt.Errorf("unsupported %s %q, expected one of %s", key, value, strings.Join(options, ", ")))
+	return defaultValue
+}
+
+// list gets a comma-separated list setting
+func (l *loader) list(key, defaultValue string) []string {
+	return parseList(l.string(key, defaultValue))
+}
+
+// integer gets an integer setting between min and max inclusive
+func (l *loader) integer(key string, defaultValue, min, max int) int {
+	raw, source := l.lookup(key)
+	value := defaultValue
+	if source != sourceDefault {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			l.fail(fmt.Errorf("invalid %s %q: expected an integer", key, raw))
+			return defaultValue
+		}
+		value = parsed
+	}
+	l.record(key, strconv.Itoa(value), source)
+	if value < min || value > max {
+		if max == math.MaxInt {
+			l.fail(fmt.Errorf("%s must be at least %d, got %d", key, min, value))
+		} else {
+			l.fail(fmt.Errorf("%s must be between %d and %d, got %d", key, min, max, value))
+		}
+		return defaultValue
+	}
+	return value
+}
+
+// float gets a floating point setting between min and max inclusive
+func (l *loader) float(key string, defaultValue, min, max float64) float64 {
+	raw, source := l.lookup(key)
+	value := defaultValue
+	if source != sourceDefault {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			l.fail(fmt.Errorf("invalid %s %q: expected a number", key, raw))
+			return defaultValue
+		}
+		value = parsed
+	}
+	l.record(key, strconv.FormatFloat(value, 'g', -1, 64), source)
+	if !(value >= min && value <= max) {
+		l.fail(fmt.Errorf("%s must be between %g and %g, got %g", key, min, max, value))
+		return defaultValue
+	}
+	return value
+}
+
+// boolean gets a boolean setting
+func (l *loader) boolean(key string, defaultValue bool) bool {
+	raw, source := l.lookup(key)
+	value := defaultValue
+	if source != sourceDefault {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			l.fail(fmt.Errorf("invalid %s %q: expected true or false", key, raw))
+			return defaultValue
+		}
+		value = parsed
+	}
+	l.record(key, strconv.FormatBool(value), source)
+	return value
+}
+
+// duration gets a duration setting of at least min, given either with a
+// unit, such as "15m" or "1h30m", or as a bare number of unit
+func (l *loader) duration(key string, defaultValue, unit, min time.Duration) time.Duration {
+	raw, source := l.lookup(key)
+	value := defaultValue
+	if source != sourceDefault {
+		parsed, err := parseDuration(raw, unit)
+		if err != nil {
+			l.fail(fmt.Errorf("invalid %s %q: %w", key, raw, err))
+			return defaultValue
+		}
+		value = parsed
+	}
+	l.record(key, value.String(), source)
+	if value < min {
+		if min == 0 {
+			l.fail(fmt.Errorf("%s must not be negative, got %s", key, value))
+		} else {
+			l.fail(fmt.Errorf("%s must be at least %s, got %s", key, min, value))
+		}
+		return defaultValue
+	}
+	return value
+}
+
+// parseDuration parses a duration with a unit, or a bare integer as a
+// number of unit, the form settings took before units were accepted
+func parseDuration(value string, unit time.Duration) (time.Duration, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New(`expected a duration such as "90s", "15m" or "1h"`)
+	}
+	return d, nil
+}
+
+// readFile reads a YAML or TOML config file, chosen by its extension, into
+// settings keyed like the environment variables. Nested tables are joined
+// with underscores, so "server: {tls: {cert_file: ...}}" sets
+// SERVER_TLS_CERT_FILE, and lists become comma-separated values.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var document map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &document)
+	case ".toml":
+		err = toml.Unmarshal(data, &document)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: expected a .yaml, .yml or .toml extension", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	settings := make(map[string]string)
+	if err := flatten(settings, "", document); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// flatten adds the values of a config file table to settings, prefixing
+// their keys
+func flatten(settings map[string]string, prefix string, table map[string]interface{}) error {
+	for name, value := range table {
+		key := strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			if err := flatten(settings, key, nested); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var text string
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				if _, nested := item.(map[string]interface{}); nested || item == nil {
+					return fmt.Errorf("%s must be a list of values", key)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			text = strings.Join(items, ",")
+		default:
+			text = fmt.Sprint(value)
+		}
+		if _, duplicate := settings[key]; duplicate {
+			return fmt.Errorf("%s is set more than once", key)
+		}
+		settings[key] = text
+	}
+	return nil
+}
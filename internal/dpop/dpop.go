@@ -0,0 +1,204 @@
+// Package dpop verifies DPoP proofs (RFC 9449). A client proves that it
+// holds the key its tokens are bound to by sending, with each request, a
+// JWT signed by that key that names the request's method and URL and, when
+// a token is presented, hashes the token.
+package dpop
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrInvalidProof is returned, wrapped with the reason, for a proof that
+	// is malformed, badly signed or does not match the request
+	ErrInvalidProof = errors.New("invalid DPoP proof")
+	// ErrReplayedProof is returned for a proof that has already been used
+	ErrReplayedProof = errors.New("DPoP proof has already been used")
+)
+
+// maxProofsPerClient bounds the number of proof IDs the replay cache holds
+// for one client, so that no client can fill it at the expense of others
+const maxProofsPerClient = 10000
+
+// signingMethods lists the asymmetric algorithms proofs may be signed with
+var signingMethods = []string{"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "EdDSA"}
+
+// Proof is a verified DPoP proof
+type Proof struct {
+	// KeyThumbprint is the JWK thumbprint of the key the proof is signed
+	// with, which tokens are bound to in their cnf.jkt claim
+	KeyThumbprint string
+	ID            string
+	IssuedAt      time.Time
+}
+
+// Verifier verifies DPoP proofs, remembering the IDs of those it accepted
+// until they expire so that none can be used twice
+type Verifier struct {
+	// lifetime is how far a proof's issue time may lie from the present
+	lifetime time.Duration
+	// maxPerClient is how many unexpired proof IDs a client may have
+	maxPerClient int
+	seen         map[string]seenProof // Proof ID to who sent it and when
+	clients      map[string]int       // Client to the number of its IDs in seen
+	lastSweep    time.Time
+	mutex        sync.Mutex
+}
+
+type seenProof struct {
+	client   string
+	forgetAt time.Time
+}
+
+// NewVerifier creates a verifier accepting proofs issued within lifetime
+// of the present
+func NewVerifier(lifetime time.Duration) *Verifier {
+	return &Verifier{
+		lifetime:     lifetime,
+		maxPerClient: maxProofsPerClient,
+		seen:         make(map[string]seenProof),
+		clients:      make(map[string]int),
+		lastSweep:    time.Now(),
+	}
+}
+
+// Verify checks a proof for a request with the given method and URL, sent
+// by client, usually its IP address. If an access token is presented with
+// the request, the proof must carry its hash in the ath claim.
+func (v *Verifier) Verify(proof, method, requestURL, accessToken, client string) (*Proof, error) {
+	var key *jwk
+	token, err := jwt.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); !strings.EqualFold(typ, "dpop+jwt") {
+			return nil, errors.New("typ is not dpop+jwt")
+		}
+		var err error
+		if key, err = parseJWK(token.Header["jwk"]); err != nil {
+			return nil, err
+		}
+		return key.publicKey(token.Method.Alg())
+	}, jwt.WithValidMethods(signingMethods))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, fmt.Errorf("%w: missing jti", ErrInvalidProof)
+	}
+	if htm, _ := claims["htm"].(string); htm != method {
+		return nil, fmt.Errorf("%w: htm does not match the request method", ErrInvalidProof)
+	}
+	htu, _ := claims["htu"].(string)
+	if normalizeURL(htu) == "" || normalizeURL(htu) != normalizeURL(requestURL) {
+		return nil, fmt.Errorf("%w: htu does not match the request URL", ErrInvalidProof)
+	}
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return nil, fmt.Errorf("%w: missing iat", ErrInvalidProof)
+	}
+	now := time.Now()
+	if age := now.Sub(iat.Time); age > v.lifetime || age < -v.lifetime {
+		return nil, fmt.Errorf("%w: iat is too far from the current time", ErrInvalidProof)
+	}
+	if accessToken != "" {
+		if ath, _ := claims["ath"].(string); ath != TokenHash(accessToken) {
+			return nil, fmt.Errorf("%w: ath does not match the access token", ErrInvalidProof)
+		}
+	}
+
+	// Checked last, so that only proofs that are otherwise valid use up
+	// their ID
+	if err := v.remember(key.thumbprint()+":"+jti, client, now, iat.Time); err != nil {
+		return nil, err
+	}
+
+	return &Proof{KeyThumbprint: key.thumbprint(), ID: jti, IssuedAt: iat.Time}, nil
+}
+
+// remember records a proof ID sent by a client, returning ErrReplayedProof
+// if it is already known. An ID is kept until a proof issued at the same
+// time would be too old to be accepted anyway.
+func (v *Verifier) remember(id, client string, now, issuedAt time.Time) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if now.Sub(v.lastSweep) >= v.lifetime {
+		v.evictExpired(now)
+	}
+	if previous, seen := v.seen[id]; seen {
+		if !now.After(previous.forgetAt) {
+			return ErrReplayedProof
+		}
+		v.forget(id, previous)
+	}
+	if v.clients[client] >= v.maxPerClient {
+		v.evictExpired(now)
+		// Forgetting unexpired IDs would allow replays, so the client's new
+		// proofs are refused until some expire; other clients are unaffected
+		if v.clients[client] >= v.maxPerClient {
+			return fmt.Errorf("%w: too many proofs in flight", ErrInvalidProof)
+		}
+	}
+	v.seen[id] = seenProof{client: client, forgetAt: issuedAt.Add(v.lifetime)}
+	v.clients[client]++
+	return nil
+}
+
+// evictExpired removes IDs that can be forgotten; the caller must hold the
+// lock
+func (v *Verifier) evictExpired(now time.Time) {
+	for id, proof := range v.seen {
+		if now.After(proof.forgetAt) {
+			v.forget(id, proof)
+		}
+	}
+	v.lastSweep = now
+}
+
+// forget removes an ID; the caller must hold the lock
+func (v *Verifier) forget(id string, proof seenProof) {
+	delete(v.seen, id)
+	v.clients[proof.client]--
+	if v.clients[proof.client] == 0 {
+		delete(v.clients, proof.client)
+	}
+}
+
+// TokenHash returns the base64url-encoded SHA-256 hash of an access token,
+// as carried in a proof's ath claim
+func TokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// normalizeURL returns a URL without its query and fragment, with the
+// scheme and host in lower case and a default port removed, so that
+// equivalent URLs compare equal. It returns an empty string for a URL that
+// is not absolute.
+func normalizeURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "https" && port == "443") && !(scheme == "http" && port == "80") {
+		host = net.JoinHostPort(host, port)
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path
+}
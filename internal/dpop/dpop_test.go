@@ -0,0 +1,187 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKey signs proofs in tests
+type testKey struct {
+	private *ecdsa.PrivateKey
+	jwk     map[string]interface{}
+}
+
+func newTestKey(t *testing.T) *testKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	point := make([]byte, 32)
+	return &testKey{private: private, jwk: map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(private.X.FillBytes(point)),
+		"y":   base64.RawURLEncoding.EncodeToString(private.Y.FillBytes(point)),
+	}}
+}
+
+// proof signs a proof for a request, applying modify to its claims and
+// header first
+func (k *testKey) proof(t *testing.T, method, url string, modify func(claims jwt.MapClaims, header map[string]interface{})) string {
+	t.Helper()
+	claims := jwt.MapClaims{"jti": uuid.New().String(), "htm": method, "htu": url, "iat": time.Now().Unix()}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = k.jwk
+	if modify != nil {
+		modify(claims, token.Header)
+	}
+	signed, err := token.SignedString(k.private)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestVerify(t *testing.T) {
+	key := newTestKey(t)
+	other := newTestKey(t)
+	const url = "https://api.example.com/user/profile"
+	const accessToken = "eyJhbGciOiJIUzI1NiJ9.e30.signature"
+
+	tests := []struct {
+		name        string
+		proof       string
+		method      string
+		url         string
+		accessToken string
+		valid       bool
+	}{
+		{"Valid", key.proof(t, "POST", url, nil), "POST", url, "", true},
+		{"Hashes the access token", key.proof(t, "GET", url, func(claims jwt.MapClaims, _ map[string]interface{}) {
+			claims["ath"] = TokenHash(accessToken)
+		}), "GET", url, accessToken, true},
+		{"Equivalent URL", key.proof(t, "GET", "HTTPS://API.example.com:443/user/profile", nil), "GET", url + "?page=2", "", true},
+		{"Other method", key.proof(t, "POST", url, nil), "GET", url, "", false},
+		{"Other URL", key.proof(t, "GET", "https://api.example.com/user/sessions", nil), "GET", url, "", false},
+		{"Other host", key.proof(t, "GET", "https://evil.example.com/user/profile", nil), "GET", url, "", false},
+		{"Issued too long ago", key.proof(t, "GET", url, func(claims jwt.MapClaims, _ map[string]interface{}) {
+			claims["iat"] = time.Now().Add(-2 * time.Minute).Unix()
+		}), "GET", url, "", false},
+		{"Issued in the future", key.proof(t, "GET", url, func(claims jwt.MapClaims, _ map[string]interface{}) {
+			claims["iat"] = time.Now().Add(2 * time.Minute).Unix()
+		}), "GET", url, "", false},
+		{"Missing iat", key.proof(t, "GET", url, func(claims jwt.MapClaims, _ map[string]interface{}) {
+			delete(claims, "iat")
+		}), "GET", url, "", false},
+		{"Missing jti", key.proof(t, "GET", url, func(claims jwt.MapClaims, _ map[string]interface{}) {
+			delete(claims, "jti")
+		}), "GET", url, "", false},
+		{"Missing ath", key.proof(t, "GET", url, nil), "GET", url, accessToken, false},
+		{"Hashes another token", key.proof(t, "GET", url, func(claims jwt.MapClaims, _ map[string]interface{}) {
+			claims["ath"] = TokenHash("another token")
+		}), "GET", url, accessToken, false},
+		{"Wrong typ", key.proof(t, "GET", url, func(_ jwt.MapClaims, header map[string]interface{}) {
+			header["typ"] = "JWT"
+		}), "GET", url, "", false},
+		{"Signed by another key", key.proof(t, "GET", url, func(_ jwt.MapClaims, header map[string]interface{}) {
+			header["jwk"] = other.jwk
+		}), "GET", url, "", false},
+		{"Private key", key.proof(t, "GET", url, func(_ jwt.MapClaims, header map[string]interface{}) {
+			header["jwk"] = map[string]interface{}{"kty": "EC", "crv": "P-256", "x": key.jwk["x"], "y": key.jwk["y"], "d": "secret"}
+		}), "GET", url, "", false},
+		{"Key on another curve", key.proof(t, "GET", url, func(_ jwt.MapClaims, header map[string]interface{}) {
+			header["jwk"] = map[string]interface{}{"kty": "EC", "crv": "P-384", "x": key.jwk["x"], "y": key.jwk["y"]}
+		}), "GET", url, "", false},
+		{"Missing jwk", key.proof(t, "GET", url, func(_ jwt.MapClaims, header map[string]interface{}) {
+			delete(header, "jwk")
+		}), "GET", url, "", false},
+		{"Symmetric algorithm", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"jti": "1", "htm": "GET", "htu": url, "iat": time.Now().Unix()})
+			token.Header["typ"] = "dpop+jwt"
+			token.Header["jwk"] = map[string]interface{}{"kty": "oct", "k": "c2VjcmV0"}
+			signed, err := token.SignedString([]byte("secret"))
+			require.NoError(t, err)
+			return signed
+		}(), "GET", url, "", false},
+		{"Not a JWT", "proof", "GET", url, "", false},
+	}
+
+	verifier := NewVerifier(time.Minute)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proof, err := verifier.Verify(tt.proof, tt.method, tt.url, tt.accessToken, "192.0.2.1")
+			if !tt.valid {
+				assert.ErrorIs(t, err, ErrInvalidProof)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, (&jwk{Kty: "EC", Crv: "P-256", X: key.jwk["x"].(string), Y: key.jwk["y"].(string)}).thumbprint(), proof.KeyThumbprint)
+		})
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	key := newTestKey(t)
+	verifier := NewVerifier(time.Minute)
+	proof := key.proof(t, "POST", "https://api.example.com/auth/login", nil)
+
+	_, err := verifier.Verify(proof, "POST", "https://api.example.com/auth/login", "", "192.0.2.1")
+	require.NoError(t, err)
+	_, err = verifier.Verify(proof, "POST", "https://api.example.com/auth/login", "", "192.0.2.1")
+	assert.ErrorIs(t, err, ErrReplayedProof)
+
+	// A proof that fails for another reason does not use up its ID
+	proof = key.proof(t, "POST", "https://api.example.com/auth/login", nil)
+	_, err = verifier.Verify(proof, "GET", "https://api.example.com/auth/login", "", "192.0.2.1")
+	assert.ErrorIs(t, err, ErrInvalidProof)
+	_, err = verifier.Verify(proof, "POST", "https://api.example.com/auth/login", "", "192.0.2.1")
+	assert.NoError(t, err)
+}
+
+func TestVerifyLimitsProofsPerClient(t *testing.T) {
+	key := newTestKey(t)
+	verifier := NewVerifier(time.Minute)
+	verifier.maxPerClient = 2
+	verify := func(client string, issuedAt time.Time) error {
+		proof := key.proof(t, "POST", "https://api.example.com/auth/login", func(claims jwt.MapClaims, header map[string]interface{}) {
+			claims["iat"] = issuedAt.Unix()
+		})
+		_, err := verifier.Verify(proof, "POST", "https://api.example.com/auth/login", "", client)
+		return err
+	}
+
+	now := time.Now()
+	require.NoError(t, verify("192.0.2.1", now.Add(-59*time.Second)))
+	require.NoError(t, verify("192.0.2.1", now))
+	assert.ErrorIs(t, verify("192.0.2.1", now), ErrInvalidProof)
+
+	// Other clients are unaffected by one that used up its budget
+	require.NoError(t, verify("192.0.2.2", now))
+
+	// The budget is freed as the client's proofs expire
+	assert.Eventually(t, func() bool {
+		return verify("192.0.2.1", time.Now()) == nil
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestThumbprint(t *testing.T) {
+	// The example of RFC 7638, section 3.1
+	key := &jwk{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", key.thumbprint())
+
+	_, err := key.publicKey("RS256")
+	assert.NoError(t, err)
+	_, err = key.publicKey("ES256")
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package dpop
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for proofs
+const minRSAKeyBits = 2048
+
+// jwk is a public JSON Web Key (RFC 7517) of one of the types DPoP proofs
+// may be signed with
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	// D is only present in private keys, which must never be sent
+	D string `json:"d,omitempty"`
+}
+
+// curves maps the JWK curve names of EC keys to their curves, the ECDH
+// curves used to check points, and the signature algorithms using them
+var curves = map[string]struct {
+	curve elliptic.Curve
+	ecdh  ecdh.Curve
+	alg   string
+}{
+	"P-256": {elliptic.P256(), ecdh.P256(), "ES256"},
+	"P-384": {elliptic.P384(), ecdh.P384(), "ES384"},
+	"P-521": {elliptic.P521(), ecdh.P521(), "ES512"},
+}
+
+// parseJWK decodes the jwk header of a proof
+func parseJWK(header interface{}) (*jwk, error) {
+	raw, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	var key jwk
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return nil, errors.New("malformed jwk")
+	}
+	if key.D != "" {
+		return nil, errors.New("jwk is a private key")
+	}
+	return &key, nil
+}
+
+// publicKey returns the key in the form the signing method for alg
+// verifies with, checking that the key is of the kind alg uses
+func (k *jwk) publicKey(alg string) (interface{}, error) {
+	switch k.Kty {
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok || curve.alg != alg {
+			return nil, fmt.Errorf("%s key on curve %q cannot verify %s", k.Kty, k.Crv, alg)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// The uncompressed point is rejected unless it lies on the curve
+		size := (curve.curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC key coordinates")
+		}
+		if _, err := curve.ecdh.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, errors.New("invalid EC key coordinates")
+		}
+		return &ecdsa.PublicKey{Curve: curve.curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	case "RSA":
+		switch alg {
+		case "RS256", "RS384", "RS512", "PS256", "PS384", "PS512":
+		default:
+			return nil, fmt.Errorf("%s key cannot verify %s", k.Kty, alg)
+		}
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSAKeyBits || len(e) > 4 || key.E < 3 || key.E%2 == 0 {
+			return nil, errors.New("weak or invalid RSA key")
+		}
+		return key, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" || alg != "EdDSA" {
+			return nil, fmt.Errorf("%s key on curve %q cannot verify %s", k.Kty, k.Crv, alg)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// thumbprint returns the key's base64url-encoded SHA-256 JWK thumbprint
+// (RFC 7638), hashing its required members in lexicographic order
+func (k *jwk) thumbprint() string {
+	var members interface{}
+	switch k.Kty {
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	}
+	canonical, _ := json.Marshal(members)
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// decode decodes a base64url key member. Only the canonical encoding is
+// accepted, so that a key has a single thumbprint.
+func decode(value string) ([]byte, error) {
+	decoded, err := base64.RawURLEncoding.Strict().DecodeString(value)
+	if err != nil || len(decoded) == 0 {
+		return nil, errors.New("invalid base64url key member")
+	}
+	return decoded, nil
+}
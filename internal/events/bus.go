@@ -0,0 +1,137 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// handler is a subscriber with its event type erased
+type handler func(event Event) error
+
+// namedHandler is an asynchronous subscriber. Its name records in the
+// outbox that it has handled an event.
+type namedHandler struct {
+	name    string
+	handler handler
+}
+
+// Bus delivers domain events to subscribers. Synchronous subscribers run in
+// the publishing goroutine, once the change the event describes has been
+// committed. Asynchronous subscribers run later, when the outbox relay
+// dispatches the event's outbox record; they receive every event at least
+// once and should recognise redelivered events by their ID.
+type Bus struct {
+	syncHandlers  map[string][]handler
+	asyncHandlers map[string][]namedHandler
+	// pending signals the outbox relay that events were stored
+	pending chan struct{}
+	mutex   sync.RWMutex
+}
+
+// NewBus creates a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{
+		syncHandlers:  make(map[string][]handler),
+		asyncHandlers: make(map[string][]namedHandler),
+		pending:       make(chan struct{}, 1),
+	}
+}
+
+// Subscribe registers a synchronous subscriber to events of type E.
+// Synchronous subscribers must be fast and must not fail the operation that
+// published the event; their errors are returned by Publish and logged.
+func Subscribe[E Event](bus *Bus, fn func(event E) error) {
+	eventType := eventTypeOf[E]()
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	bus.syncHandlers[eventType] = append(bus.syncHandlers[eventType], typed(fn))
+}
+
+// SubscribeAsync registers an asynchronous subscriber to events of type E
+// under a name that is unique among the subscribers of that type. A
+// subscriber that returns an error does not stop other subscribers; the
+// event is dispatched again later, to the subscribers that have not yet
+// handled it.
+func SubscribeAsync[E Event](bus *Bus, name string, fn func(event E) error) {
+	eventType := eventTypeOf[E]()
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	for _, h := range bus.asyncHandlers[eventType] {
+		if h.name == name {
+			panic(fmt.Sprintf("events: duplicate %s subscriber %q", eventType, name))
+		}
+	}
+	bus.asyncHandlers[eventType] = append(bus.asyncHandlers[eventType], namedHandler{name: name, handler: typed(fn)})
+}
+
+// Publish runs the synchronous subscribers of an event
+func (b *Bus) Publish(event Event) error {
+	b.mutex.RLock()
+	subscribers := b.syncHandlers[event.EventType()]
+	b.mutex.RUnlock()
+
+	var errs []error
+	for _, h := range subscribers {
+		if err := h(event); err != nil {
+			errs = append(errs, fmt.Errorf("%s subscriber: %w", event.EventType(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Dispatch runs the asynchronous subscribers of an event read from the
+// outbox, skipping those named in handled. It returns handled with the
+// names of the subscribers that succeeded added, so that a failed dispatch
+// can be retried without running them again.
+func (b *Bus) Dispatch(event Event, handled []string) ([]string, error) {
+	b.mutex.RLock()
+	subscribers := b.asyncHandlers[event.EventType()]
+	b.mutex.RUnlock()
+
+	var errs []error
+	for _, h := range subscribers {
+		if slices.Contains(handled, h.name) {
+			continue
+		}
+		if err := h.handler(event); err != nil {
+			errs = append(errs, fmt.Errorf("%s subscriber %s: %w", event.EventType(), h.name, err))
+			continue
+		}
+		handled = append(handled, h.name)
+	}
+	return handled, errors.Join(errs...)
+}
+
+// Notify wakes the outbox relay after events were stored in the outbox
+func (b *Bus) Notify() {
+	select {
+	case b.pending <- struct{}{}:
+	default:
+	}
+}
+
+// Pending receives a value when Notify has been called since the last
+// receive
+func (b *Bus) Pending() <-chan struct{} {
+	return b.pending
+}
+
+// typed adapts a subscriber of events of type E
+func typed[E Event](fn func(event E) error) handler {
+	return func(event Event) error {
+		typed, ok := event.(E)
+		if !ok {
+			return fmt.Errorf("unexpected event %T", event)
+		}
+		return fn(typed)
+	}
+}
+
+func eventTypeOf[E Event]() string {
+	var event E
+	return event.EventType()
+}
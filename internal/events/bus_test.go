@@ -0,0 +1,88 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+
+	var synchronous, asynchronous []string
+	Subscribe(bus, func(event LoginSucceeded) error {
+		synchronous = append(synchronous, event.SessionID)
+		return nil
+	})
+	Subscribe(bus, func(event LoginSucceeded) error {
+		return errors.New("subscriber failed")
+	})
+	Subscribe(bus, func(event TokenRefreshed) error {
+		synchronous = append(synchronous, "refreshed")
+		return nil
+	})
+	SubscribeAsync(bus, "sessions", func(event LoginSucceeded) error {
+		asynchronous = append(asynchronous, event.SessionID)
+		return nil
+	})
+	SubscribeAsync(bus, "failing", func(event LoginSucceeded) error {
+		return errors.New("subscriber failed")
+	})
+	assert.Panics(t, func() {
+		SubscribeAsync(bus, "sessions", func(event LoginSucceeded) error { return nil })
+	}, "subscriber names are unique per event type")
+
+	event := LoginSucceeded{Metadata: NewMetadata(nil), SessionID: "s1"}
+	err := bus.Publish(event)
+	assert.ErrorContains(t, err, "subscriber failed", "a failing subscriber's error is returned")
+	assert.Equal(t, []string{"s1"}, synchronous, "subscribers of other types ran or later subscribers were skipped")
+	assert.Empty(t, asynchronous)
+
+	handled, err := bus.Dispatch(event, nil)
+	assert.ErrorContains(t, err, "login.succeeded subscriber failing: subscriber failed")
+	assert.Equal(t, []string{"sessions"}, handled, "only subscribers that succeeded are recorded")
+	assert.Equal(t, []string{"s1"}, asynchronous)
+	assert.Equal(t, []string{"s1"}, synchronous)
+
+	// Subscribers that already handled the event are skipped
+	handled, err = bus.Dispatch(event, handled)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"sessions"}, handled)
+	assert.Equal(t, []string{"s1"}, asynchronous)
+
+	// Published events do not wake the relay, stored ones do
+	select {
+	case <-bus.Pending():
+		t.Fatal("relay woken without stored events")
+	default:
+	}
+	bus.Notify()
+	bus.Notify()
+	<-bus.Pending()
+}
+
+func TestOutboxRecordRoundTrip(t *testing.T) {
+	event := PasswordChanged{
+		Metadata: NewMetadata(nil),
+		User:     User{UserID: "1", Username: "alice", Email: "alice@example.com"},
+		Reset:    true,
+	}
+
+	record, err := NewOutboxRecord(event)
+	require.NoError(t, err)
+	assert.Equal(t, TypePasswordChanged, record.EventType)
+	assert.Equal(t, event.ID, record.ID)
+
+	decoded, err := FromOutboxRecord(record)
+	require.NoError(t, err)
+	require.IsType(t, PasswordChanged{}, decoded)
+	assert.Equal(t, event.User, decoded.(PasswordChanged).User)
+	assert.True(t, decoded.(PasswordChanged).Reset)
+	assert.True(t, decoded.EventMetadata().OccurredAt.Equal(event.OccurredAt))
+
+	record.EventType = "user.exploded"
+	_, err = FromOutboxRecord(record)
+	assert.Error(t, err)
+}
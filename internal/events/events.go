@@ -0,0 +1,193 @@
+// Package events defines the domain events published by the services and a
+// bus that delivers them to subscribers.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"learn/internal/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	TypeUserRegistered  = "user.registered"
+	TypeLoginSucceeded  = "login.succeeded"
+	TypeLoginFailed     = "login.failed"
+	TypeTokenRefreshed  = "token.refreshed"
+	TypeSessionRevoked  = "session.revoked"
+	TypePasswordChanged = "password.changed"
+	TypeUserDeleted     = "user.deleted"
+)
+
+// Reasons a login failed
+const (
+	LoginFailureUnknownUser     = "unknown_user"
+	LoginFailureWrongPassword   = "wrong_password"
+	LoginFailureAccountInactive = "account_inactive"
+	LoginFailurePasswordReset   = "password_reset_required"
+	LoginFailureInternalError   = "internal_error"
+)
+
+// Event is a domain event
+type Event interface {
+	EventType() string
+	// EventMetadata returns the metadata common to every event
+	EventMetadata() Metadata
+}
+
+// Metadata identifies an event and the client that caused it
+type Metadata struct {
+	// ID is unique to the event and kept when it is redelivered, so
+	// subscribers can recognise duplicates
+	ID         string    `json:"id"`
+	OccurredAt time.Time `json:"occurred_at"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// NewMetadata creates metadata for an event caused by a client, if given
+func NewMetadata(client *models.ClientInfo) Metadata {
+	metadata := Metadata{
+		ID:         uuid.New().String(),
+		OccurredAt: time.Now().UTC(),
+	}
+	if client != nil {
+		metadata.IPAddress = client.IPAddress
+		metadata.UserAgent = client.UserAgent
+	}
+	return metadata
+}
+
+// EventMetadata returns the event's metadata
+func (m Metadata) EventMetadata() Metadata {
+	return m
+}
+
+// User identifies the user an event is about
+type User struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// UserOf returns the identifying fields of a user
+func UserOf(user *models.User) User {
+	return User{UserID: user.ID, Username: user.Username, Email: user.Email}
+}
+
+// UserRegistered is published when a new account is created
+type UserRegistered struct {
+	Metadata
+	User
+}
+
+func (UserRegistered) EventType() string { return TypeUserRegistered }
+
+// LoginSucceeded is published when a user logs in and a session starts
+type LoginSucceeded struct {
+	Metadata
+	User
+	SessionID string `json:"session_id"`
+}
+
+func (LoginSucceeded) EventType() string { return TypeLoginSucceeded }
+
+// LoginFailed is published when a login is refused. It accompanies no
+// change and is not stored in the outbox, so only synchronous subscribers
+// receive it.
+type LoginFailed struct {
+	Metadata
+	// Identifier is the username or email the login was attempted with
+	Identifier string `json:"identifier"`
+	// UserID is empty if the identifier does not name an account
+	UserID string `json:"user_id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (LoginFailed) EventType() string { return TypeLoginFailed }
+
+// TokenRefreshed is published when a session's refresh token is rotated
+type TokenRefreshed struct {
+	Metadata
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+}
+
+func (TokenRefreshed) EventType() string { return TypeTokenRefreshed }
+
+// SessionRevoked is published when a user logs out or revokes sessions
+type SessionRevoked struct {
+	Metadata
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	// Others is set when every session but SessionID was revoked, or every
+	// session if SessionID is empty
+	Others bool `json:"others,omitempty"`
+}
+
+func (SessionRevoked) EventType() string { return TypeSessionRevoked }
+
+// PasswordChanged is published when a password is changed or reset. The
+// user's sessions have been revoked.
+type PasswordChanged struct {
+	Metadata
+	User
+	// Reset is set when the password was reset with an emailed token
+	Reset bool `json:"reset,omitempty"`
+}
+
+func (PasswordChanged) EventType() string { return TypePasswordChanged }
+
+// UserDeleted is published when an administrator deletes an account
+type UserDeleted struct {
+	Metadata
+	User
+}
+
+func (UserDeleted) EventType() string { return TypeUserDeleted }
+
+// decoders decode the payload of each event type
+var decoders = map[string]func(payload []byte) (Event, error){
+	TypeUserRegistered:  decode[UserRegistered],
+	TypeLoginSucceeded:  decode[LoginSucceeded],
+	TypeLoginFailed:     decode[LoginFailed],
+	TypeTokenRefreshed:  decode[TokenRefreshed],
+	TypeSessionRevoked:  decode[SessionRevoked],
+	TypePasswordChanged: decode[PasswordChanged],
+	TypeUserDeleted:     decode[UserDeleted],
+}
+
+func decode[E Event](payload []byte) (Event, error) {
+	var event E
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// NewOutboxRecord encodes an event for storage in the outbox
+func NewOutboxRecord(event Event) (*models.OutboxRecord, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	metadata := event.EventMetadata()
+	return &models.OutboxRecord{
+		ID:        metadata.ID,
+		EventType: event.EventType(),
+		Payload:   payload,
+		CreatedAt: metadata.OccurredAt,
+	}, nil
+}
+
+// FromOutboxRecord decodes an event stored in the outbox
+func FromOutboxRecord(record *models.OutboxRecord) (Event, error) {
+	decoder, ok := decoders[record.EventType]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type %q", record.EventType)
+	}
+	return decoder(record.Payload)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"learn/internal/audit"
+	"learn/internal/middleware"
+	"learn/internal/models"
+	"learn/internal/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessTokenHandler handles personal access token HTTP requests
+type AccessTokenHandler struct {
+	accessTokenService *service.AccessTokenService
+	auditLog           audit.Logger
+}
+
+// NewAccessTokenHandler creates a new personal access token handler
+func NewAccessTokenHandler(accessTokenService *service.AccessTokenService, auditLog audit.Logger) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		accessTokenService: accessTokenService,
+		auditLog:           auditLog,
+	}
+}
+
+// CreateToken handles minting a personal access token
+// @Summary Create a personal access token
+// @Description Mint a named, long-lived token for scripts and automation with the chosen scopes and optional expiry. The token is only returned in this response.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param token body models.AccessTokenCreation true "Access Token"
+// @Success 201 {object} models.CreatedAccessToken "Token created"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Not allowed with a personal access token"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /user/tokens [post]
+func (h *AccessTokenHandler) CreateToken(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req models.AccessTokenCreation
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.accessTokenService.Create(c.Request.Context(), userID, &req)
+	targetID := ""
+	if token != nil {
+		targetID = token.ID
+	}
+	audit.Write(h.auditLog, audit.NewEvent(actor(c), audit.ActionCreateAccessToken, targetID, err))
+	if err != nil {
+		if err == service.ErrInvalidScope {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Invalid scope",
+				"scopes": models.AccessTokenScopes,
+			})
+			return
+		}
+		respondInternalError(c, "Failed to create token", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// ListTokens handles listing the user's personal access tokens
+// @Summary List personal access tokens
+// @Description List the authenticated user's personal access tokens, newest first. Token values are never returned.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.PersonalAccessToken "Personal access tokens"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Not allowed with a personal access token"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /user/tokens [get]
+func (h *AccessTokenHandler) ListTokens(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	tokens, err := h.accessTokenService.List(c.Request.Context(), userID)
+	if err != nil {
+		respondInternalError(c, "Failed to list tokens", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeToken handles revoking one of the user's personal access tokens
+// @Summary Revoke a personal access token
+// @Description Revoke one of the authenticated user's personal access tokens
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Token ID"
+// @Success 200 {object} map[string]interface{} "Token revoked"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Not allowed with a personal access token"
+// @Failure 404 {object} map[string]interface{} "Token not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /user/tokens/{id} [delete]
+func (h *AccessTokenHandler) RevokeToken(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	err := h.accessTokenService.Revoke(c.Request.Context(), userID, c.Param("id"))
+	audit.Write(h.auditLog, audit.NewEvent(actor(c), audit.ActionRevokeAccessToken, c.Param("id"), err))
+	if err != nil {
+		if err == service.ErrAccessTokenNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return
+		}
+		respondInternalError(c, "Failed to revoke token", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// RegisterRoutes registers the personal access token routes. Tokens can
+// only be managed from an interactive session, so a leaked token cannot be
+// used to mint more.
+func (h *AccessTokenHandler) RegisterRoutes(router *gin.Engine, middlewares ...gin.HandlerFunc) {
+	tokens := router.Group("/user/tokens")
+	tokens.Use(middlewares...)
+	tokens.Use(middleware.RequireSession())
+	{
+		tokens.POST("", h.CreateToken)
+		tokens.GET("", h.ListTokens)
+		tokens.DELETE("/:id", h.RevokeToken)
+	}
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"io"
+	"learn/internal/audit"
+	"learn/internal/middleware"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler handles administrative HTTP requests
+type AdminHandler struct {
+	adminService *service.AdminService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+	}
+}
+
+// ListUsers handles listing users
+// @Summary List users
+// @Description List users, oldest first, optionally filtered by a username or email substring, role and account status
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Username or email substring"
+// @Param role query string false "Role" Enums(user, admin)
+// @Param status query string false "Account status" Enums(active, suspended, disabled, pending_verification)
+// @Param page query int false "Page number, starting at 1" default(1)
+// @Param per_page query int false "Users per page, at most 100" default(20)
+// @Success 200 {object} models.UserPage "Users"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users [get]
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	filter := repository.UserFilter{
+		Query:  c.Query("q"),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+	}
+	if filter.Status != "" && !models.ValidStatus(filter.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account status"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a number"})
+		return
+	}
+	perPage, err := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(service.DefaultUsersPerPage)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "per_page must be a number"})
+		return
+	}
+
+	users, err := h.adminService.ListUsers(c.Request.Context(), actor(c), filter, page, perPage)
+	if err != nil {
+		respondInternalError(c, "Failed to list users", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// GetUser handles viewing a user
+// @Summary Get a user
+// @Description Get a user by ID
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.User "User"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users/{id} [get]
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, err := h.adminService.GetUser(c.Request.Context(), actor(c), c.Param("id"))
+	if err != nil {
+		respondAdminError(c, err, "Failed to get user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DisableUser handles disabling a user's account
+// @Summary Disable a user
+// @Description Disable a user's account, log them out everywhere and revoke their personal access tokens
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param disable body models.AccountDisable false "Reason"
+// @Success 200 {object} map[string]interface{} "User disabled"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users/{id}/disable [post]
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	var req models.AccountDisable
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.adminService.DisableUser(c.Request.Context(), actor(c), c.Param("id"), req.Reason); err != nil {
+		respondAdminError(c, err, "Failed to disable user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User disabled"})
+}
+
+// EnableUser handles re-enabling a user's account
+// @Summary Enable a user
+// @Description Make a user's account active again, ending any suspension
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{} "User enabled"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users/{id}/enable [post]
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	if err := h.adminService.EnableUser(c.Request.Context(), actor(c), c.Param("id")); err != nil {
+		respondAdminError(c, err, "Failed to enable user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User enabled"})
+}
+
+// SetStatus handles changing a user's account status
+// @Summary Set account status
+// @Description Set a user's account status with an optional reason. A suspension can be given an end time, after which the account is active again. Accounts that are no longer active are logged out everywhere.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param status body models.AccountStatusChange true "Account Status"
+// @Success 200 {object} map[string]interface{} "Status changed"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users/{id}/status [put]
+func (h *AdminHandler) SetStatus(c *gin.Context) {
+	var req models.AccountStatusChange
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.adminService.SetStatus(c.Request.Context(), actor(c), c.Param("id"), &req); err != nil {
+		respondAdminError(c, err, "Failed to set account status")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account status changed"})
+}
+
+// RequirePasswordReset handles forcing a user to reset their password
+// @Summary Force a password reset
+// @Description Log a user out everywhere and email them a token they must use to reset their password before logging in again
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{} "Password reset required"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users/{id}/password-reset [post]
+func (h *AdminHandler) RequirePasswordReset(c *gin.Context) {
+	if err := h.adminService.RequirePasswordReset(c.Request.Context(), actor(c), c.Param("id")); err != nil {
+		respondAdminError(c, err, "Failed to require password reset")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset required"})
+}
+
+// LogoutUser handles logging a user out of every session
+// @Summary Log a user out
+// @Description Revoke all of a user's sessions
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{} "User logged out"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users/{id}/sessions [delete]
+func (h *AdminHandler) LogoutUser(c *gin.Context) {
+	if err := h.adminService.LogoutUser(c.Request.Context(), actor(c), c.Param("id")); err != nil {
+		respondAdminError(c, err, "Failed to log out user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out"})
+}
+
+// AssignRole handles changing a user's role
+// @Summary Assign a role
+// @Description Change a user's role
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param role body models.RoleAssignment true "Role"
+// @Success 200 {object} map[string]interface{} "Role assigned"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users/{id}/role [put]
+func (h *AdminHandler) AssignRole(c *gin.Context) {
+	var req models.RoleAssignment
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.adminService.AssignRole(c.Request.Context(), actor(c), c.Param("id"), req.Role); err != nil {
+		respondAdminError(c, err, "Failed to assign role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role assigned"})
+}
+
+// DeleteUser handles permanently deleting a user
+// @Summary Delete a user
+// @Description Permanently delete a user along with their sessions and personal access tokens
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} map[string]interface{} "User deleted"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "User not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/users/{id} [delete]
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	if err := h.adminService.DeleteUser(c.Request.Context(), actor(c), c.Param("id")); err != nil {
+		respondAdminError(c, err, "Failed to delete user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// actor describes the authenticated user making the request
+func actor(c *gin.Context) audit.Actor {
+	return audit.Actor{
+		ID:        middleware.GetUserID(c),
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// respondAdminError writes the response for a failed admin action
+func respondAdminError(c *gin.Context, err error, message string) {
+	switch err {
+	case service.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	case service.ErrInvalidRole, service.ErrInvalidStatus, service.ErrSelfAdministration:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondInternalError(c, message, err)
+	}
+}
+
+// RegisterRoutes registers the admin routes. The middlewares must
+// authenticate the request and admit only administrators.
+func (h *AdminHandler) RegisterRoutes(router *gin.Engine, middlewares ...gin.HandlerFunc) {
+	admin := router.Group("/admin")
+	admin.Use(middlewares...)
+	{
+		admin.GET("/users", h.ListUsers)
+		admin.GET("/users/:id", h.GetUser)
+		admin.POST("/users/:id/disable", h.DisableUser)
+		admin.POST("/users/:id/enable", h.EnableUser)
+		admin.PUT("/users/:id/status", h.SetStatus)
+		admin.POST("/users/:id/password-reset", h.RequirePasswordReset)
+		admin.DELETE("/users/:id/sessions", h.LogoutUser)
+		admin.PUT("/users/:id/role", h.AssignRole)
+		admin.DELETE("/users/:id", h.DeleteUser)
+	}
+}
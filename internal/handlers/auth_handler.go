@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"io"
+	"learn/internal/config"
+	"learn/internal/middleware"
 	"learn/internal/models"
+	"learn/internal/policy"
 	"learn/internal/service"
+	"learn/internal/utils"
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,12 +20,14 @@ import (
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
 	authService *service.AuthService
+	cookies     config.CookieConfig
 }
 
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
+func NewAuthHandler(authService *service.AuthService, cookies config.CookieConfig) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
+		cookies:     cookies,
 	}
 }
 
@@ -28,7 +39,8 @@ func NewAuthHandler(authService *service.AuthService) *AuthHandler {
 // @Produce json
 // @Param user body models.UserRegistration true "User Registration"
 // @Success 201 {object} map[string]interface{} "User created"
-// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Success 202 {object} map[string]interface{} "Registration accepted (enumeration-safe mode)"
+// @Failure 400 {object} map[string]interface{} "Bad request or password policy violation"
 // @Failure 409 {object} map[string]interface{} "User already exists"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /auth/register [post]
@@ -39,13 +51,29 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	user, err := h.authService.Register(&req)
+	user, err := h.authService.Register(c.Request.Context(), &req, clientInfo(c, ""))
 	if err != nil {
+		var policyErr *policy.ValidationError
+		if errors.As(err, &policyErr) {
+			respondPasswordPolicyError(c, policyErr)
+			return
+		}
+		if err == utils.ErrInvalidUsername || err == utils.ErrMixedScriptUsername {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err == service.ErrUserExists {
 			c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
+		respondInternalError(c, "Failed to register user", err)
+		return
+	}
+
+	// Respond identically whether or not the account was created, the
+	// outcome is reported to the address owner by email
+	if h.authService.EnumerationSafeRegistration() {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Registration received, please check your email"})
 		return
 	}
 
@@ -58,14 +86,16 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 // Login handles user login
 // @Summary Login a user
-// @Description Login with username and password to get access and refresh tokens
+// @Description Login with username or email and password to get access and refresh tokens. In cookie mode the tokens are set in HttpOnly cookies instead of the response body.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param credentials body models.UserCredentials true "User Credentials"
+// @Param DPoP header string false "DPoP proof, to bind the tokens to the proof's key"
 // @Success 200 {object} map[string]interface{} "Login successful"
 // @Failure 400 {object} map[string]interface{} "Bad request"
 // @Failure 401 {object} map[string]interface{} "Invalid credentials"
+// @Failure 403 {object} map[string]interface{} "Account not active or password reset required"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
@@ -75,90 +105,256 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	tokens, err := h.authService.Login(&req)
+	client := clientInfo(c, req.DeviceName)
+	client.ClientID = req.ClientID
+	tokens, err := h.authService.Login(c.Request.Context(), &req, client)
 	if err != nil {
 		if err == service.ErrInvalidCredentials {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to login"})
+		var statusErr *service.AccountStatusError
+		if errors.As(err, &statusErr) {
+			middleware.RespondAccountStatus(c, statusErr.AccountStatus)
+			return
+		}
+		if err == service.ErrPasswordResetRequired {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required, check your email for a reset token"})
+			return
+		}
+		respondInternalError(c, "Failed to login", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  tokens.AccessToken,
-		"refresh_token": tokens.RefreshToken,
-		"token_type":    "Bearer",
-		"expires_at":    tokens.ExpiresAt,
-	})
+	h.respondTokens(c, tokens)
 }
 
 // RefreshToken handles token refresh
 // @Summary Refresh access token
-// @Description Refresh access token using refresh token
+// @Description Refresh access token using the refresh token from the request body or refresh token cookie
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param refresh body models.RefreshRequest true "Refresh Token"
+// @Param refresh body models.RefreshRequest false "Refresh Token"
+// @Param X-CSRF-Token header string false "CSRF token, required when the refresh token is sent in a cookie"
+// @Param DPoP header string false "DPoP proof, required when the refresh token is bound to a DPoP key"
 // @Success 200 {object} map[string]interface{} "Token refreshed"
 // @Failure 400 {object} map[string]interface{} "Bad request"
 // @Failure 401 {object} map[string]interface{} "Invalid refresh token"
+// @Failure 403 {object} map[string]interface{} "Missing or invalid CSRF token, or account not active"
 // @Router /auth/refresh [post]
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	var req models.RefreshRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	refreshToken, ok := h.bindRefreshToken(c)
+	if !ok {
+		return
+	}
+	if refreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
 		return
 	}
 
-	tokens, err := h.authService.RefreshToken(req.RefreshToken)
+	tokens, err := h.authService.RefreshToken(c.Request.Context(), refreshToken, clientInfo(c, ""))
 	if err != nil {
+		var statusErr *service.AccountStatusError
+		if errors.As(err, &statusErr) {
+			middleware.RespondAccountStatus(c, statusErr.AccountStatus)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token":  tokens.AccessToken,
-		"refresh_token": tokens.RefreshToken,
-		"token_type":    "Bearer",
-		"expires_at":    tokens.ExpiresAt,
-	})
+	h.respondTokens(c, tokens)
 }
 
 // Logout handles user logout
 // @Summary Logout a user
-// @Description Logout a user by invalidating the refresh token
+// @Description Logout a user by invalidating the refresh token. Without a refresh token in the body, the session of the access token from the Authorization header or access token cookie is invalidated.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param logout body models.RefreshRequest true "Refresh Token"
+// @Param logout body models.RefreshRequest false "Refresh Token"
+// @Param X-CSRF-Token header string false "CSRF token, required when authenticating with a cookie"
 // @Success 200 {object} map[string]interface{} "Logout successful"
 // @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Invalid token"
+// @Failure 403 {object} map[string]interface{} "Missing or invalid CSRF token"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /auth/logout [post]
 func (h *AuthHandler) Logout(c *gin.Context) {
-	var req models.RefreshRequest
+	refreshToken, ok := h.bindRefreshToken(c)
+	if !ok {
+		return
+	}
+
+	var err error
+	if refreshToken != "" {
+		err = h.authService.Logout(c.Request.Context(), refreshToken, clientInfo(c, ""))
+	} else if accessToken := accessTokenFromRequest(c); accessToken != "" {
+		err = h.authService.LogoutSession(c.Request.Context(), accessToken, clientInfo(c, ""))
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+		return
+	}
+
+	if err != nil && err != service.ErrSessionNotFound {
+		if err == service.ErrInvalidToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		respondInternalError(c, "Failed to logout", err)
+		return
+	}
+
+	if h.cookies.Enabled {
+		clearTokenCookies(c, h.cookies)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
+}
+
+// ResetPassword handles resetting a password with an emailed reset token
+// @Summary Reset password
+// @Description Choose a new password using the reset token emailed when an administrator required a password reset
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param reset body models.PasswordReset true "Password Reset"
+// @Success 200 {object} map[string]interface{} "Password reset"
+// @Failure 400 {object} map[string]interface{} "Bad request or password policy violation"
+// @Failure 401 {object} map[string]interface{} "Invalid or expired reset token"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /auth/password/reset [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.PasswordReset
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	err := h.authService.Logout(req.RefreshToken)
+	err := h.authService.ResetPassword(c.Request.Context(), &req, clientInfo(c, ""))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		var policyErr *policy.ValidationError
+		if errors.As(err, &policyErr) {
+			respondPasswordPolicyError(c, policyErr)
+			return
+		}
+		if err == service.ErrInvalidToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+		respondInternalError(c, "Failed to reset password", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset, please log in with your new password"})
+}
+
+// respondTokens writes an issued token pair, moving the tokens into
+// cookies when cookie delivery is enabled
+func (h *AuthHandler) respondTokens(c *gin.Context, tokens *models.TokenPair) {
+	body := gin.H{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_at":    tokens.ExpiresAt,
+	}
+
+	if h.cookies.Enabled {
+		if err := setTokenCookies(c, h.cookies, tokens); err != nil {
+			respondInternalError(c, "Failed to issue tokens", err)
+			return
+		}
+		delete(body, "refresh_token")
+		body["refresh_expires_at"] = tokens.RefreshExpiresAt
+		if h.cookies.AccessToken {
+			delete(body, "access_token")
+		}
+	}
+
+	c.JSON(http.StatusOK, body)
+}
+
+// bindRefreshToken reads the refresh token from the request body, falling
+// back to the refresh token cookie. The body may be empty. It writes an
+// error response and returns false if the body is malformed.
+func (h *AuthHandler) bindRefreshToken(c *gin.Context) (string, bool) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+
+	if req.RefreshToken == "" && h.cookies.Enabled {
+		if cookie, err := c.Cookie(middleware.RefreshTokenCookie); err == nil {
+			req.RefreshToken = cookie
+		}
+	}
+	return req.RefreshToken, true
+}
+
+// accessTokenFromRequest reads the bearer or DPoP-bound token from the
+// Authorization header or the access token cookie
+func accessTokenFromRequest(c *gin.Context) string {
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		parts := strings.Split(authHeader, " ")
+		if len(parts) == 2 && (strings.ToLower(parts[0]) == "bearer" || strings.ToLower(parts[0]) == "dpop") {
+			return parts[1]
+		}
+		return ""
+	}
+	cookie, _ := c.Cookie(middleware.AccessTokenCookie)
+	return cookie
+}
+
+// clientInfo describes the client making the request
+func clientInfo(c *gin.Context, deviceName string) *models.ClientInfo {
+	client := &models.ClientInfo{
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+		DeviceName: deviceName,
+	}
+	if identity := middleware.GetClientIdentity(c); identity != nil {
+		client.CertificateThumbprint = identity.Thumbprint
+	}
+	client.KeyThumbprint = middleware.GetDPoPKeyThumbprint(c)
+	return client
+}
+
+// statusClientClosedRequest is recorded for requests abandoned by the
+// client, following nginx
+const statusClientClosedRequest = 499
+
+// respondInternalError logs an unexpected error with the request's context
+// and responds with a 500 and a generic message, keeping the cause from the
+// client. Errors caused by the client disconnecting are not server errors
+// and are only recorded with status 499.
+func respondInternalError(c *gin.Context, message string, err error) {
+	if errors.Is(err, context.Canceled) && c.Request.Context().Err() != nil {
+		c.AbortWithStatus(statusClientClosedRequest)
+		return
+	}
+	slog.ErrorContext(c.Request.Context(), message, "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// respondPasswordPolicyError writes the violations of a rejected password
+func respondPasswordPolicyError(c *gin.Context, err *policy.ValidationError) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet policy",
+		"violations": err.Violations,
+	})
 }
 
-// RegisterRoutes registers the authentication routes
-func (h *AuthHandler) RegisterRoutes(router *gin.Engine) {
+// RegisterRoutes registers the authentication routes. The CSRF middleware
+// guards the routes that act on a cookie-held token, and the DPoP middleware
+// verifies proofs on the routes that issue tokens or act on a session.
+func (h *AuthHandler) RegisterRoutes(router *gin.Engine, csrfMiddleware, dpopMiddleware gin.HandlerFunc) {
 	auth := router.Group("/auth")
 	{
 		auth.POST("/register", h.Register)
-		auth.POST("/login", h.Login)
-		auth.POST("/refresh", h.RefreshToken)
-		auth.POST("/logout", h.Logout)
+		auth.POST("/login", dpopMiddleware, h.Login)
+		auth.POST("/refresh", csrfMiddleware, dpopMiddleware, h.RefreshToken)
+		auth.POST("/logout", csrfMiddleware, dpopMiddleware, h.Logout)
+		auth.POST("/password/reset", h.ResetPassword)
 	}
 }
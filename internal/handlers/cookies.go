@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"learn/internal/config"
+	"learn/internal/middleware"
+	"learn/internal/models"
+	"learn/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Paths the token cookies are scoped to. The refresh token is sent to every
+// /auth route, since both refresh and logout read it.
+const (
+	refreshCookiePath = "/auth"
+	accessCookiePath  = "/"
+)
+
+// setTokenCookies sets the refresh token, and optionally the access token,
+// in HttpOnly cookies along with a fresh readable CSRF token
+func setTokenCookies(c *gin.Context, cfg config.CookieConfig, tokens *models.TokenPair) error {
+	csrfToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	refreshMaxAge := int(tokens.RefreshExpiresAt - now)
+	setCookie(c, cfg, middleware.RefreshTokenCookie, tokens.RefreshToken, refreshCookiePath, refreshMaxAge, true)
+	if cfg.AccessToken {
+		setCookie(c, cfg, middleware.AccessTokenCookie, tokens.AccessToken, accessCookiePath, int(tokens.ExpiresAt-now), true)
+	}
+	// The CSRF cookie must be readable by scripts so they can echo it in
+	// the request header, and lives as long as the session it protects
+	setCookie(c, cfg, middleware.CSRFTokenCookie, csrfToken, accessCookiePath, refreshMaxAge, false)
+	return nil
+}
+
+// clearTokenCookies expires every cookie set by setTokenCookies
+func clearTokenCookies(c *gin.Context, cfg config.CookieConfig) {
+	setCookie(c, cfg, middleware.RefreshTokenCookie, "", refreshCookiePath, -1, true)
+	if cfg.AccessToken {
+		setCookie(c, cfg, middleware.AccessTokenCookie, "", accessCookiePath, -1, true)
+	}
+	setCookie(c, cfg, middleware.CSRFTokenCookie, "", accessCookiePath, -1, false)
+}
+
+// setCookie writes a cookie using the configured security attributes
+func setCookie(c *gin.Context, cfg config.CookieConfig, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   cfg.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSiteMode(cfg.SameSite),
+	})
+}
+
+// sameSiteMode converts the configured SameSite value to its http constant
+func sameSiteMode(value string) http.SameSite {
+	switch value {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"io"
+	"learn/internal/audit"
+	"learn/internal/config"
+	"learn/internal/events"
+	"learn/internal/mailer"
+	"learn/internal/middleware"
+	"learn/internal/models"
+	"learn/internal/policy"
+	"learn/internal/repository"
+	"learn/internal/service"
+	"learn/internal/utils"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cookieValue returns the value of a cookie the jar would send to a URL
+func cookieValue(jar http.CookieJar, u *url.URL, name string) string {
+	for _, cookie := range jar.Cookies(u) {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func TestCookieOnlyLogout(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:             "test-secret-key",
+			AccessTokenTTL:     time.Minute,
+			RefreshTokenTTL:    time.Hour,
+			SessionMaxLifetime: 24 * time.Hour,
+		},
+		Cookie: config.CookieConfig{Enabled: true, SameSite: "strict"},
+	}
+	hasher := utils.NewArgon2idHasher(utils.Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	auditLog, err := audit.NewChain(nil, audit.NewWriterSink(io.Discard))
+	require.NoError(t, err)
+	authService, err := service.NewAuthService(repository.NewInMemoryStore(), hasher, &policy.PasswordPolicy{MinLength: 8}, mailer.NewLogMailer(), auditLog, events.NewBus(), nil, cfg)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewAuthHandler(authService, cfg.Cookie).RegisterRoutes(router, middleware.CSRFMiddleware(), func(c *gin.Context) { c.Next() })
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+	post := func(path, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		serverURL, _ := url.Parse(server.URL)
+		req.Header.Set(middleware.CSRFTokenHeader, cookieValue(jar, serverURL, middleware.CSRFTokenCookie))
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	require.Equal(t, http.StatusCreated, post("/auth/register", `{"username":"alice","email":"alice@example.com","password":"Tr0mb-Kettle-Vixen"}`).StatusCode)
+	require.Equal(t, http.StatusOK, post("/auth/login", `{"identifier":"alice","password":"Tr0mb-Kettle-Vixen"}`).StatusCode)
+
+	// The refresh token cookie is sent to logout as well as refresh
+	logoutURL, _ := url.Parse(server.URL + "/auth/logout")
+	refreshToken := cookieValue(jar, logoutURL, middleware.RefreshTokenCookie)
+	require.NotEmpty(t, refreshToken)
+
+	// Logging out with only the cookie revokes the session and clears it
+	assert.Equal(t, http.StatusOK, post("/auth/logout", "").StatusCode)
+	assert.Empty(t, cookieValue(jar, logoutURL, middleware.RefreshTokenCookie))
+	_, err = authService.RefreshToken(t.Context(), refreshToken, &models.ClientInfo{})
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+}
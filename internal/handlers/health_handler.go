@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"learn/internal/health"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler handles liveness and readiness probes
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+	}
+}
+
+// Liveness handles liveness probes
+// @Summary Liveness probe
+// @Description Report that the process is running. Dependencies are not checked, so a failing database does not get the process restarted.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report "Alive"
+// @Router /healthz [get]
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, health.Report{Status: health.StatusUp})
+}
+
+// Readiness handles readiness probes
+// @Summary Readiness probe
+// @Description Check the server's dependencies and report each check's status, error and duration. Readiness fails while the server is draining for shutdown.
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report "Ready"
+// @Failure 503 {object} health.Report "Not ready or draining"
+// @Router /readyz [get]
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report := h.checker.Ready(c.Request.Context())
+	status := http.StatusOK
+	if report.Status != health.StatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// RegisterRoutes registers the probe routes, which are not authenticated
+func (h *HealthHandler) RegisterRoutes(router *gin.Engine) {
+	router.GET("/healthz", h.Liveness)
+	router.GET("/readyz", h.Readiness)
+}
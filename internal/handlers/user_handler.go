@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"learn/internal/middleware"
+	"learn/internal/models"
+	"learn/internal/policy"
 	"learn/internal/repository"
+	"learn/internal/service"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -10,13 +14,15 @@ import (
 
 // UserHandler handles user-related HTTP requests
 type UserHandler struct {
-	userRepo repository.UserRepository
+	userRepo    repository.UserRepository
+	authService *service.AuthService
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(userRepo repository.UserRepository) *UserHandler {
+func NewUserHandler(userRepo repository.UserRepository, authService *service.AuthService) *UserHandler {
 	return &UserHandler{
-		userRepo: userRepo,
+		userRepo:    userRepo,
+		authService: authService,
 	}
 }
 
@@ -39,13 +45,13 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userRepo.GetByID(userID)
+	user, err := h.userRepo.GetByID(c.Request.Context(), userID)
 	if err != nil {
 		if err == repository.ErrUserNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		respondInternalError(c, "Failed to get user profile", err)
 		return
 	}
 
@@ -56,11 +62,146 @@ func (h *UserHandler) GetProfile(c *gin.Context) {
 	})
 }
 
+// ChangePassword handles changing the user's password
+// @Summary Change password
+// @Description Change the password of the authenticated user and revoke all of their refresh tokens
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param password body models.PasswordChange true "Password Change"
+// @Success 200 {object} map[string]interface{} "Password changed"
+// @Failure 400 {object} map[string]interface{} "Bad request or password policy violation"
+// @Failure 401 {object} map[string]interface{} "Unauthorized or wrong current password"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /user/password [put]
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req models.PasswordChange
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.authService.ChangePassword(c.Request.Context(), userID, &req, clientInfo(c, ""))
+	if err != nil {
+		var policyErr *policy.ValidationError
+		if errors.As(err, &policyErr) {
+			respondPasswordPolicyError(c, policyErr)
+			return
+		}
+		if err == service.ErrInvalidCredentials {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		respondInternalError(c, "Failed to change password", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// ListSessions handles listing the user's active sessions
+// @Summary List sessions
+// @Description List the devices the authenticated user is logged in on, most recently used first
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Session "Active sessions"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /user/sessions [get]
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(c.Request.Context(), userID, middleware.GetSessionID(c))
+	if err != nil {
+		respondInternalError(c, "Failed to list sessions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession handles revoking one of the user's sessions
+// @Summary Revoke a session
+// @Description Log the authenticated user out of one device
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} map[string]interface{} "Session revoked"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "Session not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /user/sessions/{id} [delete]
+func (h *UserHandler) RevokeSession(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	err := h.authService.RevokeSession(c.Request.Context(), userID, c.Param("id"), clientInfo(c, ""))
+	if err != nil {
+		if err == service.ErrSessionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		respondInternalError(c, "Failed to revoke session", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions handles revoking all of the user's other sessions
+// @Summary Revoke other sessions
+// @Description Log the authenticated user out of every device except the current one
+// @Tags user
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Other sessions revoked"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /user/sessions [delete]
+func (h *UserHandler) RevokeOtherSessions(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	err := h.authService.RevokeOtherSessions(c.Request.Context(), userID, middleware.GetSessionID(c), clientInfo(c, ""))
+	if err != nil {
+		respondInternalError(c, "Failed to revoke sessions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked"})
+}
+
 // RegisterRoutes registers the user routes
-func (h *UserHandler) RegisterRoutes(router *gin.Engine, middleware gin.HandlerFunc) {
+func (h *UserHandler) RegisterRoutes(router *gin.Engine, middlewares ...gin.HandlerFunc) {
 	user := router.Group("/user")
-	user.Use(middleware)
+	user.Use(middlewares...)
 	{
-		user.GET("/profile", h.GetProfile)
+		user.GET("/profile", middleware.RequireScope(models.ScopeProfileRead), h.GetProfile)
+		user.PUT("/password", middleware.RequireSession(), h.ChangePassword)
+		user.GET("/sessions", middleware.RequireScope(models.ScopeSessionsRead), h.ListSessions)
+		user.DELETE("/sessions", middleware.RequireScope(models.ScopeSessionsWrite), h.RevokeOtherSessions)
+		user.DELETE("/sessions/:id", middleware.RequireScope(models.ScopeSessionsWrite), h.RevokeSession)
 	}
 }
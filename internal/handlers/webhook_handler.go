@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/service"
+	"learn/internal/webhook"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookHandler handles webhook administration HTTP requests
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// CreateSubscription handles subscribing a URL to events
+// @Summary Create a webhook subscription
+// @Description Subscribe a URL to authentication lifecycle events. Payloads are signed with the returned secret, which is only returned in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param subscription body models.WebhookSubscriptionCreation true "Subscription"
+// @Success 201 {object} models.CreatedWebhookSubscription "Subscription created"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/webhooks [post]
+func (h *WebhookHandler) CreateSubscription(c *gin.Context) {
+	var req models.WebhookSubscriptionCreation
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	subscription, err := h.webhookService.CreateSubscription(actor(c), &req)
+	if err != nil {
+		if err == service.ErrInvalidEventType {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Invalid event type",
+				"events": webhook.EventTypes,
+			})
+			return
+		}
+		respondInternalError(c, "Failed to create webhook subscription", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// ListSubscriptions handles listing webhook subscriptions
+// @Summary List webhook subscriptions
+// @Description List webhook subscriptions, oldest first. Secrets are never returned.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.WebhookSubscription "Subscriptions"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/webhooks [get]
+func (h *WebhookHandler) ListSubscriptions(c *gin.Context) {
+	subscriptions, err := h.webhookService.ListSubscriptions(actor(c))
+	if err != nil {
+		respondInternalError(c, "Failed to list webhook subscriptions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// DeleteSubscription handles removing a webhook subscription
+// @Summary Delete a webhook subscription
+// @Description Stop sending events to a subscription. Deliveries still queued for it are dead-lettered.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} map[string]interface{} "Subscription deleted"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Subscription not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteSubscription(c *gin.Context) {
+	if err := h.webhookService.DeleteSubscription(actor(c), c.Param("id")); err != nil {
+		respondWebhookError(c, err, "Failed to delete webhook subscription")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook subscription deleted"})
+}
+
+// ListDeliveries handles listing webhook deliveries
+// @Summary List webhook deliveries
+// @Description List the most recent webhook deliveries, newest first, optionally filtered by subscription and status
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param subscription_id query string false "Subscription ID"
+// @Param status query string false "Delivery status" Enums(pending, delivered, dead)
+// @Param limit query int false "Maximum number of deliveries, at most 100" default(100)
+// @Success 200 {array} models.WebhookDelivery "Deliveries"
+// @Failure 400 {object} map[string]interface{} "Bad request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/webhooks/deliveries [get]
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	filter := repository.DeliveryFilter{
+		SubscriptionID: c.Query("subscription_id"),
+		Status:         c.Query("status"),
+	}
+	switch filter.Status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery status"})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+			return
+		}
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(actor(c), filter)
+	if err != nil {
+		respondInternalError(c, "Failed to list webhook deliveries", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayDelivery handles sending a webhook delivery again
+// @Summary Replay a webhook delivery
+// @Description Queue a delivery to be sent again as soon as possible with a fresh set of retries, whether it was delivered, is pending or was dead-lettered
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Delivery ID"
+// @Success 200 {object} models.WebhookDelivery "Delivery queued"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Delivery not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/webhooks/deliveries/{id}/replay [post]
+func (h *WebhookHandler) ReplayDelivery(c *gin.Context) {
+	delivery, err := h.webhookService.ReplayDelivery(actor(c), c.Param("id"))
+	if err != nil {
+		respondWebhookError(c, err, "Failed to replay webhook delivery")
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// ReplayDeadDeliveries handles sending a subscription's dead-lettered deliveries again
+// @Summary Replay dead-lettered deliveries
+// @Description Queue every dead-lettered delivery of a subscription to be sent again, e.g. once its receiver is back up
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} map[string]interface{} "Number of deliveries queued"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Forbidden"
+// @Failure 404 {object} map[string]interface{} "Subscription not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /admin/webhooks/{id}/replay [post]
+func (h *WebhookHandler) ReplayDeadDeliveries(c *gin.Context) {
+	replayed, err := h.webhookService.ReplayDeadDeliveries(actor(c), c.Param("id"))
+	if err != nil {
+		respondWebhookError(c, err, "Failed to replay webhook deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed})
+}
+
+// respondWebhookError writes the response for a failed webhook action
+func respondWebhookError(c *gin.Context, err error, message string) {
+	switch err {
+	case service.ErrWebhookNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook subscription not found"})
+	case service.ErrWebhookDeliveryNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook delivery not found"})
+	default:
+		respondInternalError(c, message, err)
+	}
+}
+
+// RegisterRoutes registers the webhook administration routes. The
+// middlewares must authenticate the request and admit only administrators.
+func (h *WebhookHandler) RegisterRoutes(router *gin.Engine, middlewares ...gin.HandlerFunc) {
+	webhooks := router.Group("/admin/webhooks")
+	webhooks.Use(middlewares...)
+	{
+		webhooks.POST("", h.CreateSubscription)
+		webhooks.GET("", h.ListSubscriptions)
+		webhooks.DELETE("/:id", h.DeleteSubscription)
+		webhooks.POST("/:id/replay", h.ReplayDeadDeliveries)
+		webhooks.GET("/deliveries", h.ListDeliveries)
+		webhooks.POST("/deliveries/:id/replay", h.ReplayDelivery)
+	}
+}
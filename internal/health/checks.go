@@ -0,0 +1,57 @@
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"learn/internal/config"
+	"learn/internal/models"
+	"learn/internal/utils"
+	"net/mail"
+	"time"
+)
+
+// SigningKey checks that tokens can be signed with the JWT secret and
+// verified again
+func SigningKey(secret string) Check {
+	return func(ctx context.Context) error {
+		if secret == "" {
+			return errors.New("no signing key is configured")
+		}
+		token, _, err := utils.GenerateJWT("health-check", "health-check", secret, time.Minute)
+		if err != nil {
+			return fmt.Errorf("signing a token: %w", err)
+		}
+		if _, err := utils.ValidateJWT(token, secret, models.TokenTypeAccess); err != nil {
+			return fmt.Errorf("verifying a token: %w", err)
+		}
+		return nil
+	}
+}
+
+// Mailer checks that outgoing mail is configured: a valid sender address
+// and, unless mail is only logged, an SMTP port. The SMTP server is not
+// contacted, so that frequent probes do not open connections to it.
+func Mailer(cfg config.MailConfig) Check {
+	return func(ctx context.Context) error {
+		if _, err := mail.ParseAddress(cfg.From); err != nil {
+			return fmt.Errorf("invalid sender address %q: %w", cfg.From, err)
+		}
+		if cfg.Host != "" && cfg.Port == "" {
+			return errors.New("no SMTP port is configured")
+		}
+		return nil
+	}
+}
+
+// Certificate checks that the TLS certificate being served has not expired,
+// which clients would refuse
+func Certificate(current func() *x509.Certificate) Check {
+	return func(ctx context.Context) error {
+		if cert := current(); time.Now().After(cert.NotAfter) {
+			return fmt.Errorf("certificate expired at %s", cert.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
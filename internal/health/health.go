@@ -0,0 +1,132 @@
+// Package health reports whether the server is alive and ready to serve
+// requests. Readiness depends on registered checks of the server's
+// dependencies, which are run concurrently, each with its own timeout.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of the server and of individual checks
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusDraining = "draining"
+)
+
+// ErrTimeout is reported for a check that did not finish within the timeout
+var ErrTimeout = errors.New("check timed out")
+
+// Check reports whether a dependency is usable, returning an error
+// describing the problem if not. It should give up once ctx is done.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of a single check
+type Result struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of a readiness check. The server is up only if
+// every check is up and it is not draining.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs readiness checks. Once it is draining, the server reports
+// itself as not ready so that load balancers stop sending it new requests
+// while it shuts down.
+type Checker struct {
+	timeout  time.Duration
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+// NewChecker creates a checker that gives each check timeout to complete
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Register adds a readiness check. Checks must be registered before the
+// checker is used.
+func (c *Checker) Register(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes readiness fail from now on
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Ready runs every check concurrently and reports the results. Checks are
+// not run while draining.
+func (c *Checker) Ready(ctx context.Context) Report {
+	if c.Draining() {
+		return Report{Status: StatusDraining}
+	}
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(c.checks))}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := c.run(ctx, check.check)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[check.name] = result
+			if result.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+// run runs a check with the checker's timeout. A check that ignores its
+// context is abandoned when the timeout passes and left to finish in the
+// background.
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = ErrTimeout
+	}
+
+	result := Result{Status: StatusUp, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"learn/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReady(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	// hang ignores its context, so it has to be abandoned
+	hang := func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}
+
+	tests := []struct {
+		name     string
+		checks   map[string]Check
+		status   string
+		expected map[string]Result
+	}{
+		{
+			name:     "All up",
+			checks:   map[string]Check{"store": up, "mailer": up},
+			status:   StatusUp,
+			expected: map[string]Result{"store": {Status: StatusUp}, "mailer": {Status: StatusUp}},
+		},
+		{
+			name:     "One down",
+			checks:   map[string]Check{"store": down, "mailer": up},
+			status:   StatusDown,
+			expected: map[string]Result{"store": {Status: StatusDown, Error: "connection refused"}, "mailer": {Status: StatusUp}},
+		},
+		{
+			name:     "Timed out",
+			checks:   map[string]Check{"store": hang},
+			status:   StatusDown,
+			expected: map[string]Result{"store": {Status: StatusDown, Error: ErrTimeout.Error()}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(50 * time.Millisecond)
+			for name, check := range tt.checks {
+				checker.Register(name, check)
+			}
+
+			start := time.Now()
+			report := checker.Ready(t.Context())
+			assert.Less(t, time.Since(start), 500*time.Millisecond, "checks not bounded by the timeout")
+			assert.Equal(t, tt.status, report.Status)
+			for name := range report.Checks {
+				result := report.Checks[name]
+				result.DurationMS = 0
+				report.Checks[name] = result
+			}
+			assert.Equal(t, tt.expected, report.Checks)
+		})
+	}
+}
+
+func TestReadyRespectsContextDeadline(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Register("store", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	report := checker.Ready(ctx)
+	assert.Equal(t, StatusDown, report.Status)
+	assert.Equal(t, ErrTimeout.Error(), report.Checks["store"].Error)
+}
+
+func TestDrain(t *testing.T) {
+	checker := NewChecker(time.Second)
+	checker.Register("store", func(ctx context.Context) error {
+		t.Error("check run while draining")
+		return nil
+	})
+
+	checker.Drain()
+	assert.True(t, checker.Draining())
+	report := checker.Ready(t.Context())
+	assert.Equal(t, StatusDraining, report.Status)
+	assert.Empty(t, report.Checks)
+}
+
+func TestSigningKey(t *testing.T) {
+	require.NoError(t, SigningKey("secret")(t.Context()))
+	assert.Error(t, SigningKey("")(t.Context()))
+}
+
+func TestMailer(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   config.MailConfig
+		valid bool
+	}{
+		{"Logged", config.MailConfig{From: "no-reply@localhost"}, true},
+		{"SMTP", config.MailConfig{Host: "smtp.example.com", Port: "587", From: "Auth <auth@example.com>"}, true},
+		{"Invalid sender", config.MailConfig{From: "not an address"}, false},
+		{"Missing port", config.MailConfig{Host: "smtp.example.com", From: "auth@example.com"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Mailer(tt.cfg)(t.Context())
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestCertificate(t *testing.T) {
+	cert := &x509.Certificate{NotAfter: time.Now().Add(time.Hour)}
+	current := func() *x509.Certificate { return cert }
+	require.NoError(t, Certificate(current)(t.Context()))
+
+	cert = &x509.Certificate{NotAfter: time.Now().Add(-time.Hour)}
+	assert.ErrorContains(t, Certificate(current)(t.Context()), "certificate expired")
+}
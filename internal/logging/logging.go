@@ -0,0 +1,127 @@
+// Package logging configures structured logging. Log lines are attributed
+// to the request and user they were written for, and secrets and personal
+// data are redacted before they are written.
+package logging
+
+import (
+	"context"
+	"io"
+	"learn/internal/config"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New creates a logger writing to w in the configured format and level
+func New(w io.Writer, cfg config.LogConfig) *slog.Logger {
+	options := &slog.HandlerOptions{
+		Level:       ParseLevel(cfg.Level),
+		ReplaceAttr: Redact,
+	}
+
+	var handler slog.Handler
+	if cfg.Format == "text" {
+		handler = slog.NewTextHandler(w, options)
+	} else {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// ParseLevel returns the level named debug, info, warn or error, defaulting
+// to info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// requestInfo identifies the request a context belongs to. The user ID is
+// only known once the request is authenticated, so it is set later than the
+// request ID and is guarded by a mutex.
+type requestInfo struct {
+	requestID string
+	userID    string
+	mutex     sync.Mutex
+}
+
+type requestInfoKey struct{}
+
+// WithRequestID returns a context for the request with the given ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{requestID: requestID})
+}
+
+// RequestID returns the ID of the request a context belongs to, if any
+func RequestID(ctx context.Context) string {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.requestID
+}
+
+// SetUserID records the authenticated user of the request a context belongs
+// to. It has no effect on a context without a request ID.
+func SetUserID(ctx context.Context, userID string) {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+	info.mutex.Lock()
+	defer info.mutex.Unlock()
+	info.userID = userID
+}
+
+// UserID returns the authenticated user of the request a context belongs
+// to, if any
+func UserID(ctx context.Context) string {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	info.mutex.Lock()
+	defer info.mutex.Unlock()
+	return info.userID
+}
+
+// contextHandler adds the request and user ID of the context to each
+// record, together with the IDs of the trace and span it was logged in, so
+// log lines can be found from a trace
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if requestID := RequestID(ctx); requestID != "" {
+			record.AddAttrs(slog.String("request_id", requestID))
+		}
+		if userID := UserID(ctx); userID != "" {
+			record.AddAttrs(slog.String("user_id", userID))
+		}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			record.AddAttrs(
+				slog.String("trace_id", span.TraceID().String()),
+				slog.String("span_id", span.SpanID().String()),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secret values in log lines
+const Redacted = "[REDACTED]"
+
+// secretKeys are attribute keys, or suffixes of keys, whose values are
+// always secret
+var secretKeys = []string{"password", "token", "secret", "authorization", "cookie", "hmac_key"}
+
+// emailKeys are attribute keys whose values are email addresses
+var emailKeys = []string{"email", "to"}
+
+var (
+	// Secrets that may appear in free text: JWTs, personal access tokens,
+	// webhook secrets and bearer credentials
+	secretPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+|\b(?:pat|whsec)_[A-Za-z0-9_-]+|(?i:bearer)\s+[A-Za-z0-9._~+/=-]+`)
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// Redact is a slog ReplaceAttr function. It replaces the values of secret
+// attributes, masks email addresses and removes tokens from the message and
+// other string values, including errors.
+func Redact(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, secret := range secretKeys {
+		if strings.HasSuffix(key, secret) {
+			return slog.String(attr.Key, Redacted)
+		}
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		value := attr.Value.String()
+		for _, emailKey := range emailKeys {
+			if key == emailKey {
+				return slog.String(attr.Key, MaskEmail(value))
+			}
+		}
+		return slog.String(attr.Key, RedactString(value))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, RedactString(err.Error()))
+		}
+	}
+	return attr
+}
+
+// RedactString removes tokens from text and masks the email addresses in it
+func RedactString(s string) string {
+	s = secretPattern.ReplaceAllString(s, Redacted)
+	return emailPattern.ReplaceAllStringFunc(s, MaskEmail)
+}
+
+// MaskEmail hides all but the first character of an email address's local
+// part, keeping the domain for troubleshooting delivery
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return Redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"fmt"
+	"learn/internal/config"
+	"log/slog"
+	"net/smtp"
+	"strings"
+)
+
+// Message represents an email message
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer defines the interface for sending email
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewMailer creates an SMTP mailer if a host is configured, otherwise a
+// mailer that only logs messages
+func NewMailer(cfg config.MailConfig) Mailer {
+	if cfg.Host == "" {
+		return NewLogMailer()
+	}
+	return NewSMTPMailer(cfg)
+}
+
+// SMTPMailer implements Mailer by sending messages through an SMTP server
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a new SMTP mailer
+func NewSMTPMailer(cfg config.MailConfig) *SMTPMailer {
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%s", cfg.Host, cfg.Port),
+		auth: auth,
+		from: cfg.From,
+	}
+}
+
+// Send sends a plain text message
+func (m *SMTPMailer) Send(msg Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(b.String()))
+}
+
+// LogMailer implements Mailer by logging messages instead of sending them.
+// It is meant for local development.
+type LogMailer struct{}
+
+// NewLogMailer creates a new logging mailer
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+// Send logs the message. The body may hold a password reset token, so it
+// is only logged at debug level.
+func (m *LogMailer) Send(msg Message) error {
+	slog.Info("Mail sent", "to", msg.To, "subject", msg.Subject)
+	slog.Debug("Mail body", "to", msg.To, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"learn/internal/utils"
+	"time"
+)
+
+// Password hashing operations
+const (
+	HashOperationHash   = "hash"
+	HashOperationVerify = "verify"
+)
+
+// hasher is a password hasher recording how long hashing and verification
+// take
+type hasher struct {
+	utils.PasswordHasher
+	metrics *Metrics
+}
+
+// InstrumentHasher returns a password hasher recording the duration of
+// each hash and verification. Verification is attributed to the algorithm
+// of the stored hash, which may differ from the preferred one until the
+// hash is upgraded.
+func (m *Metrics) InstrumentHasher(h utils.PasswordHasher) utils.PasswordHasher {
+	if m == nil {
+		return h
+	}
+	return &hasher{PasswordHasher: h, metrics: m}
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	start := time.Now()
+	encodedHash, err := h.PasswordHasher.Hash(password)
+	h.metrics.ObservePasswordHash(h.Algorithm(), HashOperationHash, time.Since(start))
+	return encodedHash, err
+}
+
+func (h *hasher) Verify(password, encodedHash string) (bool, error) {
+	start := time.Now()
+	match, err := h.PasswordHasher.Verify(password, encodedHash)
+	algorithm, detectErr := utils.DetectAlgorithm(encodedHash)
+	if detectErr != nil {
+		algorithm = "unknown"
+	}
+	h.metrics.ObservePasswordHash(algorithm, HashOperationVerify, time.Since(start))
+	return match, err
+}
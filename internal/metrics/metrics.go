@@ -0,0 +1,155 @@
+// Package metrics exposes Prometheus metrics for authentication operations,
+// request latency, password hashing and the number of users and sessions.
+package metrics
+
+import (
+	"context"
+	"learn/internal/repository"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Outcomes of an authentication operation
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Metrics holds the collectors of the application's metrics. The methods
+// recording observations may be called on a nil *Metrics, which records
+// nothing, so instrumented code does not need to check whether metrics are
+// enabled.
+type Metrics struct {
+	registry             *prometheus.Registry
+	authOperations       *prometheus.CounterVec
+	requestDuration      *prometheus.HistogramVec
+	passwordHashDuration *prometheus.HistogramVec
+	tokenPurgeRuns       *prometheus.CounterVec
+	tokensPurged         prometheus.Counter
+	tokenPurgeLastRun    prometheus.Gauge
+}
+
+// New creates the application's metrics. The number of users and active
+// refresh tokens is read from the store whenever the metrics are scraped.
+func New(store repository.Store) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		authOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_operations_total",
+			Help: "Authentication operations by operation, outcome and failure reason.",
+		}, []string{"operation", "outcome", "reason"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method, route and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		passwordHashDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "auth_password_hash_duration_seconds",
+			Help: "Time taken to hash or verify a password, by algorithm and operation.",
+			// Password hashing is deliberately slow, from a few milliseconds
+			// to seconds depending on the algorithm and its parameters
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"algorithm", "operation"}),
+		tokenPurgeRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "auth_refresh_token_purge_runs_total",
+			Help: "Sweeps of expired refresh tokens, by outcome.",
+		}, []string{"outcome"}),
+		tokensPurged: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "auth_refresh_tokens_purged_total",
+			Help: "Expired refresh tokens purged by the background janitor.",
+		}),
+		tokenPurgeLastRun: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "auth_refresh_token_purge_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful sweep of expired refresh tokens.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.authOperations,
+		m.requestDuration,
+		m.passwordHashDuration,
+		m.tokenPurgeRuns,
+		m.tokensPurged,
+		m.tokenPurgeLastRun,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "auth_users",
+			Help: "Number of user accounts.",
+		}, countFunc("users", store.Users().Count)),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "auth_active_refresh_tokens",
+			Help: "Number of sessions whose refresh token has not expired.",
+		}, countFunc("active refresh tokens", store.Tokens().CountActive)),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// countFunc adapts a repository count to a gauge function. A failed count
+// is logged and reported as NaN rather than as a misleading zero.
+func countFunc(name string, count func(ctx context.Context) (int, error)) func() float64 {
+	return func() float64 {
+		// Gauge functions are not given the context of the scrape
+		n, err := count(context.Background())
+		if err != nil {
+			slog.Error("Failed to count "+name, "error", err)
+			return math.NaN()
+		}
+		return float64(n)
+	}
+}
+
+// Handler returns an HTTP handler serving the metrics in the Prometheus
+// text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// AuthOperation records the outcome of an authentication operation such
+// as a login. The reason is empty for successful operations.
+func (m *Metrics) AuthOperation(operation, outcome, reason string) {
+	if m == nil {
+		return
+	}
+	m.authOperations.WithLabelValues(operation, outcome, reason).Inc()
+}
+
+// ObserveRequest records the latency of an HTTP request. The route is the
+// matched route pattern rather than the path, keeping the number of label
+// values bounded.
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requestDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObservePasswordHash records the time taken to hash or verify a password
+func (m *Metrics) ObservePasswordHash(algorithm, operation string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.passwordHashDuration.WithLabelValues(algorithm, operation).Observe(duration.Seconds())
+}
+
+// ObserveTokenPurge records a sweep of expired refresh tokens that purged
+// the given number of tokens, or failed with err
+func (m *Metrics) ObserveTokenPurge(purged int, err error) {
+	if m == nil {
+		return
+	}
+	m.tokensPurged.Add(float64(purged))
+	if err != nil {
+		m.tokenPurgeRuns.WithLabelValues(OutcomeFailure).Inc()
+		return
+	}
+	m.tokenPurgeRuns.WithLabelValues(OutcomeSuccess).Inc()
+	m.tokenPurgeLastRun.SetToCurrentTime()
+}
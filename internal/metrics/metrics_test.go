@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrape returns the metrics in the Prometheus text format
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := t.Context()
+	store := repository.NewInMemoryStore()
+	now := time.Now()
+	require.NoError(t, store.Users().Create(ctx, &models.User{ID: "1", Username: "alice", Email: "alice@example.com"}))
+	require.NoError(t, store.Tokens().Store(ctx, "token1", &models.Session{ID: "s1", UserID: "1", ExpiresAt: now.Add(time.Hour)}))
+	require.NoError(t, store.Tokens().Store(ctx, "token2", &models.Session{ID: "s2", UserID: "1", ExpiresAt: now.Add(-time.Hour)}))
+
+	m := New(store)
+	m.AuthOperation("login", OutcomeFailure, "invalid_credentials")
+	m.AuthOperation("login", OutcomeFailure, "invalid_credentials")
+	m.ObserveRequest(http.MethodGet, "/user/profile", http.StatusOK, 20*time.Millisecond)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `auth_operations_total{operation="login",outcome="failure",reason="invalid_credentials"} 2`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/user/profile",status="200"} 1`)
+	assert.Contains(t, body, "auth_users 1\n")
+	assert.Contains(t, body, "auth_active_refresh_tokens 1\n")
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestInstrumentHasher(t *testing.T) {
+	m := New(repository.NewInMemoryStore())
+	hasher := m.InstrumentHasher(utils.NewBcryptHasher(4))
+
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	match, err := hasher.Verify("password", hash)
+	require.NoError(t, err)
+	assert.True(t, match)
+	_, _ = hasher.Verify("password", "malformed")
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `auth_password_hash_duration_seconds_count{algorithm="bcrypt",operation="hash"} 1`)
+	assert.Contains(t, body, `auth_password_hash_duration_seconds_count{algorithm="bcrypt",operation="verify"} 1`)
+	assert.Contains(t, body, `auth_password_hash_duration_seconds_count{algorithm="unknown",operation="verify"} 1`)
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	hasher := utils.NewBcryptHasher(4)
+	assert.Same(t, hasher, m.InstrumentHasher(hasher))
+	assert.NotPanics(t, func() {
+		m.AuthOperation("login", OutcomeSuccess, "")
+		m.ObserveRequest(http.MethodGet, "/", http.StatusOK, time.Millisecond)
+		m.ObservePasswordHash("bcrypt", HashOperationHash, time.Millisecond)
+	})
+}
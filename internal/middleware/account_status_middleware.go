@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"learn/internal/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccountStatusLookup retrieves users' account statuses and whether they
+// must reset their password
+type AccountStatusLookup interface {
+	AccountStatus(ctx context.Context, userID string) (status *models.AccountStatus, passwordResetRequired bool, err error)
+}
+
+// AccountStatusMiddleware creates a middleware that rejects requests from
+// accounts that are not active or must reset their password, so that
+// suspending or disabling an account, or requiring a password reset, takes
+// effect before its access tokens expire. It must run after JWTMiddleware.
+func AccountStatusMiddleware(statuses AccountStatusLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status, passwordResetRequired, err := statuses.AccountStatus(c.Request.Context(), GetUserID(c))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		if !status.Active(time.Now()) {
+			RespondAccountStatus(c, *status)
+			c.Abort()
+			return
+		}
+		if passwordResetRequired {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required, check your email for a reset token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RespondAccountStatus writes the status of an account that is not active
+func RespondAccountStatus(c *gin.Context, status models.AccountStatus) {
+	body := gin.H{
+		"error":  "Account " + strings.ReplaceAll(status.Status, "_", " "),
+		"status": status.Status,
+	}
+	if status.StatusReason != "" {
+		body["reason"] = status.StatusReason
+	}
+	if status.StatusUntil != nil {
+		body["until"] = status.StatusUntil
+	}
+	c.JSON(http.StatusForbidden, body)
+}
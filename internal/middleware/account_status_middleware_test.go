@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"learn/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedAccounts is an AccountStatusLookup over a fixed set of users
+type fixedAccounts map[string]models.User
+
+func (a fixedAccounts) AccountStatus(ctx context.Context, userID string) (*models.AccountStatus, bool, error) {
+	user, exists := a[userID]
+	if !exists {
+		return nil, false, errors.New("user not found")
+	}
+	return &user.AccountStatus, user.PasswordResetRequired, nil
+}
+
+func TestAccountStatusMiddleware(t *testing.T) {
+	accounts := fixedAccounts{
+		"active":   {AccountStatus: models.AccountStatus{Status: models.StatusActive}},
+		"disabled": {AccountStatus: models.AccountStatus{Status: models.StatusDisabled}},
+		"reset":    {AccountStatus: models.AccountStatus{Status: models.StatusActive}, PasswordResetRequired: true},
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/user/profile", func(c *gin.Context) {
+		c.Set("user_id", c.Query("user"))
+	}, AccountStatusMiddleware(accounts), func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserID(c))
+	})
+
+	tests := []struct {
+		name   string
+		userID string
+		status int
+	}{
+		{"Active account", "active", http.StatusOK},
+		{"Disabled account", "disabled", http.StatusForbidden},
+		{"Password reset required", "reset", http.StatusForbidden},
+		{"Deleted account", "deleted", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user/profile?user="+tt.userID, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
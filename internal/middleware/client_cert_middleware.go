@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"learn/internal/models"
+	"learn/internal/tlsconfig"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientCertMiddleware creates a middleware exposing the client certificate
+// verified during a mutual TLS handshake to handlers, through
+// GetClientIdentity. Requests over plain HTTP, or from clients that sent no
+// certificate, have no identity.
+func ClientCertMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cert := verifiedClientCert(c); cert != nil {
+			c.Set("client_identity", tlsconfig.Identity(cert))
+		}
+		c.Next()
+	}
+}
+
+// GetClientIdentity gets the identity of the verified client certificate
+// from the context, or nil if the client did not present one
+func GetClientIdentity(c *gin.Context) *models.ClientIdentity {
+	identity, exists := c.Get("client_identity")
+	if !exists {
+		return nil
+	}
+	return identity.(*models.ClientIdentity)
+}
+
+// verifiedClientCert returns the client certificate verified during the
+// TLS handshake, or nil
+func verifiedClientCert(c *gin.Context) *x509.Certificate {
+	if state := c.Request.TLS; state != nil && len(state.VerifiedChains) > 0 {
+		return state.VerifiedChains[0][0]
+	}
+	return nil
+}
+
+// clientCertThumbprint returns the thumbprint of the verified client
+// certificate, or an empty string
+func clientCertThumbprint(c *gin.Context) string {
+	if cert := verifiedClientCert(c); cert != nil {
+		return tlsconfig.Thumbprint(cert)
+	}
+	return ""
+}
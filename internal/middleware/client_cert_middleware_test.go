@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ClientCertMiddleware())
+	router.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, GetClientIdentity(c))
+	})
+
+	cert := &x509.Certificate{
+		Raw:          []byte("certificate"),
+		Subject:      pkix.Name{CommonName: "billing", Organization: []string{"Example"}},
+		Issuer:       pkix.Name{CommonName: "Internal CA"},
+		DNSNames:     []string{"billing.internal"},
+		SerialNumber: big.NewInt(255),
+	}
+
+	t.Run("Verified certificate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"subject":"CN=billing,O=Example"`)
+		assert.Contains(t, w.Body.String(), `"common_name":"billing"`)
+		assert.Contains(t, w.Body.String(), `"issuer":"CN=Internal CA"`)
+		assert.Contains(t, w.Body.String(), `"serial_number":"ff"`)
+		// base64url SHA-256 of "certificate"
+		assert.Contains(t, w.Body.String(), `"thumbprint":"A9Zt0Ig1wco_EozOrNHzGslBYwlrIPRFroQoW8CDLXI"`)
+	})
+
+	t.Run("Certificate that was not verified", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "null", w.Body.String())
+	})
+
+	t.Run("Plain HTTP", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, "null", w.Body.String())
+	})
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CSRFMiddleware())
+	router.Any("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		method        string
+		authorization string
+		cookies       map[string]string
+		header        string
+		expected      int
+	}{
+		{
+			name:     "Safe method",
+			method:   http.MethodGet,
+			cookies:  map[string]string{AccessTokenCookie: "token"},
+			expected: http.StatusOK,
+		},
+		{
+			name:     "No token cookie",
+			method:   http.MethodPost,
+			expected: http.StatusOK,
+		},
+		{
+			name:          "Authorization header",
+			method:        http.MethodPost,
+			authorization: "Bearer token",
+			cookies:       map[string]string{AccessTokenCookie: "token"},
+			expected:      http.StatusOK,
+		},
+		{
+			name:     "Missing CSRF cookie",
+			method:   http.MethodPost,
+			cookies:  map[string]string{RefreshTokenCookie: "token"},
+			header:   "csrf",
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Missing CSRF header",
+			method:   http.MethodDelete,
+			cookies:  map[string]string{AccessTokenCookie: "token", CSRFTokenCookie: "csrf"},
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Mismatched CSRF header",
+			method:   http.MethodPost,
+			cookies:  map[string]string{RefreshTokenCookie: "token", CSRFTokenCookie: "csrf"},
+			header:   "other",
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "Matching CSRF header",
+			method:   http.MethodPut,
+			cookies:  map[string]string{AccessTokenCookie: "token", CSRFTokenCookie: "csrf"},
+			header:   "csrf",
+			expected: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			for name, value := range tt.cookies {
+				req.AddCookie(&http.Cookie{Name: name, Value: value})
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFTokenHeader, tt.header)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"learn/internal/dpop"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DPoPHeader carries a DPoP proof
+const DPoPHeader = "DPoP"
+
+// DPoPMiddleware creates a middleware for the endpoints that issue, refresh
+// or end sessions, verifying the DPoP proof sent with a request, if any.
+// The proof must name the request's method and URL and, when an access
+// token is sent with the DPoP authorization scheme, hash the token. The
+// thumbprint of the proof's key is exposed through GetDPoPKeyThumbprint,
+// for tokens to be bound to it when they are issued and for JWTMiddleware
+// to check the binding when they are used. A public URL, if given, replaces
+// the scheme and host of the request in the URL that proofs are checked
+// against.
+func DPoPMiddleware(verifier *dpop.Verifier, publicURL string) gin.HandlerFunc {
+	return dpopMiddleware(verifier, publicURL, true)
+}
+
+// DPoPSchemeMiddleware creates a middleware for protected routes, verifying
+// proofs as DPoPMiddleware does but only for requests that present their
+// access token with the DPoP authorization scheme. Proofs sent with other
+// requests are ignored, so they do not use up the verifier's replay cache.
+// It must run before JWTMiddleware.
+func DPoPSchemeMiddleware(verifier *dpop.Verifier, publicURL string) gin.HandlerFunc {
+	return dpopMiddleware(verifier, publicURL, false)
+}
+
+// dpopMiddleware verifies the proof of a request using the DPoP scheme,
+// and of any other request if anyScheme is set
+func dpopMiddleware(verifier *dpop.Verifier, publicURL string, anyScheme bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, scheme := authorization(c)
+		if scheme != "dpop" && !anyScheme {
+			c.Next()
+			return
+		}
+		proofs := c.Request.Header.Values(DPoPHeader)
+		if len(proofs) == 0 {
+			if scheme == "dpop" {
+				rejectDPoP(c, scheme, "DPoP proof is required")
+				return
+			}
+			c.Next()
+			return
+		}
+		if len(proofs) > 1 {
+			rejectDPoP(c, scheme, "Only one DPoP proof may be sent")
+			return
+		}
+
+		var accessToken string
+		if scheme == "dpop" {
+			accessToken = token
+		}
+		proof, err := verifier.Verify(proofs[0], c.Request.Method, requestURL(c, publicURL), accessToken, c.ClientIP())
+		if err != nil {
+			rejectDPoP(c, scheme, "Invalid DPoP proof")
+			return
+		}
+
+		c.Set("dpop_key_thumbprint", proof.KeyThumbprint)
+		c.Next()
+	}
+}
+
+// GetDPoPKeyThumbprint gets the JWK thumbprint of the key that signed the
+// request's DPoP proof from the context, or an empty string if there was no
+// proof
+func GetDPoPKeyThumbprint(c *gin.Context) string {
+	thumbprint, exists := c.Get("dpop_key_thumbprint")
+	if !exists {
+		return ""
+	}
+	return thumbprint.(string)
+}
+
+// rejectDPoP responds to a request with a missing or invalid proof: with
+// 401 and a challenge for a protected resource, with 400 when tokens are
+// being requested
+func rejectDPoP(c *gin.Context, scheme, message string) {
+	status := http.StatusBadRequest
+	if scheme == "dpop" {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `DPoP error="invalid_dpop_proof"`)
+	}
+	c.JSON(status, gin.H{"error": message})
+	c.Abort()
+}
+
+// requestURL returns the URL of a request without its query, as a proof
+// names it
+func requestURL(c *gin.Context, publicURL string) string {
+	if publicURL == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		publicURL = scheme + "://" + c.Request.Host
+	}
+	return strings.TrimSuffix(publicURL, "/") + c.Request.URL.EscapedPath()
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"learn/internal/config"
+	"learn/internal/dpop"
+	"learn/internal/models"
+	"learn/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dpopURL = "https://api.example.com/user/profile"
+
+// signProof signs a DPoP proof for a GET of dpopURL, hashing the access
+// token if one is given
+func signProof(t *testing.T, key *ecdsa.PrivateKey, accessToken string) string {
+	t.Helper()
+	point := make([]byte, 32)
+	claims := jwt.MapClaims{"jti": uuid.New().String(), "htm": http.MethodGet, "htu": dpopURL, "iat": time.Now().Unix()}
+	if accessToken != "" {
+		claims["ath"] = dpop.TokenHash(accessToken)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(point)),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(point)),
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestDPoPMiddleware(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "test-secret"}}
+	gin.SetMode(gin.TestMode)
+	verifier := dpop.NewVerifier(time.Minute)
+	router := gin.New()
+	router.GET("/user/profile", DPoPSchemeMiddleware(verifier, "https://api.example.com"), JWTMiddleware(cfg, nil), func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserID(c))
+	})
+	router.POST("/auth/login", DPoPMiddleware(verifier, "https://api.example.com"), func(c *gin.Context) {
+		c.String(http.StatusOK, GetDPoPKeyThumbprint(c))
+	})
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	proof, err := dpop.NewVerifier(time.Minute).Verify(signProof(t, key, ""), http.MethodGet, dpopURL, "", "192.0.2.1")
+	require.NoError(t, err)
+	bound, _, err := utils.GenerateJWTForClaims(&models.TokenClaims{UserID: "1", Username: "alice", Type: models.TokenTypeAccess, TokenBinding: models.TokenBinding{KeyThumbprint: proof.KeyThumbprint}}, cfg.JWT.Secret, time.Minute)
+	require.NoError(t, err)
+	unbound, _, err := utils.GenerateJWT("1", "alice", cfg.JWT.Secret, time.Minute)
+	require.NoError(t, err)
+
+	replayed := signProof(t, key, bound)
+	tests := []struct {
+		name          string
+		authorization string
+		proofs        []string
+		status        int
+	}{
+		{"Bound token with a proof of its key", "DPoP " + bound, []string{signProof(t, key, bound)}, http.StatusOK},
+		{"Bound token with a replayed proof", "DPoP " + bound, []string{replayed}, http.StatusOK},
+		{"Bound token with a replayed proof again", "DPoP " + bound, []string{replayed}, http.StatusUnauthorized},
+		{"Bound token without a proof", "DPoP " + bound, nil, http.StatusUnauthorized},
+		{"Bound token with the Bearer scheme", "Bearer " + bound, []string{signProof(t, key, "")}, http.StatusUnauthorized},
+		{"Bound token with a proof of another key", "DPoP " + bound, []string{signProof(t, other, bound)}, http.StatusUnauthorized},
+		{"Bound token with a proof hashing another token", "DPoP " + bound, []string{signProof(t, key, unbound)}, http.StatusUnauthorized},
+		{"Bound token with two proofs", "DPoP " + bound, []string{signProof(t, key, bound), signProof(t, key, bound)}, http.StatusUnauthorized},
+		{"Unbound token with the DPoP scheme", "DPoP " + unbound, []string{signProof(t, key, unbound)}, http.StatusUnauthorized},
+		{"Unbound token", "Bearer " + unbound, nil, http.StatusOK},
+		// Proofs are only checked for tokens sent with the DPoP scheme
+		{"Unbound token with an invalid proof", "Bearer " + unbound, []string{"not-a-proof"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+			req.Header.Set("Authorization", tt.authorization)
+			for _, proof := range tt.proofs {
+				req.Header.Add(DPoPHeader, proof)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	t.Run("Challenges a DPoP token sent with an invalid proof", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set("Authorization", "DPoP "+bound)
+		req.Header.Set(DPoPHeader, signProof(t, key, ""))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, `DPoP error="invalid_dpop_proof"`, w.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("Proofs are optional when tokens are requested", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Body.String())
+
+		// A proof for another URL is rejected without an authorization
+		// challenge
+		req = httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		req.Header.Set(DPoPHeader, signProof(t, key, ""))
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Empty(t, w.Header().Get("WWW-Authenticate"))
+	})
+}
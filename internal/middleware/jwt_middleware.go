@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"learn/internal/config"
+	"learn/internal/logging"
+	"learn/internal/models"
 	"learn/internal/utils"
 	"net/http"
 	"strings"
@@ -9,43 +12,110 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// JWTMiddleware creates a middleware for JWT authentication
-func JWTMiddleware(config *config.Config) gin.HandlerFunc {
+// AccessTokenAuthenticator resolves personal access tokens to their owner
+type AccessTokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*models.User, *models.PersonalAccessToken, error)
+}
+
+// JWTMiddleware creates a middleware for JWT authentication. Personal access
+// tokens are also accepted as bearer tokens when an authenticator is given.
+func JWTMiddleware(config *config.Config, accessTokens AccessTokenAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		tokenString, scheme, ok := extractToken(c)
+		if !ok {
 			c.Abort()
 			return
 		}
 
-		// Check if the Authorization header has the correct format
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
-			c.Abort()
+		if accessTokens != nil && utils.IsAccessToken(tokenString) && scheme != "dpop" {
+			user, token, err := accessTokens.Authenticate(c.Request.Context(), tokenString)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", user.ID)
+			logging.SetUserID(c.Request.Context(), user.ID)
+			c.Set("username", user.Username)
+			c.Set("scopes", token.Scopes)
+
+			c.Next()
 			return
 		}
 
-		// Extract the token
-		tokenString := parts[1]
-
 		// Validate the token
-		claims, err := utils.ValidateJWT(tokenString, config.JWT.Secret)
+		claims, err := utils.ValidateJWT(tokenString, config.JWT.Secret, models.TokenTypeAccess)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		// A certificate-bound token is only accepted over mutual TLS with
+		// the certificate it was issued to
+		if claims.CertificateThumbprint != "" && claims.CertificateThumbprint != clientCertThumbprint(c) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token must be presented with the client certificate it was issued to"})
+			c.Abort()
+			return
+		}
+
+		// A token bound to a DPoP key must be sent with the DPoP scheme and a
+		// proof signed by that key, and only bound tokens use the scheme
+		if claims.KeyThumbprint != "" && (scheme != "dpop" || claims.KeyThumbprint != GetDPoPKeyThumbprint(c)) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token must be presented with a DPoP proof of the key it is bound to"})
+			c.Abort()
+			return
+		}
+		if claims.KeyThumbprint == "" && scheme == "dpop" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token is not bound to a DPoP key"})
+			c.Abort()
+			return
+		}
+
 		// Set the user ID and username in the context
 		c.Set("user_id", claims.UserID)
+		logging.SetUserID(c.Request.Context(), claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("session_id", claims.SessionID)
 
 		c.Next()
 	}
 }
 
+// extractToken gets the access token and its lower case authorization
+// scheme, "bearer" or "dpop", from the Authorization header, or from the
+// access token cookie if there is no header. It writes an error response
+// and returns false if no well-formed token is present.
+func extractToken(c *gin.Context) (string, string, bool) {
+	if c.GetHeader("Authorization") == "" {
+		if cookie, err := c.Cookie(AccessTokenCookie); err == nil && cookie != "" {
+			return cookie, "bearer", true
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		return "", "", false
+	}
+
+	// Check if the Authorization header has the correct format
+	token, scheme := authorization(c)
+	if scheme != "bearer" && scheme != "dpop" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token} or DPoP {token}"})
+		return "", "", false
+	}
+
+	return token, scheme, true
+}
+
+// authorization splits the Authorization header into its token and lower
+// case scheme, returning empty strings if it is missing or malformed
+func authorization(c *gin.Context) (string, string) {
+	parts := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[1], strings.ToLower(parts[0])
+}
+
 // GetUserID gets the user ID from the context
 func GetUserID(c *gin.Context) string {
 	userID, exists := c.Get("user_id")
@@ -62,4 +132,60 @@ func GetUsername(c *gin.Context) string {
 		return ""
 	}
 	return username.(string)
-}
\ No newline at end of file
+}
+
+// GetSessionID gets the session ID from the context
+func GetSessionID(c *gin.Context) string {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		return ""
+	}
+	return sessionID.(string)
+}
+
+// GetScopes gets the scopes granted to the request's personal access token.
+// It returns nil for requests authenticated with a session JWT, which are
+// not restricted by scope.
+func GetScopes(c *gin.Context) []string {
+	scopes, exists := c.Get("scopes")
+	if !exists {
+		return nil
+	}
+	return scopes.([]string)
+}
+
+// RequireScope creates a middleware that rejects personal access tokens
+// that have not been granted a scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAccessToken := c.Get("scopes"); isAccessToken && !hasScope(GetScopes(c), scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing required scope " + scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession creates a middleware that rejects personal access tokens,
+// for routes that must only be used by an interactively logged-in user
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAccessToken := c.Get("scopes"); isAccessToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action cannot be performed with a personal access token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// hasScope reports whether scopes contains scope
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
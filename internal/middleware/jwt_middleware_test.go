@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"learn/internal/config"
+	"learn/internal/models"
+	"learn/internal/tlsconfig"
+	"learn/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTMiddlewareCertificateBinding(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "test-secret"}}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(JWTMiddleware(cfg, nil))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserID(c))
+	})
+
+	cert := &x509.Certificate{Raw: []byte("certificate")}
+	other := &x509.Certificate{Raw: []byte("other certificate")}
+	bound, _, err := utils.GenerateJWTForClaims(&models.TokenClaims{UserID: "1", Username: "alice", Type: models.TokenTypeAccess, TokenBinding: models.TokenBinding{CertificateThumbprint: tlsconfig.Thumbprint(cert)}}, cfg.JWT.Secret, time.Minute)
+	require.NoError(t, err)
+	unbound, _, err := utils.GenerateJWT("1", "alice", cfg.JWT.Secret, time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		token  string
+		tls    *tls.ConnectionState
+		status int
+	}{
+		{"Bound token with its certificate", bound, &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, http.StatusOK},
+		{"Bound token without TLS", bound, nil, http.StatusUnauthorized},
+		{"Bound token without a client certificate", bound, &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"Bound token with another certificate", bound, &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{other}}}, http.StatusUnauthorized},
+		{"Bound token with an unverified certificate", bound, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, http.StatusUnauthorized},
+		{"Unbound token with a certificate", unbound, &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{other}}}, http.StatusOK},
+		{"Unbound token without TLS", unbound, nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			req.TLS = tt.tls
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"learn/internal/metrics"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware creates a middleware recording the latency of each
+// request by method, route and status
+func MetricsMiddleware(m *metrics.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			// Unmatched paths are grouped so that scanners cannot create
+			// an unbounded number of series
+			route = "unmatched"
+		}
+		m.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
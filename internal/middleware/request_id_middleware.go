@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"learn/internal/logging"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID that correlates a request's log lines
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs accepted from clients, keeping
+// arbitrary text out of the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware creates a middleware assigning each request an ID. An
+// ID sent by the client or a proxy in the X-Request-ID header is kept so a
+// request can be traced across services; otherwise one is generated. The ID
+// is echoed in the response and added to every line logged with the
+// request's context.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Next()
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"learn/internal/logging"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, logging.RequestID(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{name: "Client ID kept", header: "abc-123.def:4_5", expected: "abc-123.def:4_5"},
+		{name: "Missing ID generated", header: ""},
+		{name: "Invalid characters replaced", header: "bad id\nwith newline"},
+		{name: "Overlong ID replaced", header: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			assert.Equal(t, requestID, w.Body.String(), "context and response IDs differ")
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, requestID)
+			} else {
+				assert.NoError(t, uuid.Validate(requestID))
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"learn/internal/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserLookup retrieves users by ID
+type UserLookup interface {
+	GetByID(ctx context.Context, id string) (*models.User, error)
+}
+
+// RequireRole creates a middleware that only admits users with a role. The
+// role is looked up on every request rather than carried in the token, so
+// that revoking it takes effect immediately. It must run after JWTMiddleware.
+func RequireRole(users UserLookup, role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := users.GetByID(c.Request.Context(), GetUserID(c))
+		if err != nil || user.Role != role || !user.Active(time.Now()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionLookup reports whether sessions are still active
+type SessionLookup interface {
+	SessionActive(ctx context.Context, sessionID string) (bool, error)
+}
+
+// SessionMiddleware creates a middleware that rejects access tokens whose
+// session has been logged out, revoked or has expired, so that ending a
+// session takes effect before its access tokens expire. Personal access
+// tokens, which have no session, are let through. It must run after
+// JWTMiddleware.
+func SessionMiddleware(sessions SessionLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAccessToken := c.Get("scopes"); isAccessToken {
+			c.Next()
+			return
+		}
+
+		sessionID := GetSessionID(c)
+		if sessionID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		active, err := sessions.SessionActive(c.Request.Context(), sessionID)
+		if err != nil || !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
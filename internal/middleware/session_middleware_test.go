@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"learn/internal/config"
+	"learn/internal/models"
+	"learn/internal/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// activeSessions is a SessionLookup over a fixed set of sessions
+type activeSessions map[string]bool
+
+func (s activeSessions) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	return s[sessionID], nil
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	cfg := &config.Config{JWT: config.JWTConfig{Secret: "test-secret"}}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/user/profile", JWTMiddleware(cfg, nil), SessionMiddleware(activeSessions{"s1": true}), func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserID(c))
+	})
+
+	tokens, err := utils.GenerateTokenPairForClaims(&models.TokenClaims{UserID: "1", Username: "alice", SessionID: "s1"}, cfg.JWT.Secret, time.Minute, time.Hour)
+	require.NoError(t, err)
+	revoked, err := utils.GenerateTokenPairForClaims(&models.TokenClaims{UserID: "1", Username: "alice", SessionID: "s2"}, cfg.JWT.Secret, time.Minute, time.Hour)
+	require.NoError(t, err)
+	sessionless, _, err := utils.GenerateJWT("1", "alice", cfg.JWT.Secret, time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"Access token", tokens.AccessToken, http.StatusOK},
+		{"Refresh token", tokens.RefreshToken, http.StatusUnauthorized},
+		{"Access token of a revoked session", revoked.AccessToken, http.StatusUnauthorized},
+		{"Access token without a session", sessionless, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TracingMiddleware())
+	router.GET("/users/:id", func(c *gin.Context) {
+		c.String(http.StatusOK, trace.SpanContextFromContext(c.Request.Context()).TraceID().String())
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+
+	t.Run("Continues the caller's trace", func(t *testing.T) {
+		exporter.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Body.String())
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.Equal(t, "GET /users/:id", spans[0].Name)
+		assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+		assert.Contains(t, spans[0].Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+		assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	})
+
+	t.Run("Server errors fail the span", func(t *testing.T) {
+		exporter.Reset()
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+		spans := exporter.GetSpans()
+		require.Len(t, spans, 1)
+		assert.False(t, spans[0].Parent.IsValid())
+		assert.Equal(t, codes.Error, spans[0].Status.Code)
+	})
+}
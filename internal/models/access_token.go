@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+)
+
+// Scopes that can be granted to a personal access token
+const (
+	ScopeProfileRead   = "profile:read"
+	ScopeSessionsRead  = "sessions:read"
+	ScopeSessionsWrite = "sessions:write"
+)
+
+// AccessTokenScopes lists every scope a personal access token can be granted
+var AccessTokenScopes = []string{
+	ScopeProfileRead,
+	ScopeSessionsRead,
+	ScopeSessionsWrite,
+}
+
+// PersonalAccessToken represents a long-lived token a user mints for scripts
+// and automation. Only a hash of the token is stored; the token itself is
+// shown once, when it is created.
+type PersonalAccessToken struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Leading characters of the token, to help users recognise it
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // Nil if the token never expires
+}
+
+// Expired reports whether the token has expired at the given time
+func (t *PersonalAccessToken) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// AccessTokenCreation represents a request to mint a personal access token
+type AccessTokenCreation struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// ExpiresInDays is the token lifetime in days, or 0 for no expiry
+	ExpiresInDays int `json:"expires_in_days" binding:"min=0"`
+}
+
+// CreatedAccessToken is returned once when a personal access token is minted
+type CreatedAccessToken struct {
+	PersonalAccessToken
+	Token string `json:"token"`
+}
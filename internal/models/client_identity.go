@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// ClientIdentity describes the client certificate verified during a mutual
+// TLS handshake
+type ClientIdentity struct {
+	Subject        string    `json:"subject"`
+	CommonName     string    `json:"common_name"`
+	DNSNames       []string  `json:"dns_names,omitempty"`
+	URIs           []string  `json:"uris,omitempty"`
+	EmailAddresses []string  `json:"email_addresses,omitempty"`
+	Issuer         string    `json:"issuer"`
+	SerialNumber   string    `json:"serial_number"`
+	NotAfter       time.Time `json:"not_after"`
+	// Thumbprint is the base64url-encoded SHA-256 hash of the certificate
+	Thumbprint string `json:"thumbprint"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboxRecord is a domain event stored in the same transaction as the
+// change it describes, so that asynchronous subscribers receive every
+// committed event even if the process stops right after the commit.
+type OutboxRecord struct {
+	ID        string
+	EventType string
+	Payload   []byte
+	CreatedAt time.Time
+	// Attempts counts failed dispatches. A failed record is retried from
+	// NextAttemptAt, or at once if it is zero, until it runs out of
+	// attempts and is dead-lettered.
+	Attempts      int
+	NextAttemptAt time.Time
+	// LastError describes why the last dispatch failed
+	LastError string
+	// Handled names the subscribers that have already handled the event,
+	// so that a retry only runs the ones that failed
+	Handled []string
+	// DeadAt is set once the record is dead-lettered. Dead records are kept
+	// for inspection but no longer dispatched.
+	DeadAt *time.Time
+}
+
+// Due reports whether a record should be dispatched at the given time
+func (r *OutboxRecord) Due(now time.Time) bool {
+	return r.DeadAt == nil && !r.NextAttemptAt.After(now)
+}
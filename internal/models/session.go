@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+// Session represents a login on one device. A session outlives the
+// individual refresh tokens issued to it, which are rotated on every refresh.
+// Each refresh extends the session by its idle timeout, but never past its
+// absolute expiration.
+type Session struct {
+	ID                string        `json:"id"`
+	UserID            string        `json:"-"`
+	ClientID          string        `json:"client_id,omitempty"`
+	Name              string        `json:"name"` // Friendly device name
+	UserAgent         string        `json:"user_agent"`
+	IPAddress         string        `json:"ip_address"`
+	CreatedAt         time.Time     `json:"created_at"`
+	LastUsedAt        time.Time     `json:"last_used_at"`
+	ExpiresAt         time.Time     `json:"expires_at"` // Expiration of the current refresh token
+	IdleTimeout       time.Duration `json:"-"`
+	AbsoluteExpiresAt time.Time     `json:"absolute_expires_at"`
+	Current           bool          `json:"current"` // Whether this is the session making the request
+}
+
+// NextExpiry returns when the session expires if it is used at the given time
+func (s *Session) NextExpiry(now time.Time) time.Time {
+	expiresAt := now.Add(s.IdleTimeout)
+	if expiresAt.After(s.AbsoluteExpiresAt) {
+		return s.AbsoluteExpiresAt
+	}
+	return expiresAt
+}
+
+// ClientInfo describes the client a request was made from
+type ClientInfo struct {
+	UserAgent  string
+	IPAddress  string
+	DeviceName string // Optional name chosen by the user
+	ClientID   string // Optional client application identifier
+	// TokenBinding holds the keys the client proved it holds: the client
+	// certificate verified over mutual TLS and the key of a DPoP proof
+	TokenBinding
+}
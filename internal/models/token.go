@@ -9,17 +9,46 @@ type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresAt    int64  `json:"expires_at"` // Unix timestamp for access token expiration
+	// RefreshExpiresAt is the Unix timestamp for refresh token expiration
+	RefreshExpiresAt int64 `json:"refresh_expires_at"`
+	// TokenType is "DPoP" for tokens bound to a DPoP key, which must be sent
+	// with that authorization scheme, and "Bearer" otherwise
+	TokenType string `json:"token_type"`
 }
 
+// Types of JWT, carried in the typ claim so that a refresh token cannot be
+// used as an access token or the other way round
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 // TokenClaims represents the claims in a JWT token
 type TokenClaims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"`
+	// Type is TokenTypeAccess or TokenTypeRefresh
+	Type string `json:"typ"`
+	// TokenBinding is carried in the cnf (confirmation) claim
+	TokenBinding `json:"-"`
+}
+
+// TokenBinding ties a token to a key that whoever presents the token must
+// prove they hold. Empty fields do not constrain the token.
+type TokenBinding struct {
+	// CertificateThumbprint is the SHA-256 thumbprint of a client
+	// certificate used over mutual TLS (cnf.x5t#S256, RFC 8705)
+	CertificateThumbprint string
+	// KeyThumbprint is the JWK SHA-256 thumbprint of the key signing DPoP
+	// proofs (cnf.jkt, RFC 9449)
+	KeyThumbprint string
 }
 
 // RefreshRequest represents a request to refresh an access token
+// The refresh token may be omitted when it is sent in a cookie.
 type RefreshRequest struct {
-	RefreshToken string `json:"refresh_token" binding:"required"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 // TokenResponse represents the response for token operations
@@ -28,4 +57,4 @@ type TokenResponse struct {
 	RefreshToken string    `json:"refresh_token"`
 	TokenType    string    `json:"token_type"`
 	ExpiresAt    time.Time `json:"expires_at"`
-}
\ No newline at end of file
+}
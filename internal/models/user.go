@@ -4,25 +4,142 @@ import (
 	"time"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account statuses
+const (
+	StatusActive              = "active"
+	StatusSuspended           = "suspended"
+	StatusDisabled            = "disabled"
+	StatusPendingVerification = "pending_verification"
+)
+
+// AccountStatus describes whether an account may be used
+type AccountStatus struct {
+	Status string `json:"status"`
+	// StatusReason explains a status other than active
+	StatusReason string `json:"status_reason,omitempty"`
+	// StatusUntil is when a suspension ends, or nil if it is indefinite
+	StatusUntil *time.Time `json:"status_until,omitempty"`
+}
+
+// ValidStatus reports whether status is a known account status
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusActive, StatusSuspended, StatusDisabled, StatusPendingVerification:
+		return true
+	}
+	return false
+}
+
+// EffectiveStatus returns the account status at the given time. A
+// suspension whose end has passed is active again, as is an unset status.
+func (s AccountStatus) EffectiveStatus(now time.Time) string {
+	if s.Status == "" {
+		return StatusActive
+	}
+	if s.Status == StatusSuspended && s.StatusUntil != nil && !now.Before(*s.StatusUntil) {
+		return StatusActive
+	}
+	return s.Status
+}
+
+// Active reports whether the account may be used at the given time
+func (s AccountStatus) Active(now time.Time) bool {
+	return s.EffectiveStatus(now) == StatusActive
+}
+
 // User represents a user in the system
 type User struct {
-	ID           string    `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"` // Never expose password hash
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	PasswordHash string `json:"-"` // Never expose password hash
+	// Only active accounts can log in, refresh tokens or make requests
+	AccountStatus
+	// PasswordResetRequired is set when an administrator forces a password
+	// reset; the account cannot log in until the password is reset
+	PasswordResetRequired  bool      `json:"password_reset_required"`
+	PasswordResetTokenHash string    `json:"-"`
+	PasswordResetExpiresAt time.Time `json:"-"`
+	CreatedAt              time.Time `json:"created_at"`
+	UpdatedAt              time.Time `json:"updated_at"`
+}
+
+// ValidRole reports whether role is a known user role
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
 }
 
 // UserCredentials represents user credentials for login
 type UserCredentials struct {
-	Username string `json:"username" binding:"required"`
+	// Identifier is the username or email address of the account
+	Identifier string `json:"identifier" binding:"required_without=Username"`
+	// Username is accepted in place of Identifier for older clients
+	Username string `json:"username" binding:"required_without=Identifier"`
 	Password string `json:"password" binding:"required"`
+	// DeviceName optionally names the session, defaults to one derived from the user agent
+	DeviceName string `json:"device_name" binding:"max=100"`
+	// ClientID optionally identifies the client application, e.g. "web" or "mobile"
+	ClientID string `json:"client_id" binding:"max=100"`
+}
+
+// LoginIdentifier returns the username or email the credentials refer to
+func (c *UserCredentials) LoginIdentifier() string {
+	if c.Identifier != "" {
+		return c.Identifier
+	}
+	return c.Username
 }
 
 // UserRegistration represents user registration data
 type UserRegistration struct {
 	Username string `json:"username" binding:"required,min=3,max=30"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-}
\ No newline at end of file
+	Password string `json:"password" binding:"required"`
+}
+
+// PasswordChange represents a request to change the authenticated user's password
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// PasswordReset represents a request to reset a password with an emailed token
+type PasswordReset struct {
+	// Identifier is the username or email address of the account
+	Identifier  string `json:"identifier" binding:"required"`
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// UserPage is one page of a user listing
+type UserPage struct {
+	Users   []*User `json:"users"`
+	Total   int     `json:"total"` // Number of users matching the filter
+	Page    int     `json:"page"`
+	PerPage int     `json:"per_page"`
+}
+
+// RoleAssignment represents a request to change a user's role
+type RoleAssignment struct {
+	Role string `json:"role" binding:"required,oneof=user admin"`
+}
+
+// AccountDisable represents a request to disable a user's account
+type AccountDisable struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// AccountStatusChange represents a request to change a user's account status
+type AccountStatusChange struct {
+	Status string `json:"status" binding:"required,oneof=active suspended disabled pending_verification"`
+	Reason string `json:"reason" binding:"max=500"`
+	// Until optionally ends a suspension at the given time
+	Until *time.Time `json:"until"`
+}
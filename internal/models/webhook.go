@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead marks a delivery that failed every attempt and will not be
+	// retried unless it is replayed
+	DeliveryDead = "dead"
+)
+
+// WebhookSubscription represents an endpoint that receives events. Payloads
+// are signed with the secret, which is shown once, when the subscription is
+// created.
+type WebhookSubscription struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description,omitempty"`
+	Secret      string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Subscribes reports whether the subscription receives events of a type
+func (s *WebhookSubscription) Subscribes(eventType string) bool {
+	for _, event := range s.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscriptionCreation represents a request to subscribe to events
+type WebhookSubscriptionCreation struct {
+	URL         string   `json:"url" binding:"required,url,max=2000"`
+	Events      []string `json:"events" binding:"required,min=1"`
+	Description string   `json:"description" binding:"max=200"`
+}
+
+// CreatedWebhookSubscription is returned once when a subscription is created
+type CreatedWebhookSubscription struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookDelivery is one event queued for, or sent to, one subscription.
+// Deliveries are stored before they are attempted, so events are not lost
+// while a receiver is unavailable.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	// LastError describes why the last attempt failed
+	LastError string `json:"last_error,omitempty"`
+	// ResponseStatus is the HTTP status the receiver last answered with
+	ResponseStatus int        `json:"response_status,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
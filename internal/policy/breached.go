@@ -0,0 +1,82 @@
+package policy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BreachChecker screens passwords against known data breaches
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// FileBreachCorpus checks passwords against a locally stored corpus of
+// breached SHA-1 password hashes, laid out like the k-anonymity range API
+// of Have I Been Pwned: one file per 5-character uppercase hex prefix,
+// named after the prefix (optionally with a .txt extension), containing
+// lines of the form "SUFFIX:COUNT". Only the file for the password's
+// prefix is read on each check.
+type FileBreachCorpus struct {
+	dir string
+}
+
+// NewFileBreachCorpus creates a breach corpus backed by the given directory
+func NewFileBreachCorpus(dir string) (*FileBreachCorpus, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("breached password corpus: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password corpus: %s is not a directory", dir)
+	}
+	return &FileBreachCorpus{dir: dir}, nil
+}
+
+// IsBreached reports whether the password appears in the corpus
+func (c *FileBreachCorpus) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := c.openRange(prefix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, found := strings.Cut(line, ":")
+		if !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		// Padding entries added by the range API have a count of zero
+		if found {
+			if n, err := strconv.Atoi(count); err == nil && n == 0 {
+				continue
+			}
+		}
+		return true, nil
+	}
+	return false, scanner.Err()
+}
+
+// openRange opens the range file for a hash prefix
+func (c *FileBreachCorpus) openRange(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(c.dir, prefix+".txt"))
+	}
+	return file, err
+}
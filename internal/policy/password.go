@@ -0,0 +1,231 @@
+package policy
+
+import (
+	"fmt"
+	"learn/internal/config"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation codes reported by PasswordPolicy.Validate
+const (
+	CodeTooShort         = "too_short"
+	CodeTooLong          = "too_long"
+	CodeMissingUppercase = "missing_uppercase"
+	CodeMissingLowercase = "missing_lowercase"
+	CodeMissingDigit     = "missing_digit"
+	CodeMissingSymbol    = "missing_symbol"
+	CodeTooManyRepeats   = "too_many_repeats"
+	CodeContainsUserInfo = "contains_user_info"
+	CodeTooWeak          = "too_weak"
+	CodeBreached         = "breached"
+)
+
+// bcryptMaxBytes is the longest password bcrypt can hash, in bytes
+const bcryptMaxBytes = 72
+
+// Violation describes a single way a password fails the policy
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a password violates the policy
+type ValidationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password does not meet policy: " + strings.Join(messages, "; ")
+}
+
+// Has reports whether the error contains a violation with the given code
+func (e *ValidationError) Has(code string) bool {
+	for _, v := range e.Violations {
+		if v.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// UserInfo identifies the account a password is being set for, so the
+// password can be checked against it
+type UserInfo struct {
+	Username string
+	Email    string
+}
+
+// PasswordPolicy enforces password requirements
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes is the maximum length in bytes rather than characters, 0
+	// disables the check. It is set when new passwords are hashed with
+	// bcrypt, which cannot hash longer ones.
+	MaxBytes         int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	// MaxRepeats is the maximum number of consecutive identical characters, 0 disables the check
+	MaxRepeats int
+	// DisallowUserInfo rejects passwords containing the username or email
+	DisallowUserInfo bool
+	// MinStrength is the minimum Strength score (0-4)
+	MinStrength int
+	// Breached screens passwords against known breaches, nil disables the check
+	Breached BreachChecker
+}
+
+// NewPasswordPolicy creates a password policy from the configuration
+func NewPasswordPolicy(cfg config.PasswordConfig) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength:        cfg.MinLength,
+		MaxLength:        cfg.MaxLength,
+		RequireUppercase: cfg.RequireUppercase,
+		RequireLowercase: cfg.RequireLowercase,
+		RequireDigit:     cfg.RequireDigit,
+		RequireSymbol:    cfg.RequireSymbol,
+		MaxRepeats:       cfg.MaxRepeats,
+		DisallowUserInfo: cfg.DisallowUserInfo,
+		MinStrength:      cfg.MinStrength,
+	}
+	if cfg.Algorithm == "bcrypt" {
+		policy.MaxBytes = bcryptMaxBytes
+	}
+
+	if cfg.BreachedCorpusDir != "" {
+		corpus, err := NewFileBreachCorpus(cfg.BreachedCorpusDir)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = corpus
+	}
+
+	return policy, nil
+}
+
+// Validate checks a password against the policy. It returns a
+// *ValidationError listing every violation, or another error if the
+// breached-password screening could not be performed.
+func (p *PasswordPolicy) Validate(password string, user UserInfo) error {
+	var violations []Violation
+	add := func(code, format string, args ...interface{}) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		add(CodeTooShort, "must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		add(CodeTooLong, "must be at most %d characters long", p.MaxLength)
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		add(CodeTooLong, "must be at most %d bytes long", p.MaxBytes)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		add(CodeMissingUppercase, "must contain an uppercase letter")
+	}
+	if p.RequireLowercase && !hasLower {
+		add(CodeMissingLowercase, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		add(CodeMissingDigit, "must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		add(CodeMissingSymbol, "must contain a symbol")
+	}
+
+	if p.MaxRepeats > 0 && longestRun(password) > p.MaxRepeats {
+		add(CodeTooManyRepeats, "must not repeat a character more than %d times in a row", p.MaxRepeats)
+	}
+
+	userInputs := userInfoInputs(user)
+	if p.DisallowUserInfo && containsAny(strings.ToLower(password), userInputs) {
+		add(CodeContainsUserInfo, "must not contain your username or email")
+	}
+
+	if score := Strength(password, userInputs...); score < p.MinStrength {
+		add(CodeTooWeak, "is too easy to guess (strength %d of 4, need %d)", score, p.MinStrength)
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			add(CodeBreached, "has appeared in a known data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+// longestRun returns the length of the longest run of identical characters
+func longestRun(s string) int {
+	longest, current := 0, 0
+	var prev rune = -1
+	for _, r := range s {
+		if r == prev {
+			current++
+		} else {
+			current = 1
+			prev = r
+		}
+		if current > longest {
+			longest = current
+		}
+	}
+	return longest
+}
+
+// userInfoInputs returns the lowercased user-specific strings a password
+// should not contain, ignoring those too short to be meaningful
+func userInfoInputs(user UserInfo) []string {
+	var inputs []string
+	for _, s := range []string{user.Username, user.Email} {
+		s = strings.ToLower(s)
+		if len(s) >= 3 {
+			inputs = append(inputs, s)
+		}
+	}
+	if at := strings.LastIndex(user.Email, "@"); at >= 3 {
+		inputs = append(inputs, strings.ToLower(user.Email[:at]))
+	}
+	return inputs
+}
+
+// containsAny reports whether s contains any of the substrings
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
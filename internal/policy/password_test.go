@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"learn/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := &PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        64,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		MaxRepeats:       3,
+		DisallowUserInfo: true,
+		MinStrength:      3,
+	}
+	user := UserInfo{Username: "alice", Email: "wonderland@example.com"}
+
+	tests := []struct {
+		name      string
+		password  string
+		wantCodes []string
+	}{
+		{
+			name:     "Strong password",
+			password: "Tr0mb-Kettle-Vixen",
+		},
+		{
+			name:      "Common numeric password",
+			password:  "123456",
+			wantCodes: []string{CodeTooShort, CodeMissingUppercase, CodeMissingLowercase, CodeMissingSymbol, CodeTooWeak},
+		},
+		{
+			name:      "Repeated characters",
+			password:  "Xy7!aaaab-Quorum",
+			wantCodes: []string{CodeTooManyRepeats},
+		},
+		{
+			name:      "Contains username",
+			password:  "Alice-Zq8!pw-Lotus",
+			wantCodes: []string{CodeContainsUserInfo},
+		},
+		{
+			name:      "Contains email local part",
+			password:  "Wonderland#9Zq",
+			wantCodes: []string{CodeContainsUserInfo},
+		},
+		{
+			name:      "Leet dictionary word",
+			password:  "P@ssw0rd123!",
+			wantCodes: []string{CodeTooWeak},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.password, user)
+			if len(tt.wantCodes) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want *ValidationError", err)
+			}
+			for _, code := range tt.wantCodes {
+				if !validationErr.Has(code) {
+					t.Errorf("Validate() violations = %v, missing %s", validationErr.Violations, code)
+				}
+			}
+			if len(validationErr.Violations) != len(tt.wantCodes) {
+				t.Errorf("Validate() violations = %v, want %v", validationErr.Violations, tt.wantCodes)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyMaxBytes(t *testing.T) {
+	// bcrypt cannot hash more than 72 bytes, however many characters they are
+	policy, err := NewPasswordPolicy(config.PasswordConfig{Algorithm: "bcrypt", MaxLength: 72})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Validate(strings.Repeat("ü", 36), UserInfo{}); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+	var validationErr *ValidationError
+	if err := policy.Validate(strings.Repeat("ü", 37), UserInfo{}); !errors.As(err, &validationErr) || !validationErr.Has(CodeTooLong) {
+		t.Errorf("Validate() error = %v, want %s", err, CodeTooLong)
+	}
+
+	policy, err = NewPasswordPolicy(config.PasswordConfig{Algorithm: "argon2id", MaxLength: 72})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Validate(strings.Repeat("ü", 37), UserInfo{}); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+}
+
+func TestStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+	}{
+		{"password", 0, 0},
+		{"qwerty123", 1, 0},
+		{"abcdefgh", 1, 0},
+		{"correcthorsebatterystaple", 4, 4},
+		{"x7#Kq9!vL2@m", 4, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			score := Strength(tt.password)
+			if score < tt.minScore || score > tt.maxScore {
+				t.Errorf("Strength(%q) = %d, want between %d and %d", tt.password, score, tt.minScore, tt.maxScore)
+			}
+		})
+	}
+}
+
+func TestFileBreachCorpus(t *testing.T) {
+	dir := t.TempDir()
+
+	// Write a range file for the breached password, plus a padding entry
+	// for the "padded" password which must not count as breached
+	breached := rangeEntry("hunter2")
+	padded := rangeEntry("padded-entry")
+	if breached.prefix == padded.prefix {
+		t.Fatalf("test passwords share a prefix")
+	}
+	writeRange(t, dir, breached.prefix, breached.suffix+":17")
+	writeRange(t, dir, padded.prefix+".txt", padded.suffix+":0")
+
+	corpus, err := NewFileBreachCorpus(dir)
+	if err != nil {
+		t.Fatalf("NewFileBreachCorpus() error = %v", err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"hunter2", true},
+		{"padded-entry", false},
+		{"not-in-corpus", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			got, err := corpus.IsBreached(tt.password)
+			if err != nil {
+				t.Fatalf("IsBreached() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsBreached() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewFileBreachCorpus(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("NewFileBreachCorpus() error = nil for a missing directory")
+	}
+}
+
+type hashRange struct {
+	prefix string
+	suffix string
+}
+
+func rangeEntry(password string) hashRange {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return hashRange{prefix: hash[:5], suffix: hash[5:]}
+}
+
+func writeRange(t *testing.T, dir, name, line string) {
+	t.Helper()
+	content := "0000000000000000000000000000000000A:3\n" + line + "\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write range file: %v", err)
+	}
+}
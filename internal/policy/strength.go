@@ -0,0 +1,208 @@
+package policy
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords lists frequently used passwords and password fragments.
+// Matches are scored as dictionary guesses rather than random characters.
+var commonPasswords = []string{
+	"password", "passw0rd", "qwerty", "qwertyuiop", "asdfgh", "asdfghjkl", "zxcvbn", "zxcvbnm",
+	"letmein", "welcome", "admin", "administrator", "login", "master", "hello", "secret",
+	"monkey", "dragon", "football", "baseball", "soccer", "hockey", "basketball", "superman",
+	"batman", "iloveyou", "trustno1", "sunshine", "princess", "shadow", "michael", "jordan",
+	"jennifer", "hunter", "buster", "charlie", "thomas", "killer", "ginger", "pepper",
+	"starwars", "whatever", "freedom", "computer", "internet", "access", "default", "changeme",
+	"abc123", "123abc", "111111", "000000", "123123", "654321", "666666", "121212",
+	"123456", "1234567", "12345678", "123456789", "1234567890", "987654321", "summer", "winter",
+	"spring", "autumn", "flower", "cookie", "cheese", "chocolate", "mustang", "ferrari",
+	"harley", "matrix", "maggie", "silver", "orange", "purple", "yellow", "google",
+	"facebook", "twitter", "love", "pass", "user", "test", "guest", "root",
+}
+
+// keyboardRows are used to detect runs of adjacent keys
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+// leetSubstitutions undoes common character substitutions before dictionary matching
+var leetSubstitutions = strings.NewReplacer(
+	"0", "o", "1", "l", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i",
+)
+
+// Strength estimates how hard a password is to guess on a zxcvbn-style
+// scale from 0 (trivially guessable) to 4 (very unguessable). Dictionary
+// words, user inputs, repeats, sequences and keyboard runs contribute far
+// fewer guesses than random characters.
+func Strength(password string, userInputs ...string) int {
+	guesses := estimateGuessesLog10(password, userInputs)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// estimateGuessesLog10 returns the base-10 logarithm of the estimated
+// number of guesses needed to find the password
+func estimateGuessesLog10(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	lower := []rune(strings.ToLower(password))
+	unleet := []rune(leetSubstitutions.Replace(strings.ToLower(password)))
+	if len(unleet) != len(runes) || len(lower) != len(runes) {
+		// Case mapping changed the length, fall back to the raw runes
+		lower, unleet = runes, runes
+	}
+
+	covered := make([]bool, len(runes))
+	var guesses float64
+
+	// Dictionary matches, longest words first so they win over fragments
+	words := append(append([]string{}, userInputs...), commonPasswords...)
+	for _, word := range sortedByLength(words) {
+		wordRunes := []rune(word)
+		for _, candidate := range [][]rune{lower, unleet} {
+			for start := indexRunes(candidate, wordRunes, 0); start >= 0; start = indexRunes(candidate, wordRunes, start+1) {
+				end := start + len(wordRunes)
+				if anyCovered(covered, start, end) {
+					continue
+				}
+				for i := start; i < end; i++ {
+					covered[i] = true
+				}
+				// Roughly the rank of a common word, plus a bit for case or leet variations
+				guesses += 2
+				if string(runes[start:end]) != word {
+					guesses += 1
+				}
+			}
+		}
+	}
+
+	charsetLog := math.Log10(float64(charsetSize(runes)))
+	for i := range runes {
+		if covered[i] {
+			continue
+		}
+		if i > 0 && isPredictable(lower[i-1], lower[i]) {
+			guesses += 0.3
+			continue
+		}
+		guesses += charsetLog
+	}
+
+	return guesses
+}
+
+// charsetSize estimates the size of the alphabet the password was drawn from
+func charsetSize(runes []rune) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	return size
+}
+
+// isPredictable reports whether cur follows prev as a repeat, an
+// alphabetic or numeric sequence, or an adjacent key on the keyboard
+func isPredictable(prev, cur rune) bool {
+	if cur == prev || cur == prev+1 || cur == prev-1 {
+		return true
+	}
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, prev)
+		if i < 0 {
+			continue
+		}
+		if (i > 0 && rune(row[i-1]) == cur) || (i+1 < len(row) && rune(row[i+1]) == cur) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedByLength returns the words of at least three characters, longest first
+func sortedByLength(words []string) []string {
+	var sorted []string
+	for _, w := range words {
+		if len([]rune(w)) >= 3 {
+			sorted = append(sorted, w)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len([]rune(sorted[i])) > len([]rune(sorted[j]))
+	})
+	return sorted
+}
+
+// indexRunes returns the index of the first occurrence of sub in s at or after from, or -1
+func indexRunes(s, sub []rune, from int) int {
+	for i := from; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// anyCovered reports whether any position in [start, end) is already covered
+func anyCovered(covered []bool, start, end int) bool {
+	for i := start; i < end; i++ {
+		if covered[i] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"learn/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAccessTokenNotFound      = errors.New("access token not found")
+	ErrAccessTokenAlreadyExists = errors.New("access token already exists")
+)
+
+// AccessTokenRepository defines the interface for personal access token data access
+type AccessTokenRepository interface {
+	Create(ctx context.Context, token *models.PersonalAccessToken) error
+	// GetByHash looks a token up by the hash of its secret value
+	GetByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+	// ListByUser returns a user's tokens, newest first
+	ListByUser(ctx context.Context, userID string) ([]*models.PersonalAccessToken, error)
+	// Touch records when a token was last used
+	Touch(ctx context.Context, id string, usedAt time.Time) error
+	Delete(ctx context.Context, userID, id string) error
+	DeleteAllForUser(ctx context.Context, userID string) error
+}
+
+// InMemoryAccessTokenRepository implements AccessTokenRepository with an in-memory store
+type InMemoryAccessTokenRepository struct {
+	// Map of token IDs to tokens
+	tokens map[string]*models.PersonalAccessToken
+	// Map of token hashes to token IDs
+	byHash map[string]string
+	// Map of user IDs to their token IDs
+	userTokens map[string]map[string]struct{}
+	mutex      sync.RWMutex
+}
+
+// NewInMemoryAccessTokenRepository creates a new in-memory access token repository
+func NewInMemoryAccessTokenRepository() *InMemoryAccessTokenRepository {
+	return &InMemoryAccessTokenRepository{
+		tokens:     make(map[string]*models.PersonalAccessToken),
+		byHash:     make(map[string]string),
+		userTokens: make(map[string]map[string]struct{}),
+	}
+}
+
+// Create adds a new access token to the repository
+func (r *InMemoryAccessTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.tokens[token.ID]; exists {
+		return ErrAccessTokenAlreadyExists
+	}
+	if _, exists := r.byHash[token.TokenHash]; exists {
+		return ErrAccessTokenAlreadyExists
+	}
+
+	r.tokens[token.ID] = copyAccessToken(token)
+	r.byHash[token.TokenHash] = token.ID
+	if r.userTokens[token.UserID] == nil {
+		r.userTokens[token.UserID] = make(map[string]struct{})
+	}
+	r.userTokens[token.UserID][token.ID] = struct{}{}
+	return nil
+}
+
+// GetByHash retrieves an access token by the hash of its value
+func (r *InMemoryAccessTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	id, exists := r.byHash[tokenHash]
+	if !exists {
+		return nil, ErrAccessTokenNotFound
+	}
+	return copyAccessToken(r.tokens[id]), nil
+}
+
+// ListByUser returns all access tokens belonging to a user, newest first
+func (r *InMemoryAccessTokenRepository) ListByUser(ctx context.Context, userID string) ([]*models.PersonalAccessToken, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	tokens := make([]*models.PersonalAccessToken, 0, len(r.userTokens[userID]))
+	for id := range r.userTokens[userID] {
+		tokens = append(tokens, copyAccessToken(r.tokens[id]))
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// Touch updates the time an access token was last used
+func (r *InMemoryAccessTokenRepository) Touch(ctx context.Context, id string, usedAt time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	token, exists := r.tokens[id]
+	if !exists {
+		return ErrAccessTokenNotFound
+	}
+	token.LastUsedAt = &usedAt
+	return nil
+}
+
+// Delete removes one of a user's access tokens
+func (r *InMemoryAccessTokenRepository) Delete(ctx context.Context, userID, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	token, exists := r.tokens[id]
+	if !exists || token.UserID != userID {
+		return ErrAccessTokenNotFound
+	}
+	r.remove(token)
+	return nil
+}
+
+// DeleteAllForUser removes all access tokens belonging to a user
+func (r *InMemoryAccessTokenRepository) DeleteAllForUser(ctx context.Context, userID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for id := range r.userTokens[userID] {
+		r.remove(r.tokens[id])
+	}
+	return nil
+}
+
+// remove deletes a token from every map; the caller must hold the lock
+func (r *InMemoryAccessTokenRepository) remove(token *models.PersonalAccessToken) {
+	delete(r.tokens, token.ID)
+	delete(r.byHash, token.TokenHash)
+	delete(r.userTokens[token.UserID], token.ID)
+	if len(r.userTokens[token.UserID]) == 0 {
+		delete(r.userTokens, token.UserID)
+	}
+}
+
+// copyAccessToken returns a copy of a token that does not share mutable state
+func copyAccessToken(token *models.PersonalAccessToken) *models.PersonalAccessToken {
+	c := *token
+	c.Scopes = append([]string(nil), token.Scopes...)
+	if token.LastUsedAt != nil {
+		lastUsedAt := *token.LastUsedAt
+		c.LastUsedAt = &lastUsedAt
+	}
+	if token.ExpiresAt != nil {
+		expiresAt := *token.ExpiresAt
+		c.ExpiresAt = &expiresAt
+	}
+	return &c
+}
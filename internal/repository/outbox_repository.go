@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"learn/internal/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OutboxRepository defines the interface for outbox data access
+type OutboxRepository interface {
+	Add(ctx context.Context, record *models.OutboxRecord) error
+	// Pending returns up to limit records that are due at the given time,
+	// oldest first. Dead-lettered records are never due.
+	Pending(ctx context.Context, now time.Time, limit int) ([]*models.OutboxRecord, error)
+	// Update stores a record's attempts, next attempt time, last error,
+	// handled subscribers and dead-letter time. Updating a record that does not exist is not an
+	// error, for the same reason as Delete.
+	Update(ctx context.Context, record *models.OutboxRecord) error
+	// Delete removes a record once it has been dispatched. Deleting a
+	// record that does not exist is not an error, since it may have been
+	// dispatched by another relay.
+	Delete(ctx context.Context, id string) error
+}
+
+// InMemoryOutboxRepository implements OutboxRepository with an in-memory
+// store. Records are kept in the order they were added.
+type InMemoryOutboxRepository struct {
+	records []*models.OutboxRecord
+	mutex   sync.Mutex
+}
+
+// NewInMemoryOutboxRepository creates a new in-memory outbox repository
+func NewInMemoryOutboxRepository() *InMemoryOutboxRepository {
+	return &InMemoryOutboxRepository{}
+}
+
+// Add stores a record
+func (r *InMemoryOutboxRepository) Add(ctx context.Context, record *models.OutboxRecord) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored := *record
+	stored.Handled = slices.Clone(record.Handled)
+	r.records = append(r.records, &stored)
+	return nil
+}
+
+// Pending returns the oldest records that are due
+func (r *InMemoryOutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]*models.OutboxRecord, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	records := []*models.OutboxRecord{}
+	for _, record := range r.records {
+		if len(records) == limit {
+			break
+		}
+		if record.Due(now) {
+			c := *record
+			c.Handled = slices.Clone(record.Handled)
+			records = append(records, &c)
+		}
+	}
+	return records, nil
+}
+
+// Update stores a record's attempt state
+func (r *InMemoryOutboxRepository) Update(ctx context.Context, record *models.OutboxRecord) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, stored := range r.records {
+		if stored.ID == record.ID {
+			stored.Attempts = record.Attempts
+			stored.NextAttemptAt = record.NextAttemptAt
+			stored.LastError = record.LastError
+			stored.Handled = slices.Clone(record.Handled)
+			stored.DeadAt = record.DeadAt
+			break
+		}
+	}
+	return nil
+}
+
+// Delete removes a record. Records are normally deleted oldest first, so
+// the search ends early.
+func (r *InMemoryOutboxRepository) Delete(ctx context.Context, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i, record := range r.records {
+		if record.ID == id {
+			r.records = slices.Delete(r.records, i, i+1)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,643 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"learn/internal/models"
+	"strings"
+	"time"
+)
+
+// dbtx is implemented by both *sql.DB and *sql.Tx, so the repositories run
+// the same queries inside and outside a transaction
+type dbtx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLStore implements Store on a SQL database. Like SQLWebhookRepository,
+// times are stored as Unix nanoseconds and queries use numbered
+// placeholders, as supported by SQLite and PostgreSQL.
+type SQLStore struct {
+	db *sql.DB
+	// q is the transaction of a store passed to an Atomic function, or db
+	q dbtx
+}
+
+// NewSQLStore creates a store on db, creating its tables if needed. The
+// store takes ownership of db and closes it when it is closed.
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			username TEXT NOT NULL,
+			username_key TEXT NOT NULL UNIQUE,
+			skeleton TEXT NOT NULL UNIQUE,
+			email TEXT NOT NULL,
+			email_key TEXT NOT NULL UNIQUE,
+			role TEXT NOT NULL,
+			password_hash TEXT NOT NULL,
+			status TEXT NOT NULL,
+			status_reason TEXT NOT NULL,
+			status_until BIGINT,
+			password_reset_required BOOLEAN NOT NULL,
+			password_reset_token_hash TEXT NOT NULL,
+			password_reset_expires_at BIGINT,
+			created_at BIGINT,
+			updated_at BIGINT
+		)`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			refresh_token_hash TEXT NOT NULL UNIQUE,
+			client_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			user_agent TEXT NOT NULL,
+			ip_address TEXT NOT NULL,
+			created_at BIGINT,
+			last_used_at BIGINT,
+			expires_at BIGINT NOT NULL,
+			idle_timeout BIGINT NOT NULL,
+			absolute_expires_at BIGINT
+		)`,
+		`CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id)`,
+		`CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at)`,
+		`CREATE TABLE IF NOT EXISTS access_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			last_used_at BIGINT,
+			expires_at BIGINT
+		)`,
+		`CREATE INDEX IF NOT EXISTS access_tokens_user_id ON access_tokens (user_id)`,
+		`CREATE TABLE IF NOT EXISTS outbox (
+			id TEXT PRIMARY KEY,
+			event_type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at BIGINT,
+			last_error TEXT NOT NULL DEFAULT '',
+			handled TEXT NOT NULL DEFAULT '',
+			dead_at BIGINT
+		)`,
+		`CREATE INDEX IF NOT EXISTS outbox_created_at ON outbox (created_at, id)`,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLStore{db: db, q: db}, nil
+}
+
+// Users returns the user repository
+func (s *SQLStore) Users() UserRepository {
+	return &sqlUserRepository{db: s.q}
+}
+
+// Tokens returns the refresh token repository
+func (s *SQLStore) Tokens() TokenRepository {
+	return &sqlTokenRepository{db: s.q}
+}
+
+// AccessTokens returns the personal access token repository
+func (s *SQLStore) AccessTokens() AccessTokenRepository {
+	return &sqlAccessTokenRepository{db: s.q}
+}
+
+// Outbox returns the outbox repository
+func (s *SQLStore) Outbox() OutboxRepository {
+	return &sqlOutboxRepository{db: s.q}
+}
+
+// Atomic runs fn in a transaction, which is rolled back if ctx is cancelled
+// before it commits. Within a transaction, fn runs in the same transaction.
+func (s *SQLStore) Atomic(ctx context.Context, fn func(tx Store) error) error {
+	if s.q != dbtx(s.db) {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&SQLStore{db: s.db, q: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ping checks that the database can be reached
+func (s *SQLStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// sqlUserRepository implements UserRepository. Uniqueness of the
+// normalized username, username skeleton and normalized email is enforced
+// by unique columns holding the same keys as the in-memory indexes.
+type sqlUserRepository struct {
+	db dbtx
+}
+
+const selectUsers = `SELECT id, username, email, role, password_hash, status, status_reason, status_until,
+	password_reset_required, password_reset_token_hash, password_reset_expires_at, created_at, updated_at FROM users`
+
+func (r *sqlUserRepository) Create(ctx context.Context, user *models.User) error {
+	keys := keysFor(user)
+	if conflict, err := r.conflicts(ctx, `id = $4 OR`, keys, user.ID); err != nil || conflict {
+		return conflictError(conflict, err)
+	}
+
+	_, err := r.db.ExecContext(ctx, `INSERT INTO users (id, username, username_key, skeleton, email, email_key, role,
+		password_hash, status, status_reason, status_until, password_reset_required, password_reset_token_hash,
+		password_reset_expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		user.ID, user.Username, keys.username, keys.skeleton, user.Email, keys.email, user.Role,
+		user.PasswordHash, user.Status, user.StatusReason, nullTime(user.StatusUntil), user.PasswordResetRequired,
+		user.PasswordResetTokenHash, timeValue(user.PasswordResetExpiresAt), timeValue(user.CreatedAt),
+		timeValue(user.UpdatedAt))
+	if err != nil {
+		// A concurrent insert may have taken one of the keys since the check
+		if conflict, _ := r.conflicts(ctx, `id = $4 OR`, keys, user.ID); conflict {
+			return ErrUserAlreadyExists
+		}
+	}
+	return err
+}
+
+func (r *sqlUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	return r.get(ctx, selectUsers+` WHERE id = $1`, id)
+}
+
+func (r *sqlUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return r.get(ctx, selectUsers+` WHERE username_key = $1`, keysFor(&models.User{Username: username}).username)
+}
+
+func (r *sqlUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.get(ctx, selectUsers+` WHERE email_key = $1`, keysFor(&models.User{Email: email}).email)
+}
+
+func (r *sqlUserRepository) Update(ctx context.Context, user *models.User) error {
+	keys := keysFor(user)
+	if conflict, err := r.conflicts(ctx, ``, keys, user.ID); err != nil || conflict {
+		return conflictError(conflict, err)
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE users SET username = $1, username_key = $2, skeleton = $3, email = $4,
+		email_key = $5, role = $6, password_hash = $7, status = $8, status_reason = $9, status_until = $10,
+		password_reset_required = $11, password_reset_token_hash = $12, password_reset_expires_at = $13,
+		created_at = $14, updated_at = $15 WHERE id = $16`,
+		user.Username, keys.username, keys.skeleton, user.Email, keys.email, user.Role, user.PasswordHash,
+		user.Status, user.StatusReason, nullTime(user.StatusUntil), user.PasswordResetRequired,
+		user.PasswordResetTokenHash, timeValue(user.PasswordResetExpiresAt), timeValue(user.CreatedAt),
+		timeValue(user.UpdatedAt), user.ID)
+	if err != nil {
+		if conflict, _ := r.conflicts(ctx, ``, keys, user.ID); conflict {
+			return ErrUserAlreadyExists
+		}
+		return err
+	}
+	return requireAffected(result, ErrUserNotFound)
+}
+
+func (r *sqlUserRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrUserNotFound)
+}
+
+// List filters users in Go rather than in SQL, since effective statuses
+// depend on the current time and queries match normalized identifiers.
+// Like the in-memory listing, it scans every user.
+func (r *sqlUserRepository) List(ctx context.Context, filter UserFilter) ([]*models.User, int, error) {
+	users, err := r.query(ctx, selectUsers+` ORDER BY created_at, id`)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	matched := make([]*models.User, 0)
+	for _, user := range users {
+		if filter.Matches(user) {
+			matched = append(matched, user)
+		}
+	}
+
+	total := len(matched)
+	start := min(max(filter.Offset, 0), total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+	return matched[start:end], total, nil
+}
+
+// Count returns the number of stored users
+func (r *sqlUserRepository) Count(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&count)
+	return count, err
+}
+
+// conflicts reports whether any of the keys belongs to a user other than
+// the one with the given ID, or, with the condition "id = $4 OR", whether
+// the ID is taken too
+func (r *sqlUserRepository) conflicts(ctx context.Context, condition string, keys userKeys, id string) (bool, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+condition+`
+		((username_key = $1 OR skeleton = $2 OR email_key = $3) AND id <> $4)`,
+		keys.username, keys.skeleton, keys.email, id).Scan(&count)
+	return count > 0, err
+}
+
+func conflictError(conflict bool, err error) error {
+	if err != nil {
+		return err
+	}
+	return ErrUserAlreadyExists
+}
+
+func (r *sqlUserRepository) get(ctx context.Context, query string, args ...any) (*models.User, error) {
+	users, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+func (r *sqlUserRepository) query(ctx context.Context, query string, args ...any) ([]*models.User, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		var user models.User
+		var statusUntil, resetExpiresAt, createdAt, updatedAt sql.NullInt64
+		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.PasswordHash, &user.Status,
+			&user.StatusReason, &statusUntil, &user.PasswordResetRequired, &user.PasswordResetTokenHash,
+			&resetExpiresAt, &createdAt, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		user.StatusUntil = timeFromNull(statusUntil)
+		user.PasswordResetExpiresAt = timeFromValue(resetExpiresAt)
+		user.CreatedAt = timeFromValue(createdAt)
+		user.UpdatedAt = timeFromValue(updatedAt)
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
+// sqlTokenRepository implements TokenRepository. Only hashes of refresh
+// tokens are stored, so a copy of the database cannot be used to refresh
+// sessions.
+type sqlTokenRepository struct {
+	db dbtx
+}
+
+const selectSessions = `SELECT id, user_id, client_id, name, user_agent, ip_address, created_at, last_used_at,
+	expires_at, idle_timeout, absolute_expires_at FROM sessions`
+
+func (r *sqlTokenRepository) Store(ctx context.Context, refreshToken string, session *models.Session) error {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE id = $1 OR refresh_token_hash = $2`,
+		session.ID, hashToken(refreshToken)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTokenAlreadyExists
+	}
+
+	_, err = r.db.ExecContext(ctx, `INSERT INTO sessions (id, user_id, refresh_token_hash, client_id, name, user_agent,
+		ip_address, created_at, last_used_at, expires_at, idle_timeout, absolute_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		session.ID, session.UserID, hashToken(refreshToken), session.ClientID, session.Name, session.UserAgent,
+		session.IPAddress, timeValue(session.CreatedAt), timeValue(session.LastUsedAt),
+		session.ExpiresAt.UnixNano(), int64(session.IdleTimeout), timeValue(session.AbsoluteExpiresAt))
+	return err
+}
+
+func (r *sqlTokenRepository) GetUserIDByToken(ctx context.Context, refreshToken string) (string, error) {
+	session, err := r.GetSessionByToken(ctx, refreshToken)
+	if err != nil {
+		return "", err
+	}
+	return session.UserID, nil
+}
+
+func (r *sqlTokenRepository) GetSessionByToken(ctx context.Context, refreshToken string) (*models.Session, error) {
+	sessions, err := r.query(ctx, selectSessions+` WHERE refresh_token_hash = $1`, hashToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, ErrTokenNotFound
+	}
+	if time.Now().After(sessions[0].ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+	return sessions[0], nil
+}
+
+func (r *sqlTokenRepository) GetSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	sessions, err := r.query(ctx, selectSessions+` WHERE id = $1`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	if time.Now().After(sessions[0].ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+	return sessions[0], nil
+}
+
+func (r *sqlTokenRepository) Rotate(ctx context.Context, oldToken, newToken string, session *models.Session) error {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE refresh_token_hash = $1`,
+		hashToken(newToken)).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrTokenAlreadyExists
+	}
+
+	result, err := r.db.ExecContext(ctx, `UPDATE sessions SET refresh_token_hash = $1, user_id = $2, client_id = $3,
+		name = $4, user_agent = $5, ip_address = $6, created_at = $7, last_used_at = $8, expires_at = $9,
+		idle_timeout = $10, absolute_expires_at = $11 WHERE id = $12 AND refresh_token_hash = $13`,
+		hashToken(newToken), session.UserID, session.ClientID, session.Name, session.UserAgent,
+		session.IPAddress, timeValue(session.CreatedAt), timeValue(session.LastUsedAt),
+		session.ExpiresAt.UnixNano(), int64(session.IdleTimeout), timeValue(session.AbsoluteExpiresAt),
+		session.ID, hashToken(oldToken))
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrTokenNotFound)
+}
+
+func (r *sqlTokenRepository) ListSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	return r.query(ctx, selectSessions+` WHERE user_id = $1`, userID)
+}
+
+func (r *sqlTokenRepository) DeleteSession(ctx context.Context, userID, sessionID string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrSessionNotFound)
+}
+
+func (r *sqlTokenRepository) DeleteByToken(ctx context.Context, refreshToken string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE refresh_token_hash = $1`, hashToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrTokenNotFound)
+}
+
+func (r *sqlTokenRepository) DeleteAllForUser(ctx context.Context, userID string) error {
+	return r.DeleteAllForUserExcept(ctx, userID, "")
+}
+
+func (r *sqlTokenRepository) DeleteAllForUserExcept(ctx context.Context, userID, sessionID string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1 AND id <> $2`, userID, sessionID)
+	return err
+}
+
+func (r *sqlTokenRepository) PurgeExpired(ctx context.Context) (int, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < $1`, time.Now().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	return int(purged), err
+}
+
+func (r *sqlTokenRepository) CountActive(ctx context.Context) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sessions WHERE expires_at >= $1`, time.Now().UnixNano()).Scan(&count)
+	return count, err
+}
+
+func (r *sqlTokenRepository) query(ctx context.Context, query string, args ...any) ([]*models.Session, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		var session models.Session
+		var createdAt, lastUsedAt, absoluteExpiresAt sql.NullInt64
+		var expiresAt, idleTimeout int64
+		err := rows.Scan(&session.ID, &session.UserID, &session.ClientID, &session.Name, &session.UserAgent,
+			&session.IPAddress, &createdAt, &lastUsedAt, &expiresAt, &idleTimeout, &absoluteExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		session.CreatedAt = timeFromValue(createdAt)
+		session.LastUsedAt = timeFromValue(lastUsedAt)
+		session.ExpiresAt = time.Unix(0, expiresAt)
+		session.IdleTimeout = time.Duration(idleTimeout)
+		session.AbsoluteExpiresAt = timeFromValue(absoluteExpiresAt)
+		sessions = append(sessions, &session)
+	}
+	return sessions, rows.Err()
+}
+
+// sqlAccessTokenRepository implements AccessTokenRepository. Tokens are
+// stored by the hash of their value, as in the in-memory repository.
+type sqlAccessTokenRepository struct {
+	db dbtx
+}
+
+const selectAccessTokens = `SELECT id, user_id, name, prefix, token_hash, scopes, created_at, last_used_at,
+	expires_at FROM access_tokens`
+
+func (r *sqlAccessTokenRepository) Create(ctx context.Context, token *models.PersonalAccessToken) error {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM access_tokens WHERE id = $1 OR token_hash = $2`,
+		token.ID, token.TokenHash).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAccessTokenAlreadyExists
+	}
+
+	_, err = r.db.ExecContext(ctx, `INSERT INTO access_tokens (id, user_id, name, prefix, token_hash, scopes, created_at,
+		last_used_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		token.ID, token.UserID, token.Name, token.Prefix, token.TokenHash, strings.Join(token.Scopes, ","),
+		token.CreatedAt.UnixNano(), nullTime(token.LastUsedAt), nullTime(token.ExpiresAt))
+	return err
+}
+
+func (r *sqlAccessTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	tokens, err := r.query(ctx, selectAccessTokens+` WHERE token_hash = $1`, tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrAccessTokenNotFound
+	}
+	return tokens[0], nil
+}
+
+func (r *sqlAccessTokenRepository) ListByUser(ctx context.Context, userID string) ([]*models.PersonalAccessToken, error) {
+	return r.query(ctx, selectAccessTokens+` WHERE user_id = $1 ORDER BY created_at DESC, id`, userID)
+}
+
+func (r *sqlAccessTokenRepository) Touch(ctx context.Context, id string, usedAt time.Time) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE access_tokens SET last_used_at = $1 WHERE id = $2`, usedAt.UnixNano(), id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrAccessTokenNotFound)
+}
+
+func (r *sqlAccessTokenRepository) Delete(ctx context.Context, userID, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM access_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrAccessTokenNotFound)
+}
+
+func (r *sqlAccessTokenRepository) DeleteAllForUser(ctx context.Context, userID string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM access_tokens WHERE user_id = $1`, userID)
+	return err
+}
+
+func (r *sqlAccessTokenRepository) query(ctx context.Context, query string, args ...any) ([]*models.PersonalAccessToken, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*models.PersonalAccessToken{}
+	for rows.Next() {
+		var token models.PersonalAccessToken
+		var scopes string
+		var createdAt int64
+		var lastUsedAt, expiresAt sql.NullInt64
+		if err := rows.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.TokenHash, &scopes,
+			&createdAt, &lastUsedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		if scopes != "" {
+			token.Scopes = strings.Split(scopes, ",")
+		}
+		token.CreatedAt = time.Unix(0, createdAt)
+		token.LastUsedAt = timeFromNull(lastUsedAt)
+		token.ExpiresAt = timeFromNull(expiresAt)
+		tokens = append(tokens, &token)
+	}
+	return tokens, rows.Err()
+}
+
+// sqlOutboxRepository implements OutboxRepository
+type sqlOutboxRepository struct {
+	db dbtx
+}
+
+func (r *sqlOutboxRepository) Add(ctx context.Context, record *models.OutboxRecord) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO outbox (id, event_type, payload, created_at, attempts, next_attempt_at, last_error, handled, dead_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		record.ID, record.EventType, string(record.Payload), record.CreatedAt.UnixNano(),
+		record.Attempts, timeValue(record.NextAttemptAt), record.LastError, strings.Join(record.Handled, ","), nullTime(record.DeadAt))
+	return err
+}
+
+func (r *sqlOutboxRepository) Pending(ctx context.Context, now time.Time, limit int) ([]*models.OutboxRecord, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, event_type, payload, created_at, attempts, next_attempt_at, last_error, handled, dead_at
+		FROM outbox WHERE dead_at IS NULL AND (next_attempt_at IS NULL OR next_attempt_at <= $1)
+		ORDER BY created_at, id LIMIT $2`, now.UnixNano(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*models.OutboxRecord{}
+	for rows.Next() {
+		var record models.OutboxRecord
+		var payload, handled string
+		var createdAt int64
+		var nextAttemptAt, deadAt sql.NullInt64
+		if err := rows.Scan(&record.ID, &record.EventType, &payload, &createdAt,
+			&record.Attempts, &nextAttemptAt, &record.LastError, &handled, &deadAt); err != nil {
+			return nil, err
+		}
+		if handled != "" {
+			record.Handled = strings.Split(handled, ",")
+		}
+		record.Payload = []byte(payload)
+		record.CreatedAt = time.Unix(0, createdAt)
+		record.NextAttemptAt = timeFromValue(nextAttemptAt)
+		record.DeadAt = timeFromNull(deadAt)
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+func (r *sqlOutboxRepository) Update(ctx context.Context, record *models.OutboxRecord) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE outbox SET attempts = $1, next_attempt_at = $2, last_error = $3, handled = $4, dead_at = $5 WHERE id = $6`,
+		record.Attempts, timeValue(record.NextAttemptAt), record.LastError, strings.Join(record.Handled, ","), nullTime(record.DeadAt), record.ID)
+	return err
+}
+
+func (r *sqlOutboxRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = $1`, id)
+	return err
+}
+
+// hashToken returns the SHA-256 hash of a refresh token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// timeValue stores the zero time as NULL, since it cannot be represented
+// in Unix nanoseconds
+func timeValue(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+	return nullTime(&t)
+}
+
+func timeFromValue(n sql.NullInt64) time.Time {
+	if t := timeFromNull(n); t != nil {
+		return *t
+	}
+	return time.Time{}
+}
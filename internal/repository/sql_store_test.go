@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"learn/internal/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSQLStore(t *testing.T) *SQLStore {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "auth.db"))
+	require.NoError(t, err)
+	store, err := NewSQLStore(db)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLUserRepositoryIndexes(t *testing.T) {
+	testUserRepositoryIndexes(t, newTestSQLStore(t).Users())
+}
+
+func TestSQLUserRepositoryList(t *testing.T) {
+	testUserRepositoryList(t, newTestSQLStore(t).Users())
+}
+
+func TestSQLUserRepositoryRoundTrip(t *testing.T) {
+	ctx := t.Context()
+	repo := newTestSQLStore(t).Users()
+	until := time.Unix(1800000000, 0)
+	user := &models.User{
+		ID:           "1",
+		Username:     "alice",
+		Email:        "alice@example.com",
+		Role:         models.RoleAdmin,
+		PasswordHash: "$2a$10$hash",
+		AccountStatus: models.AccountStatus{
+			Status:       models.StatusSuspended,
+			StatusReason: "abuse",
+			StatusUntil:  &until,
+		},
+		PasswordResetRequired: true,
+		CreatedAt:             time.Unix(1700000000, 0),
+		UpdatedAt:             time.Unix(1700000001, 0),
+	}
+	require.NoError(t, repo.Create(ctx, user))
+
+	found, err := repo.GetByID(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, user.AccountStatus.Status, found.Status)
+	require.NotNil(t, found.StatusUntil)
+	assert.True(t, found.StatusUntil.Equal(until))
+	assert.True(t, found.PasswordResetRequired)
+	assert.True(t, found.PasswordResetExpiresAt.IsZero())
+	assert.True(t, found.CreatedAt.Equal(user.CreatedAt))
+	assert.Equal(t, user.PasswordHash, found.PasswordHash)
+
+	assert.ErrorIs(t, repo.Update(ctx, &models.User{ID: "missing", Username: "x", Email: "x@example.com"}), ErrUserNotFound)
+	assert.ErrorIs(t, repo.Delete(ctx, "missing"), ErrUserNotFound)
+}
+
+// TestStore runs the same checks against every Store implementation
+func TestStore(t *testing.T) {
+	implementations := map[string]func(t *testing.T) Store{
+		"InMemory": func(t *testing.T) Store { return NewInMemoryStore() },
+		"SQL":      func(t *testing.T) Store { return newTestSQLStore(t) },
+	}
+
+	for name, newStore := range implementations {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			t.Run("Tokens", func(t *testing.T) { testTokenRepository(t, store.Tokens()) })
+			t.Run("AccessTokens", func(t *testing.T) { testAccessTokenRepository(t, store.AccessTokens()) })
+			t.Run("Outbox", func(t *testing.T) { testOutboxRepository(t, store.Outbox()) })
+			t.Run("Cancellation", func(t *testing.T) { testStoreCancellation(t, newStore(t)) })
+		})
+	}
+}
+
+// testStoreCancellation checks that a store does nothing for a cancelled
+// context and returns the context's error
+func testStoreCancellation(t *testing.T, store Store) {
+	require.NoError(t, store.Users().Create(t.Context(), newTestUser("1", "alice", "alice@example.com")))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	assert.ErrorIs(t, store.Ping(ctx), context.Canceled)
+	_, err := store.Users().GetByID(ctx, "1")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, store.Users().Create(ctx, newTestUser("2", "bob", "bob@example.com")), context.Canceled)
+	assert.ErrorIs(t, store.Users().Delete(ctx, "1"), context.Canceled)
+	_, _, err = store.Users().List(ctx, UserFilter{})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	now := time.Now()
+	session := &models.Session{ID: "s1", UserID: "1", CreatedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)}
+	assert.ErrorIs(t, store.Tokens().Store(ctx, "token", session), context.Canceled)
+	_, err = store.Tokens().ListSessions(ctx, "1")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	called := false
+	err = store.Atomic(ctx, func(tx Store) error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, called, "function run for a cancelled context")
+
+	// Nothing was changed
+	ctx = t.Context()
+	assert.NoError(t, store.Ping(ctx))
+	_, err = store.Users().GetByID(ctx, "1")
+	assert.NoError(t, err)
+	_, err = store.Users().GetByID(ctx, "2")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	sessions, err := store.Tokens().ListSessions(ctx, "1")
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func testTokenRepository(t *testing.T, repo TokenRepository) {
+	ctx := t.Context()
+	now := time.Now()
+	session := func(id, userID string, expiresAt time.Time) *models.Session {
+		return &models.Session{
+			ID:                id,
+			UserID:            userID,
+			Name:              "Firefox on Linux",
+			CreatedAt:         now,
+			LastUsedAt:        now,
+			ExpiresAt:         expiresAt,
+			IdleTimeout:       time.Hour,
+			AbsoluteExpiresAt: now.Add(24 * time.Hour),
+		}
+	}
+	require.NoError(t, repo.Store(ctx, "token1", session("s1", "alice", now.Add(time.Hour))))
+	require.NoError(t, repo.Store(ctx, "token2", session("s2", "alice", now.Add(time.Hour))))
+	require.NoError(t, repo.Store(ctx, "token3", session("s3", "bob", now.Add(time.Hour))))
+	require.NoError(t, repo.Store(ctx, "expired", session("s4", "bob", now.Add(-time.Minute))))
+	assert.ErrorIs(t, repo.Store(ctx, "token1", session("s5", "bob", now)), ErrTokenAlreadyExists)
+	active, err := repo.CountActive(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, active)
+
+	found, err := repo.GetSessionByToken(ctx, "token1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", found.UserID)
+	assert.Equal(t, time.Hour, found.IdleTimeout)
+	_, err = repo.GetSessionByToken(ctx, "expired")
+	assert.ErrorIs(t, err, ErrTokenExpired)
+	_, err = repo.GetUserIDByToken(ctx, "missing")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	byID, err := repo.GetSession(ctx, "s3")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", byID.UserID)
+	_, err = repo.GetSession(ctx, "s4")
+	assert.ErrorIs(t, err, ErrTokenExpired)
+	_, err = repo.GetSession(ctx, "missing")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	found.LastUsedAt = now.Add(time.Minute)
+	require.NoError(t, repo.Rotate(ctx, "token1", "token1b", found))
+	assert.ErrorIs(t, repo.Rotate(ctx, "token1", "token1c", found), ErrTokenNotFound)
+	_, err = repo.GetSessionByToken(ctx, "token1")
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+	rotated, err := repo.GetSessionByToken(ctx, "token1b")
+	require.NoError(t, err)
+	assert.Equal(t, "s1", rotated.ID)
+
+	assert.ErrorIs(t, repo.DeleteSession(ctx, "bob", "s1"), ErrSessionNotFound)
+	require.NoError(t, repo.DeleteAllForUserExcept(ctx, "alice", "s1"))
+	sessions, err := repo.ListSessions(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "s1", sessions[0].ID)
+
+	purged, err := repo.PurgeExpired(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	require.NoError(t, repo.DeleteByToken(ctx, "token1b"))
+	assert.ErrorIs(t, repo.DeleteByToken(ctx, "token1b"), ErrTokenNotFound)
+	require.NoError(t, repo.DeleteAllForUser(ctx, "bob"))
+	sessions, err = repo.ListSessions(ctx, "bob")
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func testAccessTokenRepository(t *testing.T, repo AccessTokenRepository) {
+	ctx := t.Context()
+	now := time.Unix(1700000000, 0)
+	expiresAt := now.Add(time.Hour)
+	token := func(id, userID, hash string, createdAt time.Time) *models.PersonalAccessToken {
+		return &models.PersonalAccessToken{
+			ID:        id,
+			UserID:    userID,
+			Name:      "deploy script",
+			Prefix:    "pat_" + id,
+			TokenHash: hash,
+			Scopes:    []string{models.ScopeProfileRead, models.ScopeSessionsRead},
+			CreatedAt: createdAt,
+			ExpiresAt: &expiresAt,
+		}
+	}
+	require.NoError(t, repo.Create(ctx, token("t1", "alice", "hash1", now)))
+	require.NoError(t, repo.Create(ctx, token("t2", "alice", "hash2", now.Add(time.Minute))))
+	require.NoError(t, repo.Create(ctx, token("t3", "bob", "hash3", now)))
+	assert.ErrorIs(t, repo.Create(ctx, token("t4", "bob", "hash1", now)), ErrAccessTokenAlreadyExists)
+
+	found, err := repo.GetByHash(ctx, "hash1")
+	require.NoError(t, err)
+	assert.Equal(t, "t1", found.ID)
+	assert.Equal(t, []string{models.ScopeProfileRead, models.ScopeSessionsRead}, found.Scopes)
+	assert.True(t, found.ExpiresAt.Equal(expiresAt))
+	assert.Nil(t, found.LastUsedAt)
+	_, err = repo.GetByHash(ctx, "missing")
+	assert.ErrorIs(t, err, ErrAccessTokenNotFound)
+
+	require.NoError(t, repo.Touch(ctx, "t1", now.Add(time.Second)))
+	assert.ErrorIs(t, repo.Touch(ctx, "missing", now), ErrAccessTokenNotFound)
+	tokens, err := repo.ListByUser(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, "t2", tokens[0].ID)
+	assert.True(t, tokens[1].LastUsedAt.Equal(now.Add(time.Second)))
+
+	assert.ErrorIs(t, repo.Delete(ctx, "bob", "t1"), ErrAccessTokenNotFound)
+	require.NoError(t, repo.Delete(ctx, "alice", "t1"))
+	require.NoError(t, repo.DeleteAllForUser(ctx, "alice"))
+	tokens, err = repo.ListByUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, tokens)
+	_, err = repo.GetByHash(ctx, "hash3")
+	assert.NoError(t, err)
+}
+
+func testOutboxRepository(t *testing.T, repo OutboxRepository) {
+	ctx := t.Context()
+	start := time.Unix(1700000000, 0)
+	for i, id := range []string{"e2", "e1", "e3"} {
+		require.NoError(t, repo.Add(ctx, &models.OutboxRecord{
+			ID:        id,
+			EventType: "user.registered",
+			Payload:   []byte(`{"id":"` + id + `"}`),
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+		}))
+	}
+
+	now := time.Now()
+	pending, err := repo.Pending(ctx, now, 2)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, "e2", pending[0].ID)
+	assert.Equal(t, "e1", pending[1].ID)
+	assert.JSONEq(t, `{"id":"e2"}`, string(pending[0].Payload))
+
+	// A failed record is not due until its next attempt, and a dead one
+	// never is
+	retry := pending[0]
+	retry.Attempts = 1
+	retry.NextAttemptAt = now.Add(time.Minute)
+	retry.LastError = "subscriber failed"
+	retry.Handled = []string{"welcome_mail", "webhooks"}
+	require.NoError(t, repo.Update(ctx, retry))
+	dead := pending[1]
+	dead.Attempts = 3
+	dead.DeadAt = &now
+	require.NoError(t, repo.Update(ctx, dead))
+	pending, err = repo.Pending(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "e3", pending[0].ID)
+
+	pending, err = repo.Pending(ctx, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, "e2", pending[0].ID)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, "subscriber failed", pending[0].LastError)
+	assert.Equal(t, []string{"welcome_mail", "webhooks"}, pending[0].Handled)
+	assert.Nil(t, pending[0].DeadAt)
+
+	require.NoError(t, repo.Delete(ctx, "e2"))
+	require.NoError(t, repo.Delete(ctx, "e2"))
+	pending, err = repo.Pending(ctx, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
+
+func TestSQLStoreAtomic(t *testing.T) {
+	ctx := t.Context()
+	store := newTestSQLStore(t)
+	failure := errors.New("failure")
+
+	err := store.Atomic(ctx, func(tx Store) error {
+		require.NoError(t, tx.Users().Create(ctx, newTestUser("1", "alice", "alice@example.com")))
+		require.NoError(t, tx.Outbox().Add(ctx, &models.OutboxRecord{ID: "e1", EventType: "user.registered", CreatedAt: time.Now()}))
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	_, err = store.Users().GetByID(ctx, "1")
+	assert.ErrorIs(t, err, ErrUserNotFound, "user created in a failed transaction was kept")
+	pending, err := store.Outbox().Pending(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending, "event of a failed transaction was kept")
+
+	err = store.Atomic(ctx, func(tx Store) error {
+		if err := tx.Users().Create(ctx, newTestUser("1", "alice", "alice@example.com")); err != nil {
+			return err
+		}
+		// Nested calls join the transaction
+		return tx.Atomic(ctx, func(tx Store) error {
+			return tx.Outbox().Add(ctx, &models.OutboxRecord{ID: "e1", EventType: "user.registered", CreatedAt: time.Now()})
+		})
+	})
+	require.NoError(t, err)
+	_, err = store.Users().GetByID(ctx, "1")
+	require.NoError(t, err)
+	pending, err = store.Outbox().Pending(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Len(t, pending, 1)
+}
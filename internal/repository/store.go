@@ -0,0 +1,70 @@
+package repository
+
+import "context"
+
+// Store groups the repositories whose changes can be committed together
+type Store interface {
+	Users() UserRepository
+	Tokens() TokenRepository
+	AccessTokens() AccessTokenRepository
+	Outbox() OutboxRepository
+	// Atomic runs fn with a Store whose changes are committed together if
+	// fn returns nil and discarded if it returns an error or ctx is
+	// cancelled
+	Atomic(ctx context.Context, fn func(tx Store) error) error
+	// Ping checks that the store's backend can be reached
+	Ping(ctx context.Context) error
+}
+
+// InMemoryStore implements Store with in-memory repositories. They have no
+// transactions, so Atomic cannot discard the changes of a function that
+// fails; each repository method is still atomic on its own.
+type InMemoryStore struct {
+	users        *InMemoryUserRepository
+	tokens       *InMemoryTokenRepository
+	accessTokens *InMemoryAccessTokenRepository
+	outbox       *InMemoryOutboxRepository
+}
+
+// NewInMemoryStore creates a store with empty in-memory repositories
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		users:        NewInMemoryUserRepository(),
+		tokens:       NewInMemoryTokenRepository(),
+		accessTokens: NewInMemoryAccessTokenRepository(),
+		outbox:       NewInMemoryOutboxRepository(),
+	}
+}
+
+// Users returns the user repository
+func (s *InMemoryStore) Users() UserRepository {
+	return s.users
+}
+
+// Tokens returns the refresh token repository
+func (s *InMemoryStore) Tokens() TokenRepository {
+	return s.tokens
+}
+
+// AccessTokens returns the personal access token repository
+func (s *InMemoryStore) AccessTokens() AccessTokenRepository {
+	return s.accessTokens
+}
+
+// Outbox returns the outbox repository
+func (s *InMemoryStore) Outbox() OutboxRepository {
+	return s.outbox
+}
+
+// Atomic runs fn with the store itself, unless ctx is already cancelled
+func (s *InMemoryStore) Atomic(ctx context.Context, fn func(tx Store) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(s)
+}
+
+// Ping always succeeds, as the repositories are in memory
+func (s *InMemoryStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
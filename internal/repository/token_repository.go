@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"learn/internal/models"
 	"sync"
 	"time"
 )
@@ -10,91 +12,303 @@ var (
 	ErrTokenNotFound      = errors.New("token not found")
 	ErrTokenAlreadyExists = errors.New("token already exists")
 	ErrTokenExpired       = errors.New("token expired")
+	ErrSessionNotFound    = errors.New("session not found")
 )
 
-// TokenRepository defines the interface for token data access
+// TokenRepository defines the interface for refresh token and session data
+// access. Like UserRepository, its methods honour context cancellation.
 type TokenRepository interface {
-	Store(userID, refreshToken string, expiresAt time.Time) error
-	GetUserIDByToken(refreshToken string) (string, error)
-	DeleteByToken(refreshToken string) error
-	DeleteAllForUser(userID string) error
+	// Store adds a new session with its first refresh token
+	Store(ctx context.Context, refreshToken string, session *models.Session) error
+	GetUserIDByToken(ctx context.Context, refreshToken string) (string, error)
+	GetSessionByToken(ctx context.Context, refreshToken string) (*models.Session, error)
+	// GetSession retrieves a session by its ID
+	GetSession(ctx context.Context, sessionID string) (*models.Session, error)
+	// Rotate atomically replaces a session's refresh token and updates the session
+	Rotate(ctx context.Context, oldToken, newToken string, session *models.Session) error
+	ListSessions(ctx context.Context, userID string) ([]*models.Session, error)
+	DeleteSession(ctx context.Context, userID, sessionID string) error
+	DeleteByToken(ctx context.Context, refreshToken string) error
+	DeleteAllForUser(ctx context.Context, userID string) error
+	// DeleteAllForUserExcept removes all of a user's sessions but one
+	DeleteAllForUserExcept(ctx context.Context, userID, sessionID string) error
+	// PurgeExpired removes expired tokens and returns how many were removed
+	PurgeExpired(ctx context.Context) (int, error)
+	// CountActive returns the number of sessions whose refresh token has
+	// not expired
+	CountActive(ctx context.Context) (int, error)
 }
 
-// InMemoryTokenRepository implements TokenRepository with an in-memory store
+// InMemoryTokenRepository implements TokenRepository with an in-memory
+// store. Cancellation is checked before each operation.
 type InMemoryTokenRepository struct {
-	// Map of refresh tokens to user IDs and expiration times
-	tokens map[string]tokenInfo
-	mutex  sync.RWMutex
+	// Map of refresh tokens to session IDs
+	tokens map[string]string
+	// Map of session IDs to sessions and their current refresh token
+	sessions map[string]*sessionEntry
+	// Map of user IDs to their session IDs
+	userSessions map[string]map[string]struct{}
+	mutex        sync.RWMutex
 }
 
-type tokenInfo struct {
-	UserID    string
-	ExpiresAt time.Time
+type sessionEntry struct {
+	session      models.Session
+	refreshToken string
 }
 
 // NewInMemoryTokenRepository creates a new in-memory token repository
 func NewInMemoryTokenRepository() *InMemoryTokenRepository {
 	return &InMemoryTokenRepository{
-		tokens: make(map[string]tokenInfo),
+		tokens:       make(map[string]string),
+		sessions:     make(map[string]*sessionEntry),
+		userSessions: make(map[string]map[string]struct{}),
 	}
 }
 
-// Store adds a new refresh token to the repository
-func (r *InMemoryTokenRepository) Store(userID, refreshToken string, expiresAt time.Time) error {
+// Store adds a new session and its refresh token to the repository
+func (r *InMemoryTokenRepository) Store(ctx context.Context, refreshToken string, session *models.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	if _, exists := r.tokens[refreshToken]; exists {
 		return ErrTokenAlreadyExists
 	}
+	if _, exists := r.sessions[session.ID]; exists {
+		return ErrTokenAlreadyExists
+	}
 
-	r.tokens[refreshToken] = tokenInfo{
-		UserID:    userID,
-		ExpiresAt: expiresAt,
+	r.tokens[refreshToken] = session.ID
+	r.sessions[session.ID] = &sessionEntry{
+		session:      *session,
+		refreshToken: refreshToken,
+	}
+	if r.userSessions[session.UserID] == nil {
+		r.userSessions[session.UserID] = make(map[string]struct{})
 	}
+	r.userSessions[session.UserID][session.ID] = struct{}{}
 	return nil
 }
 
 // GetUserIDByToken retrieves a user ID by refresh token
-func (r *InMemoryTokenRepository) GetUserIDByToken(refreshToken string) (string, error) {
+func (r *InMemoryTokenRepository) GetUserIDByToken(ctx context.Context, refreshToken string) (string, error) {
+	session, err := r.GetSessionByToken(ctx, refreshToken)
+	if err != nil {
+		return "", err
+	}
+	return session.UserID, nil
+}
+
+// GetSessionByToken retrieves the session a refresh token belongs to
+func (r *InMemoryTokenRepository) GetSessionByToken(ctx context.Context, refreshToken string) (*models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	info, exists := r.tokens[refreshToken]
+	sessionID, exists := r.tokens[refreshToken]
 	if !exists {
-		return "", ErrTokenNotFound
+		return nil, ErrTokenNotFound
 	}
+	entry := r.sessions[sessionID]
 
 	// Check if token is expired
-	if time.Now().After(info.ExpiresAt) {
-		return "", ErrTokenExpired
+	if time.Now().After(entry.session.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	session := entry.session
+	return &session, nil
+}
+
+// GetSession retrieves a session by its ID
+func (r *InMemoryTokenRepository) GetSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return info.UserID, nil
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	entry, exists := r.sessions[sessionID]
+	if !exists {
+		return nil, ErrSessionNotFound
+	}
+	if time.Now().After(entry.session.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	session := entry.session
+	return &session, nil
 }
 
-// DeleteByToken removes a refresh token
-func (r *InMemoryTokenRepository) DeleteByToken(refreshToken string) error {
+// Rotate replaces a session's refresh token with a new one
+func (r *InMemoryTokenRepository) Rotate(ctx context.Context, oldToken, newToken string, session *models.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, exists := r.tokens[refreshToken]; !exists {
+	sessionID, exists := r.tokens[oldToken]
+	if !exists || sessionID != session.ID {
 		return ErrTokenNotFound
 	}
+	if _, exists := r.tokens[newToken]; exists {
+		return ErrTokenAlreadyExists
+	}
 
-	delete(r.tokens, refreshToken)
+	delete(r.tokens, oldToken)
+	r.tokens[newToken] = session.ID
+	r.sessions[session.ID] = &sessionEntry{
+		session:      *session,
+		refreshToken: newToken,
+	}
+	return nil
+}
+
+// ListSessions returns all sessions of a user, including expired ones that
+// have not been purged yet
+func (r *InMemoryTokenRepository) ListSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	sessions := make([]*models.Session, 0, len(r.userSessions[userID]))
+	for sessionID := range r.userSessions[userID] {
+		session := r.sessions[sessionID].session
+		sessions = append(sessions, &session)
+	}
+	return sessions, nil
+}
+
+// DeleteSession removes one of a user's sessions
+func (r *InMemoryTokenRepository) DeleteSession(ctx context.Context, userID, sessionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entry, exists := r.sessions[sessionID]
+	if !exists || entry.session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	r.deleteSession(entry)
+	return nil
+}
+
+// DeleteByToken removes a refresh token and its session
+func (r *InMemoryTokenRepository) DeleteByToken(ctx context.Context, refreshToken string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	sessionID, exists := r.tokens[refreshToken]
+	if !exists {
+		return ErrTokenNotFound
+	}
+
+	r.deleteSession(r.sessions[sessionID])
 	return nil
 }
 
 // DeleteAllForUser removes all refresh tokens for a user
-func (r *InMemoryTokenRepository) DeleteAllForUser(userID string) error {
+func (r *InMemoryTokenRepository) DeleteAllForUser(ctx context.Context, userID string) error {
+	return r.DeleteAllForUserExcept(ctx, userID, "")
+}
+
+// DeleteAllForUserExcept removes all refresh tokens for a user except those
+// of the given session
+func (r *InMemoryTokenRepository) DeleteAllForUserExcept(ctx context.Context, userID, sessionID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	for token, info := range r.tokens {
-		if info.UserID == userID {
-			delete(r.tokens, token)
+	for id := range r.userSessions[userID] {
+		if id != sessionID {
+			r.deleteSession(r.sessions[id])
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// purgeCheckInterval is how many sessions PurgeExpired examines between
+// checks for cancellation
+const purgeCheckInterval = 1024
+
+// PurgeExpired removes all sessions whose refresh token has expired
+func (r *InMemoryTokenRepository) PurgeExpired(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	purged, examined := 0, 0
+	for _, entry := range r.sessions {
+		examined++
+		if examined%purgeCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return purged, err
+			}
+		}
+		if now.After(entry.session.ExpiresAt) {
+			r.deleteSession(entry)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// CountActive returns the number of sessions whose refresh token has not
+// expired
+func (r *InMemoryTokenRepository) CountActive(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	now := time.Now()
+	active := 0
+	for _, entry := range r.sessions {
+		if !now.After(entry.session.ExpiresAt) {
+			active++
+		}
+	}
+	return active, nil
+}
+
+// deleteSession removes a session, its token and its user index entry.
+// The caller must hold the write lock.
+func (r *InMemoryTokenRepository) deleteSession(entry *sessionEntry) {
+	delete(r.tokens, entry.refreshToken)
+	delete(r.sessions, entry.session.ID)
+
+	userSessions := r.userSessions[entry.session.UserID]
+	delete(userSessions, entry.session.ID)
+	if len(userSessions) == 0 {
+		delete(r.userSessions, entry.session.UserID)
+	}
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"learn/internal/models"
+	"learn/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("learn/internal/repository")
+
+// TracedStore wraps a Store, recording a span for each call to its user and
+// refresh token repositories. Stores passed to Atomic functions are traced
+// too.
+type TracedStore struct {
+	Store
+}
+
+// NewTracedStore wraps a store with tracing
+func NewTracedStore(store Store) *TracedStore {
+	return &TracedStore{Store: store}
+}
+
+// Users returns the traced user repository
+func (s *TracedStore) Users() UserRepository {
+	return tracedUserRepository{s.Store.Users()}
+}
+
+// Tokens returns the traced refresh token repository
+func (s *TracedStore) Tokens() TokenRepository {
+	return tracedTokenRepository{s.Store.Tokens()}
+}
+
+// Atomic runs fn in a transaction of the wrapped store
+func (s *TracedStore) Atomic(ctx context.Context, fn func(tx Store) error) error {
+	return traced(ctx, "Store.Atomic", func(ctx context.Context) error {
+		return s.Store.Atomic(ctx, func(tx Store) error {
+			return fn(&TracedStore{Store: tx})
+		})
+	})
+}
+
+// expectedErrors are returned in the normal course of operation, such as
+// when a login names an unknown user, and do not mark a span as failed
+var expectedErrors = []error{
+	ErrUserNotFound, ErrUserAlreadyExists,
+	ErrTokenNotFound, ErrTokenAlreadyExists, ErrTokenExpired, ErrSessionNotFound,
+}
+
+// endSpan ends a repository span, recording expected errors as the result
+// and marking the span as failed for any other error
+func endSpan(span trace.Span, err error) {
+	for _, expected := range expectedErrors {
+		if errors.Is(err, expected) {
+			span.SetAttributes(attribute.String("repository.result", err.Error()))
+			err = nil
+			break
+		}
+	}
+	tracing.End(span, err)
+}
+
+// traced runs a repository call in a span
+func traced(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	ctx, span := tracer.Start(ctx, name)
+	err := fn(ctx)
+	endSpan(span, err)
+	return err
+}
+
+// tracedValue runs a repository call returning a value in a span
+func tracedValue[T any](ctx context.Context, name string, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, span := tracer.Start(ctx, name)
+	value, err := fn(ctx)
+	endSpan(span, err)
+	return value, err
+}
+
+type tracedUserRepository struct {
+	repo UserRepository
+}
+
+func (r tracedUserRepository) Create(ctx context.Context, user *models.User) error {
+	return traced(ctx, "UserRepository.Create", func(ctx context.Context) error {
+		return r.repo.Create(ctx, user)
+	})
+}
+
+func (r tracedUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	return tracedValue(ctx, "UserRepository.GetByID", func(ctx context.Context) (*models.User, error) {
+		return r.repo.GetByID(ctx, id)
+	})
+}
+
+func (r tracedUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	return tracedValue(ctx, "UserRepository.GetByUsername", func(ctx context.Context) (*models.User, error) {
+		return r.repo.GetByUsername(ctx, username)
+	})
+}
+
+func (r tracedUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return tracedValue(ctx, "UserRepository.GetByEmail", func(ctx context.Context) (*models.User, error) {
+		return r.repo.GetByEmail(ctx, email)
+	})
+}
+
+func (r tracedUserRepository) Update(ctx context.Context, user *models.User) error {
+	return traced(ctx, "UserRepository.Update", func(ctx context.Context) error {
+		return r.repo.Update(ctx, user)
+	})
+}
+
+func (r tracedUserRepository) Delete(ctx context.Context, id string) error {
+	return traced(ctx, "UserRepository.Delete", func(ctx context.Context) error {
+		return r.repo.Delete(ctx, id)
+	})
+}
+
+func (r tracedUserRepository) List(ctx context.Context, filter UserFilter) ([]*models.User, int, error) {
+	var total int
+	users, err := tracedValue(ctx, "UserRepository.List", func(ctx context.Context) ([]*models.User, error) {
+		users, n, err := r.repo.List(ctx, filter)
+		total = n
+		return users, err
+	})
+	return users, total, err
+}
+
+func (r tracedUserRepository) Count(ctx context.Context) (int, error) {
+	return tracedValue(ctx, "UserRepository.Count", r.repo.Count)
+}
+
+type tracedTokenRepository struct {
+	repo TokenRepository
+}
+
+func (r tracedTokenRepository) Store(ctx context.Context, refreshToken string, session *models.Session) error {
+	return traced(ctx, "TokenRepository.Store", func(ctx context.Context) error {
+		return r.repo.Store(ctx, refreshToken, session)
+	})
+}
+
+func (r tracedTokenRepository) GetUserIDByToken(ctx context.Context, refreshToken string) (string, error) {
+	return tracedValue(ctx, "TokenRepository.GetUserIDByToken", func(ctx context.Context) (string, error) {
+		return r.repo.GetUserIDByToken(ctx, refreshToken)
+	})
+}
+
+func (r tracedTokenRepository) GetSessionByToken(ctx context.Context, refreshToken string) (*models.Session, error) {
+	return tracedValue(ctx, "TokenRepository.GetSessionByToken", func(ctx context.Context) (*models.Session, error) {
+		return r.repo.GetSessionByToken(ctx, refreshToken)
+	})
+}
+
+func (r tracedTokenRepository) GetSession(ctx context.Context, sessionID string) (*models.Session, error) {
+	return tracedValue(ctx, "TokenRepository.GetSession", func(ctx context.Context) (*models.Session, error) {
+		return r.repo.GetSession(ctx, sessionID)
+	})
+}
+
+func (r tracedTokenRepository) Rotate(ctx context.Context, oldToken, newToken string, session *models.Session) error {
+	return traced(ctx, "TokenRepository.Rotate", func(ctx context.Context) error {
+		return r.repo.Rotate(ctx, oldToken, newToken, session)
+	})
+}
+
+func (r tracedTokenRepository) ListSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	return tracedValue(ctx, "TokenRepository.ListSessions", func(ctx context.Context) ([]*models.Session, error) {
+		return r.repo.ListSessions(ctx, userID)
+	})
+}
+
+func (r tracedTokenRepository) DeleteSession(ctx context.Context, userID, sessionID string) error {
+	return traced(ctx, "TokenRepository.DeleteSession", func(ctx context.Context) error {
+		return r.repo.DeleteSession(ctx, userID, sessionID)
+	})
+}
+
+func (r tracedTokenRepository) DeleteByToken(ctx context.Context, refreshToken string) error {
+	return traced(ctx, "TokenRepository.DeleteByToken", func(ctx context.Context) error {
+		return r.repo.DeleteByToken(ctx, refreshToken)
+	})
+}
+
+func (r tracedTokenRepository) DeleteAllForUser(ctx context.Context, userID string) error {
+	return traced(ctx, "TokenRepository.DeleteAllForUser", func(ctx context.Context) error {
+		return r.repo.DeleteAllForUser(ctx, userID)
+	})
+}
+
+func (r tracedTokenRepository) DeleteAllForUserExcept(ctx context.Context, userID, sessionID string) error {
+	return traced(ctx, "TokenRepository.DeleteAllForUserExcept", func(ctx context.Context) error {
+		return r.repo.DeleteAllForUserExcept(ctx, userID, sessionID)
+	})
+}
+
+func (r tracedTokenRepository) PurgeExpired(ctx context.Context) (int, error) {
+	return tracedValue(ctx, "TokenRepository.PurgeExpired", r.repo.PurgeExpired)
+}
+
+func (r tracedTokenRepository) CountActive(ctx context.Context) (int, error) {
+	return tracedValue(ctx, "TokenRepository.CountActive", r.repo.CountActive)
+}
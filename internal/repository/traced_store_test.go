@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedStore(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+
+	store := NewTracedStore(NewInMemoryStore())
+	ctx, parent := provider.Tracer("test").Start(t.Context(), "request")
+
+	_, err := store.Users().GetByUsername(ctx, "alice")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	require.NoError(t, store.Atomic(ctx, func(tx Store) error {
+		return tx.Users().Create(ctx, newTestUser("1", "alice", "alice@example.com"))
+	}))
+	_, err = store.Tokens().CountActive(ctx)
+	require.NoError(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 5)
+	names := []string{}
+	for _, span := range spans[:4] {
+		names = append(names, span.Name)
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+	}
+	assert.Equal(t, []string{"UserRepository.GetByUsername", "UserRepository.Create", "Store.Atomic", "TokenRepository.CountActive"}, names)
+
+	// A missing user is an expected result, not a failure
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+	assert.Contains(t, spans[0].Attributes, attribute.String("repository.result", ErrUserNotFound.Error()))
+}
@@ -1,9 +1,14 @@
 package repository
 
 import (
+	"context"
 	"errors"
 	"learn/internal/models"
+	"learn/internal/utils"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -11,50 +16,123 @@ var (
 	ErrUserAlreadyExists = errors.New("user already exists")
 )
 
-// UserRepository defines the interface for user data access
+// UserRepository defines the interface for user data access. Every method
+// returns the context's error without acting once it is cancelled or its
+// deadline has passed.
 type UserRepository interface {
-	Create(user *models.User) error
-	GetByID(id string) (*models.User, error)
-	GetByUsername(username string) (*models.User, error)
-	GetByEmail(email string) (*models.User, error)
-	Update(user *models.User) error
-	Delete(id string) error
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id string) (*models.User, error)
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	Update(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id string) error
+	// List returns one page of the users matching a filter, oldest first,
+	// and the total number of matching users
+	List(ctx context.Context, filter UserFilter) ([]*models.User, int, error)
+	// Count returns the number of users
+	Count(ctx context.Context) (int, error)
 }
 
-// InMemoryUserRepository implements UserRepository with an in-memory store
+// UserFilter selects and paginates users in a listing
+type UserFilter struct {
+	// Query matches users whose normalized username or email contains it
+	Query string
+	// Role matches users with the role, if set
+	Role string
+	// Status matches users whose effective account status is the status, if set
+	Status string
+	Offset int
+	Limit  int
+}
+
+// Matches reports whether a user satisfies the filter's criteria
+func (f UserFilter) Matches(user *models.User) bool {
+	if f.Role != "" && user.Role != f.Role {
+		return false
+	}
+	if f.Status != "" && user.EffectiveStatus(time.Now()) != f.Status {
+		return false
+	}
+	if f.Query != "" {
+		query := utils.NormalizeIdentifier(f.Query)
+		if !strings.Contains(utils.NormalizeIdentifier(user.Username), query) &&
+			!strings.Contains(utils.NormalizeIdentifier(user.Email), query) {
+			return false
+		}
+	}
+	return true
+}
+
+// InMemoryUserRepository implements UserRepository with an in-memory store.
+// Usernames and emails are compared by their normalized form, and usernames
+// that are visually confusable with an existing one are rejected. Secondary
+// indexes make every lookup constant time. Cancellation is checked before
+// each operation; once started, an operation completes.
 type InMemoryUserRepository struct {
 	users map[string]*models.User
-	mutex sync.RWMutex
+	// Secondary indexes from normalized username, username skeleton and
+	// normalized email to user ID
+	byUsername map[string]string
+	bySkeleton map[string]string
+	byEmail    map[string]string
+	mutex      sync.RWMutex
+}
+
+// userKeys holds the index keys of a user
+type userKeys struct {
+	username string
+	skeleton string
+	email    string
+}
+
+func keysFor(user *models.User) userKeys {
+	return userKeys{
+		username: utils.NormalizeIdentifier(user.Username),
+		skeleton: utils.UsernameSkeleton(user.Username),
+		email:    utils.NormalizeIdentifier(user.Email),
+	}
 }
 
 // NewInMemoryUserRepository creates a new in-memory user repository
 func NewInMemoryUserRepository() *InMemoryUserRepository {
 	return &InMemoryUserRepository{
-		users: make(map[string]*models.User),
+		users:      make(map[string]*models.User),
+		byUsername: make(map[string]string),
+		bySkeleton: make(map[string]string),
+		byEmail:    make(map[string]string),
 	}
 }
 
 // Create adds a new user to the repository
-func (r *InMemoryUserRepository) Create(user *models.User) error {
+func (r *InMemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	// Check if user with same username or email already exists
-	for _, existingUser := range r.users {
-		if existingUser.Username == user.Username {
-			return ErrUserAlreadyExists
-		}
-		if existingUser.Email == user.Email {
-			return ErrUserAlreadyExists
-		}
+	if _, exists := r.users[user.ID]; exists {
+		return ErrUserAlreadyExists
+	}
+
+	// Check if user with same or confusable username, or same email already exists
+	keys := keysFor(user)
+	if r.conflicts(keys, "") {
+		return ErrUserAlreadyExists
 	}
 
-	r.users[user.ID] = user
+	r.users[user.ID] = copyUser(user)
+	r.index(keys, user.ID)
 	return nil
 }
 
 // GetByID retrieves a user by ID
-func (r *InMemoryUserRepository) GetByID(id string) (*models.User, error) {
+func (r *InMemoryUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
@@ -62,55 +140,170 @@ func (r *InMemoryUserRepository) GetByID(id string) (*models.User, error) {
 	if !exists {
 		return nil, ErrUserNotFound
 	}
-	return user, nil
+	return copyUser(user), nil
 }
 
 // GetByUsername retrieves a user by username
-func (r *InMemoryUserRepository) GetByUsername(username string) (*models.User, error) {
+func (r *InMemoryUserRepository) GetByUsername(ctx context.Context, username string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	for _, user := range r.users {
-		if user.Username == username {
-			return user, nil
-		}
+	id, exists := r.byUsername[utils.NormalizeIdentifier(username)]
+	if !exists {
+		return nil, ErrUserNotFound
 	}
-	return nil, ErrUserNotFound
+	return copyUser(r.users[id]), nil
 }
 
 // GetByEmail retrieves a user by email
-func (r *InMemoryUserRepository) GetByEmail(email string) (*models.User, error) {
+func (r *InMemoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	for _, user := range r.users {
-		if user.Email == email {
-			return user, nil
-		}
+	id, exists := r.byEmail[utils.NormalizeIdentifier(email)]
+	if !exists {
+		return nil, ErrUserNotFound
 	}
-	return nil, ErrUserNotFound
+	return copyUser(r.users[id]), nil
 }
 
 // Update updates an existing user
-func (r *InMemoryUserRepository) Update(user *models.User) error {
+func (r *InMemoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, exists := r.users[user.ID]; !exists {
+	existing, exists := r.users[user.ID]
+	if !exists {
 		return ErrUserNotFound
 	}
-	r.users[user.ID] = user
+
+	// Re-index if the username or email changed
+	oldKeys, newKeys := keysFor(existing), keysFor(user)
+	if oldKeys != newKeys {
+		if r.conflicts(newKeys, user.ID) {
+			return ErrUserAlreadyExists
+		}
+		r.unindex(oldKeys)
+		r.index(newKeys, user.ID)
+	}
+
+	r.users[user.ID] = copyUser(user)
 	return nil
 }
 
 // Delete removes a user by ID
-func (r *InMemoryUserRepository) Delete(id string) error {
+func (r *InMemoryUserRepository) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if _, exists := r.users[id]; !exists {
+	user, exists := r.users[id]
+	if !exists {
 		return ErrUserNotFound
 	}
+	r.unindex(keysFor(user))
 	delete(r.users, id)
 	return nil
-}
\ No newline at end of file
+}
+
+// List returns one page of the users matching a filter. Listing scans every
+// user, which is acceptable for infrequent administrative use.
+func (r *InMemoryUserRepository) List(ctx context.Context, filter UserFilter) ([]*models.User, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	matched := make([]*models.User, 0)
+	for _, user := range r.users {
+		if filter.Matches(user) {
+			matched = append(matched, user)
+		}
+	}
+	// Sort by creation time, then ID, so pages are stable
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+		}
+		return matched[i].ID < matched[j].ID
+	})
+
+	total := len(matched)
+	start := min(max(filter.Offset, 0), total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+
+	users := make([]*models.User, 0, end-start)
+	for _, user := range matched[start:end] {
+		users = append(users, copyUser(user))
+	}
+	return users, total, nil
+}
+
+// Count returns the number of users
+func (r *InMemoryUserRepository) Count(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.users), nil
+}
+
+// conflicts reports whether any of the keys belongs to a user other than
+// the one with the given ID
+func (r *InMemoryUserRepository) conflicts(keys userKeys, id string) bool {
+	for _, lookup := range []struct {
+		index map[string]string
+		key   string
+	}{
+		{r.byUsername, keys.username},
+		{r.bySkeleton, keys.skeleton},
+		{r.byEmail, keys.email},
+	} {
+		if owner, exists := lookup.index[lookup.key]; exists && owner != id {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *InMemoryUserRepository) index(keys userKeys, id string) {
+	r.byUsername[keys.username] = id
+	r.bySkeleton[keys.skeleton] = id
+	r.byEmail[keys.email] = id
+}
+
+func (r *InMemoryUserRepository) unindex(keys userKeys) {
+	delete(r.byUsername, keys.username)
+	delete(r.bySkeleton, keys.skeleton)
+	delete(r.byEmail, keys.email)
+}
+
+// copyUser returns a copy of the user, so callers cannot modify stored
+// users, and with them the indexed fields, without going through Update
+func copyUser(user *models.User) *models.User {
+	c := *user
+	return &c
+}
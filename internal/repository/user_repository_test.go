@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"fmt"
+	"learn/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestUser(id, username, email string) *models.User {
+	return &models.User{ID: id, Username: username, Email: email}
+}
+
+func TestInMemoryUserRepositoryIndexes(t *testing.T) {
+	testUserRepositoryIndexes(t, NewInMemoryUserRepository())
+}
+
+// testUserRepositoryIndexes checks the lookups and uniqueness rules every
+// UserRepository implements
+func testUserRepositoryIndexes(t *testing.T, repo UserRepository) {
+	ctx := t.Context()
+	require.NoError(t, repo.Create(ctx, newTestUser("1", "Alice", "alice@example.com")))
+	require.NoError(t, repo.Create(ctx, newTestUser("2", "bob", "bob@example.com")))
+
+	t.Run("Lookups are normalized", func(t *testing.T) {
+		user, err := repo.GetByUsername(ctx, "ALICE")
+		require.NoError(t, err)
+		assert.Equal(t, "1", user.ID)
+
+		user, err = repo.GetByEmail(ctx, "Alice@Example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "1", user.ID)
+	})
+
+	t.Run("Create rejects duplicates", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Create(ctx, newTestUser("3", "alice", "other@example.com")), ErrUserAlreadyExists)
+		assert.ErrorIs(t, repo.Create(ctx, newTestUser("3", "carol", "BOB@example.com")), ErrUserAlreadyExists)
+		assert.ErrorIs(t, repo.Create(ctx, newTestUser("3", "b0b", "carol@example.com")), ErrUserAlreadyExists)
+		assert.ErrorIs(t, repo.Create(ctx, newTestUser("1", "carol", "carol@example.com")), ErrUserAlreadyExists)
+	})
+
+	t.Run("Update re-indexes changed username and email", func(t *testing.T) {
+		user, err := repo.GetByID(ctx, "1")
+		require.NoError(t, err)
+		user.Username = "alicia"
+		user.Email = "alicia@example.com"
+		require.NoError(t, repo.Update(ctx, user))
+
+		_, err = repo.GetByUsername(ctx, "alice")
+		assert.ErrorIs(t, err, ErrUserNotFound)
+		_, err = repo.GetByEmail(ctx, "alice@example.com")
+		assert.ErrorIs(t, err, ErrUserNotFound)
+
+		found, err := repo.GetByUsername(ctx, "alicia")
+		require.NoError(t, err)
+		assert.Equal(t, "1", found.ID)
+		found, err = repo.GetByEmail(ctx, "alicia@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "1", found.ID)
+
+		// The old name is free again
+		require.NoError(t, repo.Create(ctx, newTestUser("3", "alice", "alice@example.com")))
+	})
+
+	t.Run("Update rejects taking another user's identifiers", func(t *testing.T) {
+		user, err := repo.GetByID(ctx, "2")
+		require.NoError(t, err)
+		user.Email = "alicia@example.com"
+		assert.ErrorIs(t, repo.Update(ctx, user), ErrUserAlreadyExists)
+
+		found, err := repo.GetByEmail(ctx, "bob@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "2", found.ID)
+	})
+
+	t.Run("Modifying a returned user does not affect the store", func(t *testing.T) {
+		user, err := repo.GetByID(ctx, "2")
+		require.NoError(t, err)
+		user.Username = "mallory"
+
+		_, err = repo.GetByUsername(ctx, "mallory")
+		assert.ErrorIs(t, err, ErrUserNotFound)
+	})
+
+	t.Run("Delete removes index entries", func(t *testing.T) {
+		require.NoError(t, repo.Delete(ctx, "2"))
+		_, err := repo.GetByUsername(ctx, "bob")
+		assert.ErrorIs(t, err, ErrUserNotFound)
+		_, err = repo.GetByEmail(ctx, "bob@example.com")
+		assert.ErrorIs(t, err, ErrUserNotFound)
+		require.NoError(t, repo.Create(ctx, newTestUser("4", "bob", "bob@example.com")))
+	})
+}
+
+func TestInMemoryUserRepositoryList(t *testing.T) {
+	testUserRepositoryList(t, NewInMemoryUserRepository())
+}
+
+func testUserRepositoryList(t *testing.T, repo UserRepository) {
+	ctx := t.Context()
+	start := time.Now()
+	for i, name := range []string{"alice", "bob", "carol", "dave", "alina"} {
+		user := newTestUser(fmt.Sprintf("%d", i), name, name+"@example.com")
+		user.Role = models.RoleUser
+		user.CreatedAt = start.Add(time.Duration(i) * time.Second)
+		require.NoError(t, repo.Create(ctx, user))
+	}
+	admin, _ := repo.GetByUsername(ctx, "carol")
+	admin.Role = models.RoleAdmin
+	admin.Status = models.StatusDisabled
+	require.NoError(t, repo.Update(ctx, admin))
+
+	count, err := repo.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, count)
+
+	tests := []struct {
+		name      string
+		filter    UserFilter
+		usernames []string
+		total     int
+	}{
+		{"All, oldest first", UserFilter{}, []string{"alice", "bob", "carol", "dave", "alina"}, 5},
+		{"Paginated", UserFilter{Offset: 2, Limit: 2}, []string{"carol", "dave"}, 5},
+		{"Past the end", UserFilter{Offset: 10, Limit: 2}, []string{}, 5},
+		{"Query matches username or email", UserFilter{Query: "ALI"}, []string{"alice", "alina"}, 2},
+		{"Role", UserFilter{Role: models.RoleAdmin}, []string{"carol"}, 1},
+		{"Status", UserFilter{Status: models.StatusDisabled}, []string{"carol"}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, total, err := repo.List(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.total, total)
+			usernames := []string{}
+			for _, user := range users {
+				usernames = append(usernames, user.Username)
+			}
+			assert.Equal(t, tt.usernames, usernames)
+		})
+	}
+}
+
+// populateUsers creates a repository holding n users
+func populateUsers(b *testing.B, n int) *InMemoryUserRepository {
+	ctx := b.Context()
+	b.Helper()
+	repo := NewInMemoryUserRepository()
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("%d", i)
+		user := newTestUser(id, "user"+id, "user"+id+"@example.com")
+		if err := repo.Create(ctx, user); err != nil {
+			b.Fatalf("Create() error = %v", err)
+		}
+	}
+	return repo
+}
+
+// BenchmarkInMemoryUserRepository shows that lookups and creation take the
+// same time regardless of how many users are stored
+func BenchmarkInMemoryUserRepository(b *testing.B) {
+	for _, n := range []int{1_000, 100_000, 1_000_000} {
+		repo := populateUsers(b, n)
+		target := fmt.Sprintf("%d", n/2)
+
+		b.Run(fmt.Sprintf("GetByUsername/users=%d", n), func(b *testing.B) {
+			ctx := b.Context()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.GetByUsername(ctx, "user"+target); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("GetByEmail/users=%d", n), func(b *testing.B) {
+			ctx := b.Context()
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.GetByEmail(ctx, "user"+target+"@example.com"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		// The benchmark function may run several times, so keep IDs unique across runs
+		created := 0
+		b.Run(fmt.Sprintf("Create/users=%d", n), func(b *testing.B) {
+			ctx := b.Context()
+			for i := 0; i < b.N; i++ {
+				created++
+				id := fmt.Sprintf("new%d", created)
+				if err := repo.Create(ctx, newTestUser(id, id, id+"@example.com")); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"errors"
+	"learn/internal/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWebhookNotFound          = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound  = errors.New("webhook delivery not found")
+	ErrWebhookAlreadyExists     = errors.New("webhook subscription already exists")
+	ErrWebhookDeliveryDuplicate = errors.New("webhook delivery already exists")
+)
+
+// DeliveryFilter selects webhook deliveries; empty fields match everything
+type DeliveryFilter struct {
+	SubscriptionID string
+	Status         string
+	// Limit caps the number of deliveries returned, 0 for no limit
+	Limit int
+}
+
+// Matches reports whether a delivery passes the filter, ignoring Limit
+func (f DeliveryFilter) Matches(delivery *models.WebhookDelivery) bool {
+	if f.SubscriptionID != "" && delivery.SubscriptionID != f.SubscriptionID {
+		return false
+	}
+	return f.Status == "" || delivery.Status == f.Status
+}
+
+// WebhookRepository defines the interface for webhook subscription and
+// delivery outbox data access
+type WebhookRepository interface {
+	CreateSubscription(subscription *models.WebhookSubscription) error
+	GetSubscription(id string) (*models.WebhookSubscription, error)
+	// ListSubscriptions returns every subscription, oldest first
+	ListSubscriptions() ([]*models.WebhookSubscription, error)
+	DeleteSubscription(id string) error
+
+	// CreateDeliveries stores deliveries all at once, or none of them
+	CreateDeliveries(deliveries []*models.WebhookDelivery) error
+	GetDelivery(id string) (*models.WebhookDelivery, error)
+	UpdateDelivery(delivery *models.WebhookDelivery) error
+	// ListDeliveries returns deliveries matching a filter, newest first
+	ListDeliveries(filter DeliveryFilter) ([]*models.WebhookDelivery, error)
+	// DueDeliveries returns up to limit pending deliveries whose next
+	// attempt is due at the given time, oldest first
+	DueDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error)
+}
+
+// InMemoryWebhookRepository implements WebhookRepository with an in-memory store
+type InMemoryWebhookRepository struct {
+	subscriptions map[string]*models.WebhookSubscription
+	deliveries    map[string]*models.WebhookDelivery
+	mutex         sync.RWMutex
+}
+
+// NewInMemoryWebhookRepository creates a new in-memory webhook repository
+func NewInMemoryWebhookRepository() *InMemoryWebhookRepository {
+	return &InMemoryWebhookRepository{
+		subscriptions: make(map[string]*models.WebhookSubscription),
+		deliveries:    make(map[string]*models.WebhookDelivery),
+	}
+}
+
+// CreateSubscription adds a new subscription to the repository
+func (r *InMemoryWebhookRepository) CreateSubscription(subscription *models.WebhookSubscription) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.subscriptions[subscription.ID]; exists {
+		return ErrWebhookAlreadyExists
+	}
+	r.subscriptions[subscription.ID] = copySubscription(subscription)
+	return nil
+}
+
+// GetSubscription retrieves a subscription by ID
+func (r *InMemoryWebhookRepository) GetSubscription(id string) (*models.WebhookSubscription, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	subscription, exists := r.subscriptions[id]
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+	return copySubscription(subscription), nil
+}
+
+// ListSubscriptions returns every subscription, oldest first
+func (r *InMemoryWebhookRepository) ListSubscriptions() ([]*models.WebhookSubscription, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	subscriptions := make([]*models.WebhookSubscription, 0, len(r.subscriptions))
+	for _, subscription := range r.subscriptions {
+		subscriptions = append(subscriptions, copySubscription(subscription))
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes a subscription. Its deliveries are kept.
+func (r *InMemoryWebhookRepository) DeleteSubscription(id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.subscriptions[id]; !exists {
+		return ErrWebhookNotFound
+	}
+	delete(r.subscriptions, id)
+	return nil
+}
+
+// CreateDeliveries adds new deliveries to the outbox
+func (r *InMemoryWebhookRepository) CreateDeliveries(deliveries []*models.WebhookDelivery) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, delivery := range deliveries {
+		if _, exists := r.deliveries[delivery.ID]; exists {
+			return ErrWebhookDeliveryDuplicate
+		}
+	}
+	for _, delivery := range deliveries {
+		r.deliveries[delivery.ID] = copyDelivery(delivery)
+	}
+	return nil
+}
+
+// GetDelivery retrieves a delivery by ID
+func (r *InMemoryWebhookRepository) GetDelivery(id string) (*models.WebhookDelivery, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	delivery, exists := r.deliveries[id]
+	if !exists {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return copyDelivery(delivery), nil
+}
+
+// UpdateDelivery stores the new state of a delivery
+func (r *InMemoryWebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.deliveries[delivery.ID]; !exists {
+		return ErrWebhookDeliveryNotFound
+	}
+	r.deliveries[delivery.ID] = copyDelivery(delivery)
+	return nil
+}
+
+// ListDeliveries returns deliveries matching a filter, newest first
+func (r *InMemoryWebhookRepository) ListDeliveries(filter DeliveryFilter) ([]*models.WebhookDelivery, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if filter.Matches(delivery) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID > deliveries[j].ID
+	})
+	if filter.Limit > 0 && len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+	return copyDeliveries(deliveries), nil
+}
+
+// DueDeliveries returns pending deliveries that are due, oldest first
+func (r *InMemoryWebhookRepository) DueDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for _, delivery := range r.deliveries {
+		if delivery.Status == models.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttemptAt.Equal(deliveries[j].NextAttemptAt) {
+			return deliveries[i].NextAttemptAt.Before(deliveries[j].NextAttemptAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return copyDeliveries(deliveries), nil
+}
+
+// copySubscription returns a copy of a subscription that does not share mutable state
+func copySubscription(subscription *models.WebhookSubscription) *models.WebhookSubscription {
+	c := *subscription
+	c.Events = append([]string(nil), subscription.Events...)
+	return &c
+}
+
+// copyDelivery returns a copy of a delivery that does not share mutable state
+func copyDelivery(delivery *models.WebhookDelivery) *models.WebhookDelivery {
+	c := *delivery
+	c.Payload = append([]byte(nil), delivery.Payload...)
+	if delivery.LastAttemptAt != nil {
+		lastAttemptAt := *delivery.LastAttemptAt
+		c.LastAttemptAt = &lastAttemptAt
+	}
+	if delivery.DeliveredAt != nil {
+		deliveredAt := *delivery.DeliveredAt
+		c.DeliveredAt = &deliveredAt
+	}
+	return &c
+}
+
+func copyDeliveries(deliveries []*models.WebhookDelivery) []*models.WebhookDelivery {
+	copies := make([]*models.WebhookDelivery, len(deliveries))
+	for i, delivery := range deliveries {
+		copies[i] = copyDelivery(delivery)
+	}
+	return copies
+}
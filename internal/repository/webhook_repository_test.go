@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"database/sql"
+	"learn/internal/models"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+// TestWebhookRepository runs the same checks against every implementation
+func TestWebhookRepository(t *testing.T) {
+	implementations := map[string]func(t *testing.T) WebhookRepository{
+		"InMemory": func(t *testing.T) WebhookRepository {
+			return NewInMemoryWebhookRepository()
+		},
+		"SQL": func(t *testing.T) WebhookRepository {
+			db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "webhooks.db"))
+			require.NoError(t, err)
+			repo, err := NewSQLWebhookRepository(db)
+			require.NoError(t, err)
+			t.Cleanup(func() { repo.Close() })
+			return repo
+		},
+	}
+
+	for name, newRepo := range implementations {
+		t.Run(name, func(t *testing.T) {
+			testWebhookRepository(t, newRepo(t))
+		})
+	}
+}
+
+func testWebhookRepository(t *testing.T, repo WebhookRepository) {
+	start := time.Unix(1700000000, 0)
+
+	subscription := &models.WebhookSubscription{
+		ID:        "sub1",
+		URL:       "https://example.com/hook",
+		Events:    []string{"user.registered", "user.login"},
+		Secret:    "whsec_test",
+		CreatedAt: start,
+	}
+	require.NoError(t, repo.CreateSubscription(subscription))
+	found, err := repo.GetSubscription("sub1")
+	require.NoError(t, err)
+	assert.Equal(t, subscription.Events, found.Events)
+	assert.Equal(t, "whsec_test", found.Secret)
+	assert.True(t, found.CreatedAt.Equal(start))
+
+	var deliveries []*models.WebhookDelivery
+	for i, id := range []string{"d1", "d2", "d3"} {
+		at := start.Add(time.Duration(i) * time.Minute)
+		deliveries = append(deliveries, &models.WebhookDelivery{
+			ID:             id,
+			SubscriptionID: "sub1",
+			EventID:        "event-" + id,
+			EventType:      "user.login",
+			Payload:        []byte(`{"id":"event-` + id + `"}`),
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  at,
+			CreatedAt:      at,
+		})
+	}
+	require.NoError(t, repo.CreateDeliveries(deliveries))
+
+	due, err := repo.DueDeliveries(start.Add(90*time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	assert.Equal(t, "d1", due[0].ID)
+	assert.JSONEq(t, `{"id":"event-d1"}`, string(due[0].Payload))
+
+	delivered := start.Add(time.Hour)
+	due[0].Status = models.DeliveryDelivered
+	due[0].Attempts = 1
+	due[0].ResponseStatus = 204
+	due[0].DeliveredAt = &delivered
+	require.NoError(t, repo.UpdateDelivery(due[0]))
+
+	due, err = repo.DueDeliveries(start.Add(time.Hour), 1)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	assert.Equal(t, "d2", due[0].ID)
+
+	listed, err := repo.ListDeliveries(DeliveryFilter{})
+	require.NoError(t, err)
+	ids := []string{}
+	for _, delivery := range listed {
+		ids = append(ids, delivery.ID)
+	}
+	assert.Equal(t, []string{"d3", "d2", "d1"}, ids)
+
+	listed, err = repo.ListDeliveries(DeliveryFilter{SubscriptionID: "sub1", Status: models.DeliveryDelivered})
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, 204, listed[0].ResponseStatus)
+	require.NotNil(t, listed[0].DeliveredAt)
+	assert.True(t, listed[0].DeliveredAt.Equal(delivered))
+
+	listed, err = repo.ListDeliveries(DeliveryFilter{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+
+	_, err = repo.GetDelivery("missing")
+	assert.ErrorIs(t, err, ErrWebhookDeliveryNotFound)
+	assert.ErrorIs(t, repo.UpdateDelivery(&models.WebhookDelivery{ID: "missing"}), ErrWebhookDeliveryNotFound)
+
+	require.NoError(t, repo.DeleteSubscription("sub1"))
+	assert.ErrorIs(t, repo.DeleteSubscription("sub1"), ErrWebhookNotFound)
+	_, err = repo.GetSubscription("sub1")
+	assert.ErrorIs(t, err, ErrWebhookNotFound)
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"learn/internal/models"
+	"strings"
+	"time"
+)
+
+// SQLWebhookRepository implements WebhookRepository on a SQL database, so
+// that queued deliveries survive a restart. Times are stored as Unix
+// nanoseconds and queries use numbered placeholders ($1), as supported by
+// SQLite and PostgreSQL.
+type SQLWebhookRepository struct {
+	db *sql.DB
+}
+
+// NewSQLWebhookRepository creates a repository on db, creating its tables
+// if needed. The repository takes ownership of db and closes it when it is
+// closed.
+func NewSQLWebhookRepository(db *sql.DB) (*SQLWebhookRepository, error) {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+			id TEXT PRIMARY KEY,
+			url TEXT NOT NULL,
+			events TEXT NOT NULL,
+			description TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			created_at BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id TEXT PRIMARY KEY,
+			subscription_id TEXT NOT NULL,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL,
+			next_attempt_at BIGINT NOT NULL,
+			last_attempt_at BIGINT,
+			last_error TEXT NOT NULL,
+			response_status INTEGER NOT NULL,
+			created_at BIGINT NOT NULL,
+			delivered_at BIGINT
+		)`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at)`,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLWebhookRepository{db: db}, nil
+}
+
+const (
+	selectSubscriptions = `SELECT id, url, events, description, secret, created_at FROM webhook_subscriptions`
+	selectDeliveries    = `SELECT id, subscription_id, event_id, event_type, payload, status, attempts,
+		next_attempt_at, last_attempt_at, last_error, response_status, created_at, delivered_at FROM webhook_deliveries`
+)
+
+// CreateSubscription adds a new subscription
+func (r *SQLWebhookRepository) CreateSubscription(subscription *models.WebhookSubscription) error {
+	_, err := r.db.Exec(`INSERT INTO webhook_subscriptions (id, url, events, description, secret, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		subscription.ID, subscription.URL, strings.Join(subscription.Events, ","), subscription.Description,
+		subscription.Secret, subscription.CreatedAt.UnixNano())
+	return err
+}
+
+// GetSubscription retrieves a subscription by ID
+func (r *SQLWebhookRepository) GetSubscription(id string) (*models.WebhookSubscription, error) {
+	subscriptions, err := r.querySubscriptions(selectSubscriptions+` WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(subscriptions) == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	return subscriptions[0], nil
+}
+
+// ListSubscriptions returns every subscription, oldest first
+func (r *SQLWebhookRepository) ListSubscriptions() ([]*models.WebhookSubscription, error) {
+	return r.querySubscriptions(selectSubscriptions + ` ORDER BY created_at, id`)
+}
+
+// DeleteSubscription removes a subscription. Its deliveries are kept.
+func (r *SQLWebhookRepository) DeleteSubscription(id string) error {
+	result, err := r.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrWebhookNotFound)
+}
+
+// CreateDeliveries adds new deliveries to the outbox in one transaction
+func (r *SQLWebhookRepository) CreateDeliveries(deliveries []*models.WebhookDelivery) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, delivery := range deliveries {
+		_, err := tx.Exec(`INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status,
+			attempts, next_attempt_at, last_attempt_at, last_error, response_status, created_at, delivered_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			delivery.ID, delivery.SubscriptionID, delivery.EventID, delivery.EventType, string(delivery.Payload),
+			delivery.Status, delivery.Attempts, delivery.NextAttemptAt.UnixNano(), nullTime(delivery.LastAttemptAt),
+			delivery.LastError, delivery.ResponseStatus, delivery.CreatedAt.UnixNano(), nullTime(delivery.DeliveredAt))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetDelivery retrieves a delivery by ID
+func (r *SQLWebhookRepository) GetDelivery(id string) (*models.WebhookDelivery, error) {
+	deliveries, err := r.queryDeliveries(selectDeliveries+` WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	return deliveries[0], nil
+}
+
+// UpdateDelivery stores the new state of a delivery
+func (r *SQLWebhookRepository) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	result, err := r.db.Exec(`UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3,
+		last_attempt_at = $4, last_error = $5, response_status = $6, delivered_at = $7 WHERE id = $8`,
+		delivery.Status, delivery.Attempts, delivery.NextAttemptAt.UnixNano(), nullTime(delivery.LastAttemptAt),
+		delivery.LastError, delivery.ResponseStatus, nullTime(delivery.DeliveredAt), delivery.ID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result, ErrWebhookDeliveryNotFound)
+}
+
+// ListDeliveries returns deliveries matching a filter, newest first
+func (r *SQLWebhookRepository) ListDeliveries(filter DeliveryFilter) ([]*models.WebhookDelivery, error) {
+	query := selectDeliveries + ` WHERE ($1 = '' OR subscription_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC`
+	args := []any{filter.SubscriptionID, filter.Status}
+	if filter.Limit > 0 {
+		query += ` LIMIT $3`
+		args = append(args, filter.Limit)
+	}
+	return r.queryDeliveries(query, args...)
+}
+
+// DueDeliveries returns pending deliveries that are due, oldest first
+func (r *SQLWebhookRepository) DueDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	return r.queryDeliveries(selectDeliveries+` WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY next_attempt_at, id LIMIT $3`, models.DeliveryPending, now.UnixNano(), limit)
+}
+
+// Ping checks that the database can be reached
+func (r *SQLWebhookRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// Close closes the database
+func (r *SQLWebhookRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *SQLWebhookRepository) querySubscriptions(query string, args ...any) ([]*models.WebhookSubscription, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []*models.WebhookSubscription{}
+	for rows.Next() {
+		var subscription models.WebhookSubscription
+		var events string
+		var createdAt int64
+		err := rows.Scan(&subscription.ID, &subscription.URL, &events, &subscription.Description,
+			&subscription.Secret, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		subscription.Events = strings.Split(events, ",")
+		subscription.CreatedAt = time.Unix(0, createdAt)
+		subscriptions = append(subscriptions, &subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (r *SQLWebhookRepository) queryDeliveries(query string, args ...any) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var payload string
+		var nextAttemptAt, createdAt int64
+		var lastAttemptAt, deliveredAt sql.NullInt64
+		err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &payload,
+			&delivery.Status, &delivery.Attempts, &nextAttemptAt, &lastAttemptAt, &delivery.LastError,
+			&delivery.ResponseStatus, &createdAt, &deliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		delivery.NextAttemptAt = time.Unix(0, nextAttemptAt)
+		delivery.LastAttemptAt = timeFromNull(lastAttemptAt)
+		delivery.CreatedAt = time.Unix(0, createdAt)
+		delivery.DeliveredAt = timeFromNull(deliveredAt)
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// requireAffected returns notFound if a statement changed no rows
+func requireAffected(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func nullTime(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: t.UnixNano(), Valid: true}
+}
+
+func timeFromNull(n sql.NullInt64) *time.Time {
+	if !n.Valid {
+		return nil
+	}
+	t := time.Unix(0, n.Int64)
+	return &t
+}
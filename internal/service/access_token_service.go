@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/utils"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidScope        = errors.New("invalid scope")
+	ErrAccessTokenNotFound = errors.New("access token not found")
+)
+
+// AccessTokenService handles personal access token business logic
+type AccessTokenService struct {
+	tokenRepo repository.AccessTokenRepository
+	userRepo  repository.UserRepository
+}
+
+// NewAccessTokenService creates a new personal access token service
+func NewAccessTokenService(tokenRepo repository.AccessTokenRepository, userRepo repository.UserRepository) *AccessTokenService {
+	return &AccessTokenService{
+		tokenRepo: tokenRepo,
+		userRepo:  userRepo,
+	}
+}
+
+// Create mints a new personal access token for a user. The returned token
+// value is not stored and cannot be retrieved again.
+func (s *AccessTokenService) Create(ctx context.Context, userID string, req *models.AccessTokenCreation) (*models.CreatedAccessToken, error) {
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := utils.GenerateAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token := &models.PersonalAccessToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    utils.AccessTokenDisplayPrefix(value),
+		TokenHash: utils.HashAccessToken(value),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.tokenRepo.Create(ctx, token); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedAccessToken{
+		PersonalAccessToken: *token,
+		Token:               value,
+	}, nil
+}
+
+// normalizeScopes checks every requested scope is known and removes duplicates
+func normalizeScopes(requested []string) ([]string, error) {
+	known := make(map[string]bool, len(models.AccessTokenScopes))
+	for _, scope := range models.AccessTokenScopes {
+		known[scope] = true
+	}
+
+	scopes := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, scope := range requested {
+		if !known[scope] {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// List returns a user's personal access tokens, newest first
+func (s *AccessTokenService) List(ctx context.Context, userID string) ([]*models.PersonalAccessToken, error) {
+	return s.tokenRepo.ListByUser(ctx, userID)
+}
+
+// Revoke deletes one of a user's personal access tokens
+func (s *AccessTokenService) Revoke(ctx context.Context, userID, id string) error {
+	err := s.tokenRepo.Delete(ctx, userID, id)
+	if err == repository.ErrAccessTokenNotFound {
+		return ErrAccessTokenNotFound
+	}
+	return err
+}
+
+// Authenticate resolves a personal access token to its owner. It returns
+// ErrInvalidToken if the token is unknown or expired, or its owner no
+// longer exists or cannot log in.
+func (s *AccessTokenService) Authenticate(ctx context.Context, value string) (*models.User, *models.PersonalAccessToken, error) {
+	token, err := s.tokenRepo.GetByHash(ctx, utils.HashAccessToken(value))
+	if err != nil {
+		if err == repository.ErrAccessTokenNotFound {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		if err == repository.ErrUserNotFound {
+			return nil, nil, ErrInvalidToken
+		}
+		return nil, nil, err
+	}
+	if !user.Active(now) || user.PasswordResetRequired {
+		return nil, nil, ErrInvalidToken
+	}
+
+	if err := s.tokenRepo.Touch(ctx, token.ID, now); err != nil {
+		slog.ErrorContext(ctx, "Failed to record access token use", "error", err)
+	}
+
+	return user, token, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAccessTokenService(t *testing.T) (*AccessTokenService, *repository.InMemoryAccessTokenRepository, *models.User) {
+	ctx := t.Context()
+	userRepo := repository.NewInMemoryUserRepository()
+	user := &models.User{ID: "user-1", Username: "alice", Email: "alice@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	tokenRepo := repository.NewInMemoryAccessTokenRepository()
+	return NewAccessTokenService(tokenRepo, userRepo), tokenRepo, user
+}
+
+func TestAccessTokenLifecycle(t *testing.T) {
+	ctx := t.Context()
+	svc, tokenRepo, user := newTestAccessTokenService(t)
+
+	created, err := svc.Create(ctx, user.ID, &models.AccessTokenCreation{
+		Name:   "deploy script",
+		Scopes: []string{models.ScopeProfileRead, models.ScopeProfileRead},
+	})
+	require.NoError(t, err)
+	assert.True(t, utils.IsAccessToken(created.Token))
+	assert.True(t, strings.HasPrefix(created.Token, created.Prefix))
+	assert.Equal(t, []string{models.ScopeProfileRead}, created.Scopes)
+	assert.Nil(t, created.ExpiresAt)
+
+	// Only the hash of the token is stored
+	stored, err := tokenRepo.GetByHash(ctx, utils.HashAccessToken(created.Token))
+	require.NoError(t, err)
+	assert.NotContains(t, stored.TokenHash, created.Token)
+
+	owner, token, err := svc.Authenticate(ctx, created.Token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, owner.ID)
+	assert.Equal(t, created.ID, token.ID)
+
+	tokens, err := svc.List(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsedAt)
+
+	assert.Equal(t, ErrAccessTokenNotFound, svc.Revoke(ctx, "someone-else", created.ID))
+	require.NoError(t, svc.Revoke(ctx, user.ID, created.ID))
+
+	_, _, err = svc.Authenticate(ctx, created.Token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestAccessTokenRejected(t *testing.T) {
+	ctx := t.Context()
+	svc, tokenRepo, user := newTestAccessTokenService(t)
+
+	_, err := svc.Create(ctx, user.ID, &models.AccessTokenCreation{Name: "bad", Scopes: []string{"admin"}})
+	assert.Equal(t, ErrInvalidScope, err)
+
+	_, _, err = svc.Authenticate(ctx, utils.AccessTokenPrefix+"unknown")
+	assert.Equal(t, ErrInvalidToken, err)
+
+	created, err := svc.Create(ctx, user.ID, &models.AccessTokenCreation{
+		Name:          "ci",
+		Scopes:        []string{models.ScopeSessionsRead},
+		ExpiresInDays: 30,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, created.ExpiresAt)
+
+	// Expire the token
+	expired := created.PersonalAccessToken
+	past := time.Now().Add(-time.Minute)
+	expired.ExpiresAt = &past
+	require.NoError(t, tokenRepo.Delete(ctx, user.ID, created.ID))
+	require.NoError(t, tokenRepo.Create(ctx, &expired))
+
+	_, _, err = svc.Authenticate(ctx, created.Token)
+	assert.Equal(t, ErrInvalidToken, err)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"learn/internal/events"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"sync"
+	"time"
+)
+
+// maxCachedStatuses bounds the number of entries an AccountStatusCache holds
+const maxCachedStatuses = 100000
+
+// AccountStatusCache looks up users' account statuses and whether they must
+// reset their password, caching each for a short time so that checking
+// them on every request stays cheap while changes still take effect within
+// the cache TTL. Changes made through the services invalidate the cached
+// entry at once.
+type AccountStatusCache struct {
+	userRepo repository.UserRepository
+	ttl      time.Duration
+	entries  map[string]cachedAccountStatus
+	// generations counts the invalidations of each user's entry, so that a
+	// lookup that read the user before an invalidation does not cache what
+	// it read. Only invalidated users have a generation.
+	generations map[string]uint64
+	mutex       sync.Mutex
+}
+
+type cachedAccountStatus struct {
+	status                *models.AccountStatus // Nil if the user does not exist
+	passwordResetRequired bool
+	expiresAt             time.Time
+}
+
+// NewAccountStatusCache creates a new account status cache
+func NewAccountStatusCache(userRepo repository.UserRepository, ttl time.Duration) *AccountStatusCache {
+	return &AccountStatusCache{
+		userRepo:    userRepo,
+		ttl:         ttl,
+		entries:     make(map[string]cachedAccountStatus),
+		generations: make(map[string]uint64),
+	}
+}
+
+// AccountStatus returns a user's account status and whether they must reset
+// their password. It returns ErrUserNotFound if the user does not exist.
+func (c *AccountStatusCache) AccountStatus(ctx context.Context, userID string) (*models.AccountStatus, bool, error) {
+	now := time.Now()
+	c.mutex.Lock()
+	entry, exists := c.entries[userID]
+	generation := c.generations[userID]
+	c.mutex.Unlock()
+	if exists && now.Before(entry.expiresAt) {
+		return entry.result()
+	}
+
+	user, err := c.userRepo.GetByID(ctx, userID)
+	if err != nil && err != repository.ErrUserNotFound {
+		return nil, false, err
+	}
+	entry = cachedAccountStatus{expiresAt: now.Add(c.ttl)}
+	if user != nil {
+		entry.status = &user.AccountStatus
+		entry.passwordResetRequired = user.PasswordResetRequired
+	}
+
+	c.mutex.Lock()
+	if c.generations[userID] == generation {
+		if len(c.entries) >= maxCachedStatuses {
+			c.evictExpired(now)
+		}
+		c.entries[userID] = entry
+	}
+	c.mutex.Unlock()
+
+	return entry.result()
+}
+
+// Invalidate drops a user's cached status so the next lookup reads it
+// afresh. It does nothing on a nil cache, used when statuses are not
+// checked on every request.
+func (c *AccountStatusCache) Invalidate(userID string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.entries, userID)
+	c.generations[userID]++
+}
+
+// evictExpired removes expired entries, or every entry if none have
+// expired; the caller must hold the lock
+func (c *AccountStatusCache) evictExpired(now time.Time) {
+	for userID, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, userID)
+		}
+	}
+	if len(c.entries) >= maxCachedStatuses {
+		c.entries = make(map[string]cachedAccountStatus)
+	}
+}
+
+func (e cachedAccountStatus) result() (*models.AccountStatus, bool, error) {
+	if e.status == nil {
+		return nil, false, ErrUserNotFound
+	}
+	status := *e.status
+	return &status, e.passwordResetRequired, nil
+}
+
+// SubscribeAccountStatusCache invalidates a user's cached status when their
+// password is changed or reset, which lifts a required reset
+func SubscribeAccountStatusCache(bus *events.Bus, cache *AccountStatusCache) {
+	events.Subscribe(bus, func(event events.PasswordChanged) error {
+		cache.Invalidate(event.UserID)
+		return nil
+	})
+}
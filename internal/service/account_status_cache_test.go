@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountStatusCache(t *testing.T) {
+	ctx := t.Context()
+	userRepo := repository.NewInMemoryUserRepository()
+	user := &models.User{ID: "1", Username: "alice", Email: "alice@example.com", AccountStatus: models.AccountStatus{Status: models.StatusActive}}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	cache := NewAccountStatusCache(userRepo, 50*time.Millisecond)
+	status, _, err := cache.AccountStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusActive, status.Status)
+
+	// A change is only seen once the cached status expires
+	user.Status = models.StatusSuspended
+	require.NoError(t, userRepo.Update(ctx, user))
+	status, _, err = cache.AccountStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusActive, status.Status)
+
+	assert.Eventually(t, func() bool {
+		status, _, err := cache.AccountStatus(ctx, user.ID)
+		return err == nil && status.Status == models.StatusSuspended
+	}, time.Second, 10*time.Millisecond)
+
+	// Unless the entry is invalidated
+	user.Status = models.StatusActive
+	require.NoError(t, userRepo.Update(ctx, user))
+	cache.Invalidate(user.ID)
+	status, _, err = cache.AccountStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusActive, status.Status)
+
+	// Whether a password reset is required is cached alongside the status
+	user.PasswordResetRequired = true
+	require.NoError(t, userRepo.Update(ctx, user))
+	cache.Invalidate(user.ID)
+	_, resetRequired, err := cache.AccountStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, resetRequired)
+
+	_, _, err = cache.AccountStatus(ctx, "missing")
+	assert.Equal(t, ErrUserNotFound, err)
+}
+
+// blockingUserRepository holds GetByID calls until released, after
+// signalling that a read has been made
+type blockingUserRepository struct {
+	repository.UserRepository
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	user, err := r.UserRepository.GetByID(ctx, id)
+	r.read <- struct{}{}
+	<-r.release
+	return user, err
+}
+
+func TestAccountStatusCacheInvalidateDuringLookup(t *testing.T) {
+	ctx := t.Context()
+	userRepo := repository.NewInMemoryUserRepository()
+	user := &models.User{ID: "1", Username: "alice", Email: "alice@example.com", AccountStatus: models.AccountStatus{Status: models.StatusActive}}
+	require.NoError(t, userRepo.Create(ctx, user))
+	blocking := &blockingUserRepository{UserRepository: userRepo, read: make(chan struct{}), release: make(chan struct{})}
+	cache := NewAccountStatusCache(blocking, time.Hour)
+
+	// A lookup reads the user, then the user is suspended and the entry
+	// invalidated before the lookup stores what it read
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		status, _, err := cache.AccountStatus(ctx, user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.StatusActive, status.Status)
+	}()
+	<-blocking.read
+	user.Status = models.StatusSuspended
+	require.NoError(t, userRepo.Update(ctx, user))
+	cache.Invalidate(user.ID)
+	close(blocking.release)
+	<-done
+
+	// The stale read was not cached
+	go func() { <-blocking.read }()
+	status, _, err := cache.AccountStatus(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusSuspended, status.Status)
+}
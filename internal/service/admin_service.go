@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"learn/internal/audit"
+	"learn/internal/events"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/utils"
+	"time"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidRole  = errors.New("invalid role")
+	// ErrInvalidStatus is returned for an unknown account status, or an end
+	// time that is in the past or given for a status other than suspended
+	ErrInvalidStatus = errors.New("invalid account status")
+	// ErrSelfAdministration is returned when an administrator tries to
+	// disable, demote or delete their own account and could lock themselves out
+	ErrSelfAdministration = errors.New("cannot perform this action on your own account")
+)
+
+// Pagination limits for user listings
+const (
+	DefaultUsersPerPage = 20
+	MaxUsersPerPage     = 100
+)
+
+// AdminService handles administrative user management. Every action is
+// recorded in the audit log, whether or not it succeeds.
+type AdminService struct {
+	userRepo    repository.UserRepository
+	authService *AuthService
+	statusCache *AccountStatusCache
+	auditLog    audit.Logger
+	events      eventPublisher
+}
+
+// NewAdminService creates a new admin service. The status cache, which may
+// be nil, is invalidated whenever the service changes an account's status.
+func NewAdminService(store repository.Store, authService *AuthService, statusCache *AccountStatusCache, auditLog audit.Logger, bus *events.Bus) *AdminService {
+	return &AdminService{
+		userRepo:    store.Users(),
+		authService: authService,
+		statusCache: statusCache,
+		auditLog:    auditLog,
+		events:      eventPublisher{store: store, bus: bus},
+	}
+}
+
+// ListUsers returns one page of the users matching a filter. Pages are
+// numbered from 1.
+func (s *AdminService) ListUsers(ctx context.Context, actor audit.Actor, filter repository.UserFilter, page, perPage int) (*models.UserPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = DefaultUsersPerPage
+	}
+	perPage = min(perPage, MaxUsersPerPage)
+	filter.Offset = (page - 1) * perPage
+	filter.Limit = perPage
+
+	users, total, err := s.userRepo.List(ctx, filter)
+	s.record(actor, audit.ActionAdminListUsers, "", err)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserPage{
+		Users:   users,
+		Total:   total,
+		Page:    page,
+		PerPage: perPage,
+	}, nil
+}
+
+// GetUser returns a user by ID
+func (s *AdminService) GetUser(ctx context.Context, actor audit.Actor, userID string) (*models.User, error) {
+	user, err := s.getUser(ctx, userID)
+	s.record(actor, audit.ActionAdminViewUser, userID, err)
+	return user, err
+}
+
+// DisableUser disables a user's account, logs them out everywhere and
+// revokes their personal access tokens
+func (s *AdminService) DisableUser(ctx context.Context, actor audit.Actor, userID, reason string) error {
+	status := models.AccountStatus{Status: models.StatusDisabled, StatusReason: reason}
+	return s.changeStatus(ctx, actor, audit.ActionAdminDisableUser, userID, status)
+}
+
+// EnableUser makes an account active again, ending any suspension
+func (s *AdminService) EnableUser(ctx context.Context, actor audit.Actor, userID string) error {
+	status := models.AccountStatus{Status: models.StatusActive}
+	return s.changeStatus(ctx, actor, audit.ActionAdminEnableUser, userID, status)
+}
+
+// SetStatus changes a user's account status. A suspension may be given an
+// end time, after which the account is active again.
+func (s *AdminService) SetStatus(ctx context.Context, actor audit.Actor, userID string, change *models.AccountStatusChange) error {
+	status := models.AccountStatus{Status: change.Status, StatusReason: change.Reason, StatusUntil: change.Until}
+	return s.changeStatus(ctx, actor, audit.ActionAdminSetStatus, userID, status)
+}
+
+// changeStatus applies and audits an account status change
+func (s *AdminService) changeStatus(ctx context.Context, actor audit.Actor, action, userID string, status models.AccountStatus) error {
+	err := s.setStatus(ctx, actor, userID, status)
+	event := audit.NewEvent(actor, action, userID, err)
+	if err == nil {
+		event.Reason = status.Status
+		if status.StatusReason != "" {
+			event.Reason += ": " + status.StatusReason
+		}
+	}
+	audit.Write(s.auditLog, event)
+	return err
+}
+
+// setStatus stores a user's new account status. Accounts that are no longer
+// active are logged out everywhere, and disabled accounts also lose their
+// personal access tokens. Access tokens already issued remain valid until
+// they expire unless account status checks are enabled.
+func (s *AdminService) setStatus(ctx context.Context, actor audit.Actor, userID string, status models.AccountStatus) error {
+	now := time.Now()
+	if !models.ValidStatus(status.Status) {
+		return ErrInvalidStatus
+	}
+	if status.StatusUntil != nil && (status.Status != models.StatusSuspended || !status.StatusUntil.After(now)) {
+		return ErrInvalidStatus
+	}
+	if userID == actor.ID && status.Status != models.StatusActive {
+		return ErrSelfAdministration
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.AccountStatus = status
+	user.UpdatedAt = now
+	var published []events.Event
+	if status.Status != models.StatusActive {
+		published = append(published, events.SessionRevoked{Metadata: events.NewMetadata(nil), UserID: userID, Others: true})
+	}
+	err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		if err := tx.Users().Update(ctx, user); err != nil {
+			return err
+		}
+		if status.Status == models.StatusActive {
+			return nil
+		}
+		if err := tx.Tokens().DeleteAllForUser(ctx, userID); err != nil {
+			return err
+		}
+		if status.Status == models.StatusDisabled {
+			return tx.AccessTokens().DeleteAllForUser(ctx, userID)
+		}
+		return nil
+	}, published...)
+	s.statusCache.Invalidate(userID)
+	return err
+}
+
+// RequirePasswordReset forces a user to reset their password before they
+// can log in again
+func (s *AdminService) RequirePasswordReset(ctx context.Context, actor audit.Actor, userID string) error {
+	err := s.authService.RequirePasswordReset(ctx, userID)
+	if err == repository.ErrUserNotFound {
+		err = ErrUserNotFound
+	}
+	s.statusCache.Invalidate(userID)
+	s.record(actor, audit.ActionAdminResetPassword, userID, err)
+	return err
+}
+
+// LogoutUser revokes all of a user's sessions
+func (s *AdminService) LogoutUser(ctx context.Context, actor audit.Actor, userID string) error {
+	_, err := s.getUser(ctx, userID)
+	if err == nil {
+		err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+			return tx.Tokens().DeleteAllForUser(ctx, userID)
+		}, events.SessionRevoked{Metadata: events.NewMetadata(nil), UserID: userID, Others: true})
+	}
+	s.record(actor, audit.ActionAdminLogoutUser, userID, err)
+	return err
+}
+
+// AssignRole changes a user's role
+func (s *AdminService) AssignRole(ctx context.Context, actor audit.Actor, userID, role string) error {
+	err := s.assignRole(ctx, actor, userID, role)
+	event := audit.NewEvent(actor, audit.ActionAdminAssignRole, userID, err)
+	if err == nil {
+		event.Reason = "role " + role
+	}
+	audit.Write(s.auditLog, event)
+	return err
+}
+
+func (s *AdminService) assignRole(ctx context.Context, actor audit.Actor, userID, role string) error {
+	if !models.ValidRole(role) {
+		return ErrInvalidRole
+	}
+	if userID == actor.ID && role != models.RoleAdmin {
+		return ErrSelfAdministration
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	return s.userRepo.Update(ctx, user)
+}
+
+// PromoteAdmin gives the admin role to an existing account, named by its
+// username or email. Registering never grants the role, so the first
+// administrator is promoted by the operator from the command line.
+func (s *AdminService) PromoteAdmin(ctx context.Context, identifier string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if utils.IsEmailIdentifier(identifier) {
+		user, err = s.userRepo.GetByEmail(ctx, identifier)
+	} else {
+		user, err = s.userRepo.GetByUsername(ctx, identifier)
+	}
+	if err == repository.ErrUserNotFound {
+		err = ErrUserNotFound
+	}
+	targetID := identifier
+	if err == nil {
+		targetID = user.ID
+		user.Role = models.RoleAdmin
+		user.UpdatedAt = time.Now()
+		err = s.userRepo.Update(ctx, user)
+	}
+
+	event := audit.NewEvent(audit.Actor{}, audit.ActionAdminAssignRole, targetID, err)
+	event.Reason = "role admin, promoted from the command line"
+	audit.Write(s.auditLog, event)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// DeleteUser permanently deletes a user along with their sessions and
+// personal access tokens
+func (s *AdminService) DeleteUser(ctx context.Context, actor audit.Actor, userID string) error {
+	err := s.deleteUser(ctx, actor, userID)
+	s.record(actor, audit.ActionAdminDeleteUser, userID, err)
+	return err
+}
+
+func (s *AdminService) deleteUser(ctx context.Context, actor audit.Actor, userID string) error {
+	if userID == actor.ID {
+		return ErrSelfAdministration
+	}
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		if err := tx.Users().Delete(ctx, userID); err != nil {
+			return err
+		}
+		if err := tx.Tokens().DeleteAllForUser(ctx, userID); err != nil {
+			return err
+		}
+		return tx.AccessTokens().DeleteAllForUser(ctx, userID)
+	}, events.UserDeleted{Metadata: events.NewMetadata(nil), User: events.UserOf(user)})
+	s.statusCache.Invalidate(userID)
+	if err == repository.ErrUserNotFound {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// getUser gets a user, translating the repository's not found error
+func (s *AdminService) getUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err == repository.ErrUserNotFound {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// record writes an audit event for an action and its outcome
+func (s *AdminService) record(actor audit.Actor, action, targetID string, err error) {
+	audit.Write(s.auditLog, audit.NewEvent(actor, action, targetID, err))
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"learn/internal/audit"
+	"learn/internal/config"
+	"learn/internal/events"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdminService(t *testing.T) (*AdminService, *AuthService, *recordingMailer, *recordingAuditLogger) {
+	t.Helper()
+	cfg := &config.Config{Auth: config.AuthConfig{
+		PasswordResetTTL: time.Hour,
+	}}
+	authService, mail := newTestAuthService(t, cfg)
+	auditLog := &recordingAuditLogger{}
+	// The status cache never expires entries, so changes are only seen if
+	// the entry is invalidated
+	statusCache := NewAccountStatusCache(authService.events.store.Users(), time.Hour)
+	SubscribeAccountStatusCache(authService.events.bus, statusCache)
+	adminService := NewAdminService(authService.events.store, authService, statusCache, auditLog, authService.events.bus)
+	return adminService, authService, mail, auditLog
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	ctx := t.Context()
+	admin, svc, _, auditLog := newTestAdminService(t)
+	root, err := svc.Register(ctx, &models.UserRegistration{Username: "root", Email: "root@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, root.Role)
+
+	root, err = admin.PromoteAdmin(ctx, "root")
+	require.NoError(t, err)
+	auditLog.events = nil
+	alice, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, alice.Role)
+
+	actor := audit.Actor{ID: root.ID, IPAddress: "127.0.0.1"}
+	creds := &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}
+	tokens, err := svc.Login(ctx, creds, testClient)
+	require.NoError(t, err)
+
+	page, err := admin.ListUsers(ctx, actor, repository.UserFilter{Query: "ALI"}, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, page.Total)
+	assert.Equal(t, alice.ID, page.Users[0].ID)
+
+	// Disabling logs the user out and blocks login
+	require.NoError(t, admin.DisableUser(ctx, actor, alice.ID, "spam"))
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = svc.Login(ctx, creds, testClient)
+	var statusErr *AccountStatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, models.StatusDisabled, statusErr.Status)
+	assert.Equal(t, audit.ActionAdminDisableUser, auditLog.last().Action)
+	assert.Equal(t, "disabled: spam", auditLog.last().Reason)
+
+	require.NoError(t, admin.EnableUser(ctx, actor, alice.ID))
+	_, err = svc.Login(ctx, creds, testClient)
+	require.NoError(t, err)
+
+	require.NoError(t, admin.AssignRole(ctx, actor, alice.ID, models.RoleAdmin))
+	user, err := admin.GetUser(ctx, actor, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	assert.Equal(t, ErrInvalidRole, admin.AssignRole(ctx, actor, alice.ID, "owner"))
+
+	// Administrators cannot lock themselves out
+	assert.Equal(t, ErrSelfAdministration, admin.DisableUser(ctx, actor, root.ID, ""))
+	assert.Equal(t, ErrSelfAdministration, admin.AssignRole(ctx, actor, root.ID, models.RoleUser))
+	assert.Equal(t, ErrSelfAdministration, admin.DeleteUser(ctx, actor, root.ID))
+	assert.Equal(t, audit.OutcomeFailure, auditLog.last().Outcome)
+
+	_, _, err = admin.statusCache.AccountStatus(ctx, alice.ID)
+	require.NoError(t, err)
+	require.NoError(t, admin.DeleteUser(ctx, actor, alice.ID))
+	_, err = admin.GetUser(ctx, actor, alice.ID)
+	assert.Equal(t, ErrUserNotFound, err)
+	_, _, err = admin.statusCache.AccountStatus(ctx, alice.ID)
+	assert.Equal(t, ErrUserNotFound, err)
+	assert.Contains(t, outboxTypes(t, svc), events.TypeUserDeleted)
+
+	for _, event := range auditLog.events {
+		assert.Equal(t, root.ID, event.ActorID)
+		assert.Equal(t, "127.0.0.1", event.IPAddress)
+	}
+	assert.Len(t, auditLog.events, 11)
+}
+
+func TestPromoteAdmin(t *testing.T) {
+	ctx := t.Context()
+	admin, svc, _, auditLog := newTestAdminService(t)
+	root, err := svc.Register(ctx, &models.UserRegistration{Username: "root", Email: "root@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, root.Role)
+
+	// Registering never grants the admin role; the operator promotes an
+	// existing account by its username or email
+	promoted, err := admin.PromoteAdmin(ctx, "Root@Example.com")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, promoted.Role)
+	user, err := admin.GetUser(ctx, audit.Actor{ID: root.ID}, root.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	assert.Equal(t, audit.ActionAdminAssignRole, auditLog.events[0].Action)
+	assert.Equal(t, root.ID, auditLog.events[0].TargetID)
+
+	_, err = admin.PromoteAdmin(ctx, "nobody")
+	assert.Equal(t, ErrUserNotFound, err)
+	assert.Equal(t, audit.OutcomeFailure, auditLog.last().Outcome)
+}
+
+func TestAdminRequirePasswordReset(t *testing.T) {
+	ctx := t.Context()
+	admin, svc, mail, _ := newTestAdminService(t)
+	alice, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	creds := &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}
+	tokens, err := svc.Login(ctx, creds, testClient)
+	require.NoError(t, err)
+	_, resetRequired, err := admin.statusCache.AccountStatus(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.False(t, resetRequired)
+
+	require.NoError(t, admin.RequirePasswordReset(ctx, audit.Actor{ID: "root"}, alice.ID))
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	assert.Equal(t, ErrInvalidToken, err)
+	_, err = svc.Login(ctx, creds, testClient)
+	assert.Equal(t, ErrPasswordResetRequired, err)
+	_, resetRequired, err = admin.statusCache.AccountStatus(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.True(t, resetRequired)
+
+	var msg string
+	select {
+	case sent := <-mail.sent:
+		msg = sent.Body
+	case <-time.After(time.Second):
+		t.Fatal("reset email was not sent")
+	}
+	token := regexp.MustCompile(`password: (\S+)`).FindStringSubmatch(msg)[1]
+
+	reset := &models.PasswordReset{Identifier: "alice@example.com", Token: "wrong", NewPassword: "Quill-Harbor-Lantern"}
+	assert.Equal(t, ErrInvalidToken, svc.ResetPassword(ctx, reset, testClient))
+
+	reset.Token = token
+	require.NoError(t, svc.ResetPassword(ctx, reset, testClient))
+	_, err = svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Quill-Harbor-Lantern"}, testClient)
+	require.NoError(t, err)
+	_, resetRequired, err = admin.statusCache.AccountStatus(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.False(t, resetRequired)
+
+	// The token is single use
+	assert.Equal(t, ErrInvalidToken, svc.ResetPassword(ctx, reset, testClient))
+}
+
+func TestAdminSetStatus(t *testing.T) {
+	ctx := t.Context()
+	admin, svc, _, _ := newTestAdminService(t)
+	alice, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	creds := &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}
+	actor := audit.Actor{ID: "root"}
+
+	past := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name   string
+		change models.AccountStatusChange
+	}{
+		{"Unknown status", models.AccountStatusChange{Status: "banned"}},
+		{"End time in the past", models.AccountStatusChange{Status: models.StatusSuspended, Until: &past}},
+		{"End time for a status other than suspended", models.AccountStatusChange{Status: models.StatusDisabled, Until: &past}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, ErrInvalidStatus, admin.SetStatus(ctx, actor, alice.ID, &tt.change))
+		})
+	}
+
+	for _, status := range []string{models.StatusSuspended, models.StatusPendingVerification} {
+		t.Run(status, func(t *testing.T) {
+			tokens, err := svc.Login(ctx, creds, testClient)
+			require.NoError(t, err)
+
+			until := time.Now().Add(time.Hour)
+			change := &models.AccountStatusChange{Status: status, Reason: "review"}
+			if status == models.StatusSuspended {
+				change.Until = &until
+			}
+			require.NoError(t, admin.SetStatus(ctx, actor, alice.ID, change))
+			cached, _, err := admin.statusCache.AccountStatus(ctx, alice.ID)
+			require.NoError(t, err)
+			assert.Equal(t, status, cached.Status)
+
+			_, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+			assert.Equal(t, ErrInvalidToken, err)
+
+			_, err = svc.Login(ctx, creds, testClient)
+			var statusErr *AccountStatusError
+			require.ErrorAs(t, err, &statusErr)
+			assert.Equal(t, status, statusErr.Status)
+			assert.Equal(t, "review", statusErr.StatusReason)
+
+			require.NoError(t, admin.EnableUser(ctx, actor, alice.ID))
+		})
+	}
+
+	// A suspension ends by itself once its end time has passed
+	until := time.Now().Add(time.Hour)
+	require.NoError(t, admin.SetStatus(ctx, actor, alice.ID, &models.AccountStatusChange{Status: models.StatusSuspended, Until: &until}))
+	user, err := svc.userRepo.GetByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusSuspended, user.EffectiveStatus(time.Now()))
+	assert.Equal(t, models.StatusActive, user.EffectiveStatus(until))
+}
+
+func TestAdminRevocationsPublishEvents(t *testing.T) {
+	ctx := t.Context()
+	admin, svc, _, _ := newTestAdminService(t)
+	alice, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	actor := audit.Actor{ID: "root"}
+	revocations := func() int {
+		count := 0
+		for _, eventType := range outboxTypes(t, svc) {
+			if eventType == events.TypeSessionRevoked {
+				count++
+			}
+		}
+		return count
+	}
+
+	// Every way an administrator ends a user's sessions publishes an event
+	require.NoError(t, admin.LogoutUser(ctx, actor, alice.ID))
+	assert.Equal(t, 1, revocations())
+	require.NoError(t, admin.RequirePasswordReset(ctx, actor, alice.ID))
+	assert.Equal(t, 2, revocations())
+	require.NoError(t, admin.DisableUser(ctx, actor, alice.ID, "spam"))
+	assert.Equal(t, 3, revocations())
+
+	// Reactivating an account ends no sessions
+	require.NoError(t, admin.EnableUser(ctx, actor, alice.ID))
+	assert.Equal(t, 3, revocations())
+}
@@ -1,11 +1,24 @@
 package service
 
 import (
+	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"learn/internal/audit"
 	"learn/internal/config"
+	"learn/internal/events"
+	"learn/internal/mailer"
+	"learn/internal/metrics"
 	"learn/internal/models"
+	"learn/internal/policy"
 	"learn/internal/repository"
 	"learn/internal/utils"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,46 +28,153 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserExists         = errors.New("user already exists")
 	ErrInvalidToken       = errors.New("invalid token")
+	ErrSessionNotFound    = errors.New("session not found")
+	// ErrPasswordResetRequired is returned by Login for an account whose
+	// password must be reset before it can be used again
+	ErrPasswordResetRequired = errors.New("password reset required")
 )
 
+// AccountStatusError is returned when an account that is not active tries
+// to log in or use its tokens
+type AccountStatusError struct {
+	models.AccountStatus
+}
+
+func (e *AccountStatusError) Error() string {
+	return "account " + strings.ReplaceAll(e.Status, "_", " ")
+}
+
+// checkAccountStatus returns an AccountStatusError if the user's account
+// is not active
+func checkAccountStatus(user *models.User, now time.Time) error {
+	if user.Active(now) {
+		return nil
+	}
+	return &AccountStatusError{AccountStatus: user.AccountStatus}
+}
+
+// boundTo reports whether a token may be used by a client. A token bound to
+// a client certificate must be presented over mutual TLS with that
+// certificate, and one bound to a DPoP key with a proof signed by that key.
+func boundTo(claims *models.TokenClaims, client *models.ClientInfo) bool {
+	return (claims.CertificateThumbprint == "" || claims.CertificateThumbprint == client.CertificateThumbprint) &&
+		(claims.KeyThumbprint == "" || claims.KeyThumbprint == client.KeyThumbprint)
+}
+
 // AuthService handles authentication-related business logic
 type AuthService struct {
 	userRepo  repository.UserRepository
 	tokenRepo repository.TokenRepository
+	hasher    utils.PasswordHasher
+	policy    *policy.PasswordPolicy
+	mailer    mailer.Mailer
+	auditLog  audit.Logger
+	events    eventPublisher
+	metrics   *metrics.Metrics
 	config    *config.Config
+
+	// dummyHash is verified against when a login names an unknown user, so
+	// that unknown and known usernames cost the same hash comparison
+	dummyHash string
+	// sending tracks mail being sent in the background
+	sending sync.WaitGroup
 }
 
-// NewAuthService creates a new authentication service
-func NewAuthService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, config *config.Config) *AuthService {
-	return &AuthService{
-		userRepo:  userRepo,
-		tokenRepo: tokenRepo,
+// NewAuthService creates a new authentication service. Changes to users
+// and sessions are made in transactions of the store, which also record the
+// domain events published on the bus. The outcome of each operation is
+// recorded in metrics, which may be nil. It fails if the hasher cannot hash
+// the dummy password that logins of unknown users are checked against.
+func NewAuthService(store repository.Store, hasher utils.PasswordHasher, policy *policy.PasswordPolicy, mailer mailer.Mailer, auditLog audit.Logger, bus *events.Bus, metrics *metrics.Metrics, config *config.Config) (*AuthService, error) {
+	// The password is random and never revealed, so the hash can never match.
+	// Without it, logins of unknown users would skip the hash comparison and
+	// could be told apart by their timing.
+	dummyHash, err := hasher.Hash(uuid.New().String())
+	if err != nil {
+		return nil, fmt.Errorf("hashing the dummy password: %w", err)
+	}
+
+	s := &AuthService{
+		userRepo:  store.Users(),
+		tokenRepo: store.Tokens(),
+		hasher:    hasher,
+		policy:    policy,
+		mailer:    mailer,
+		auditLog:  auditLog,
+		events:    eventPublisher{store: store, bus: bus},
+		metrics:   metrics,
 		config:    config,
+		dummyHash: dummyHash,
 	}
+	events.SubscribeAsync(bus, "welcome_mail", s.welcome)
+	return s, nil
+}
+
+// EnumerationSafeRegistration reports whether registration hides whether a
+// username or email is already taken. In that mode Register returns a nil
+// user and nil error for a conflicting registration and notifies the owner
+// by email instead.
+func (s *AuthService) EnumerationSafeRegistration() bool {
+	return s.config.Auth.EnumerationSafeRegistration
 }
 
 // Register registers a new user
-func (s *AuthService) Register(reg *models.UserRegistration) (*models.User, error) {
+func (s *AuthService) Register(ctx context.Context, reg *models.UserRegistration, client *models.ClientInfo) (_ *models.User, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Register")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.register(ctx, reg, client)
+
+	event := s.newEvent(audit.ActionRegister, "", client, err)
+	if user != nil {
+		event.ActorID = user.ID
+	}
+	audit.Write(s.auditLog, event)
+	s.observe(OperationRegister, failureReason(err))
+
+	if err == ErrUserExists && s.EnumerationSafeRegistration() {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (s *AuthService) register(ctx context.Context, reg *models.UserRegistration, client *models.ClientInfo) (*models.User, error) {
+	// Normalize identifiers so equivalent spellings map to the same account
+	reg = &models.UserRegistration{
+		Username: utils.CanonicalizeUsername(reg.Username),
+		Email:    utils.CanonicalizeEmail(reg.Email),
+		Password: reg.Password,
+	}
+	if err := utils.ValidateUsername(reg.Username); err != nil {
+		return nil, err
+	}
+
+	// Check password against the policy
+	err := s.policy.Validate(reg.Password, policy.UserInfo{Username: reg.Username, Email: reg.Email})
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if user already exists
-	_, err := s.userRepo.GetByUsername(reg.Username)
+	_, err = s.userRepo.GetByUsername(ctx, reg.Username)
 	if err == nil {
-		return nil, ErrUserExists
+		return nil, s.registrationConflict(ctx, reg, nil)
 	}
 	if err != repository.ErrUserNotFound {
 		return nil, err
 	}
 
 	// Check if email already exists
-	_, err = s.userRepo.GetByEmail(reg.Email)
+	owner, err := s.userRepo.GetByEmail(ctx, reg.Email)
 	if err == nil {
-		return nil, ErrUserExists
+		return nil, s.registrationConflict(ctx, reg, owner)
 	}
 	if err != repository.ErrUserNotFound {
 		return nil, err
 	}
 
 	// Hash password
-	hashedPassword, err := utils.HashPassword(reg.Password)
+	hashedPassword, err := s.hashPassword(ctx, reg.Password)
 	if err != nil {
 		return nil, err
 	}
@@ -62,120 +182,635 @@ func (s *AuthService) Register(reg *models.UserRegistration) (*models.User, erro
 	// Create user
 	now := time.Now()
 	user := &models.User{
-		ID:           uuid.New().String(),
-		Username:     reg.Username,
-		Email:        reg.Email,
-		PasswordHash: hashedPassword,
-		CreatedAt:    now,
-		UpdatedAt:    now,
+		ID:            uuid.New().String(),
+		Username:      reg.Username,
+		Email:         reg.Email,
+		Role:          models.RoleUser,
+		PasswordHash:  hashedPassword,
+		AccountStatus: models.AccountStatus{Status: models.StatusActive},
+		CreatedAt:     now,
+		UpdatedAt:     now,
 	}
 
 	// Save user
-	err = s.userRepo.Create(user)
+	err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		return tx.Users().Create(ctx, user)
+	}, events.UserRegistered{Metadata: events.NewMetadata(client), User: events.UserOf(user)})
 	if err != nil {
+		if err == repository.ErrUserAlreadyExists {
+			return nil, s.registrationConflict(ctx, reg, nil)
+		}
 		return nil, err
 	}
 
 	return user, nil
 }
 
-// Login authenticates a user and returns tokens
-func (s *AuthService) Login(creds *models.UserCredentials) (*models.TokenPair, error) {
-	// Get user by username
-	user, err := s.userRepo.GetByUsername(creds.Username)
+// welcome greets a newly registered user by email when registration is
+// enumeration-safe, since the response then does not confirm the account
+// was created
+func (s *AuthService) welcome(event events.UserRegistered) error {
+	if !s.EnumerationSafeRegistration() {
+		return nil
+	}
+	return s.mailer.Send(mailer.Message{
+		To:      event.Email,
+		Subject: "Welcome",
+		Body:    "Your account " + event.Username + " has been created.",
+	})
+}
+
+// registrationConflict handles a registration whose username or email is
+// already taken and returns ErrUserExists. owner is the account holding the
+// email, if known. If registration is enumeration-safe the work of a
+// successful registration is mirrored and the conflict is reported by email
+// to the address owner.
+func (s *AuthService) registrationConflict(ctx context.Context, reg *models.UserRegistration, owner *models.User) error {
+	if !s.EnumerationSafeRegistration() {
+		return ErrUserExists
+	}
+
+	// Spend the same time hashing as a successful registration would
+	_, _ = s.hashPassword(ctx, reg.Password)
+
+	if owner != nil {
+		s.sendMail(mailer.Message{
+			To:      owner.Email,
+			Subject: "Registration attempt",
+			Body:    "Someone tried to register a new account with your email address. If this was you, you can log in to your existing account instead.",
+		})
+	} else {
+		s.sendMail(mailer.Message{
+			To:      reg.Email,
+			Subject: "Username unavailable",
+			Body:    "The username " + reg.Username + " is already taken. Please register again with a different username.",
+		})
+	}
+	return ErrUserExists
+}
+
+// sendMail sends a message in the background so that mail delivery does not
+// affect response timing
+func (s *AuthService) sendMail(msg mailer.Message) {
+	s.sending.Add(1)
+	go func() {
+		defer s.sending.Done()
+		if err := s.mailer.Send(msg); err != nil {
+			slog.Error("Failed to send mail", "to", msg.To, "subject", msg.Subject, "error", err)
+		}
+	}()
+}
+
+// Flush waits for mail being sent in the background, or until ctx is done
+func (s *AuthService) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.sending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Login authenticates a user by username or email, starts a session for
+// the client and returns tokens
+func (s *AuthService) Login(ctx context.Context, creds *models.UserCredentials, client *models.ClientInfo) (_ *models.TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	defer func() { endSpan(span, err) }()
+
+	tokens, user, err := s.login(ctx, creds, client)
+
+	event := s.newEvent(audit.ActionLogin, "", client, err)
+	if user != nil {
+		event.ActorID = user.ID
+		if err == ErrInvalidCredentials {
+			event.Reason = "wrong password"
+		}
+	} else if err == ErrInvalidCredentials {
+		event.Reason = "unknown user " + strconv.Quote(creds.LoginIdentifier())
+	}
+	audit.Write(s.auditLog, event)
+	// Metrics do not tell an unknown user from a wrong password, which
+	// would reveal to anyone who can read them which accounts exist
+	s.observe(OperationLogin, failureReason(err))
+	if err != nil {
+		failed := events.LoginFailed{
+			Metadata:   events.NewMetadata(client),
+			Identifier: creds.LoginIdentifier(),
+			Reason:     loginFailureReason(user, err),
+		}
+		if user != nil {
+			failed.UserID = user.ID
+		}
+		s.events.publish(failed)
+	}
+
+	return tokens, err
+}
+
+// login authenticates a user and starts a session. The user is returned
+// whenever the identifier names an existing account, even on failure.
+func (s *AuthService) login(ctx context.Context, creds *models.UserCredentials, client *models.ClientInfo) (*models.TokenPair, *models.User, error) {
+	// Get user by email or username
+	var user *models.User
+	var err error
+	identifier := creds.LoginIdentifier()
+	if utils.IsEmailIdentifier(identifier) {
+		user, err = s.userRepo.GetByEmail(ctx, identifier)
+	} else {
+		user, err = s.userRepo.GetByUsername(ctx, identifier)
+	}
 	if err != nil {
 		if err == repository.ErrUserNotFound {
-			return nil, ErrInvalidCredentials
+			// Compare against a dummy hash so that the response takes as long
+			// as for a known user and does not reveal which accounts exist
+			_, _ = s.verifyPassword(ctx, creds.Password, s.dummyHash)
+			return nil, nil, ErrInvalidCredentials
 		}
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Check password
-	if !utils.CheckPasswordHash(creds.Password, user.PasswordHash) {
-		return nil, ErrInvalidCredentials
+	match, err := s.verifyPassword(ctx, creds.Password, user.PasswordHash)
+	if err != nil || !match {
+		return nil, user, ErrInvalidCredentials
+	}
+
+	// Only reveal the account state to someone who knows the password
+	if err := checkAccountStatus(user, time.Now()); err != nil {
+		return nil, user, err
+	}
+	if user.PasswordResetRequired {
+		return nil, user, ErrPasswordResetRequired
+	}
+
+	// Upgrade the stored hash if it was made with a weaker algorithm or parameters
+	s.rehashPassword(ctx, user, creds.Password)
+
+	// Start a session for the client
+	now := time.Now()
+	lifetime := s.sessionLifetime(user, client.ClientID)
+	session := &models.Session{
+		ID:                uuid.New().String(),
+		UserID:            user.ID,
+		ClientID:          client.ClientID,
+		Name:              client.DeviceName,
+		UserAgent:         client.UserAgent,
+		IPAddress:         client.IPAddress,
+		CreatedAt:         now,
+		LastUsedAt:        now,
+		IdleTimeout:       lifetime.IdleTimeout,
+		AbsoluteExpiresAt: now.Add(lifetime.MaxLifetime),
+	}
+	session.ExpiresAt = session.NextExpiry(now)
+	if session.Name == "" {
+		session.Name = utils.DeviceName(client.UserAgent)
 	}
 
 	// Generate tokens
-	tokenPair, err := utils.GenerateTokenPair(
-		user.ID,
-		user.Username,
+	tokenPair, err := s.generateTokenPair(ctx, user, session, client.TokenBinding, now)
+	if err != nil {
+		return nil, user, err
+	}
+
+	// Store session with its refresh token
+	err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		return tx.Tokens().Store(ctx, tokenPair.RefreshToken, session)
+	}, events.LoginSucceeded{Metadata: events.NewMetadata(client), User: events.UserOf(user), SessionID: session.ID})
+	if err != nil {
+		return nil, user, err
+	}
+
+	return tokenPair, user, nil
+}
+
+// generateTokenPair generates access and refresh tokens for a user's
+// session, bound to the keys in binding. Neither token outlives the
+// session.
+func (s *AuthService) generateTokenPair(ctx context.Context, user *models.User, session *models.Session, binding models.TokenBinding, now time.Time) (*models.TokenPair, error) {
+	_, span := tracer.Start(ctx, "AuthService.generateTokenPair")
+	defer span.End()
+
+	accessTTL := s.config.JWT.AccessTokenTTL
+	if remaining := session.AbsoluteExpiresAt.Sub(now); remaining < accessTTL {
+		accessTTL = remaining
+	}
+
+	return utils.GenerateTokenPairForClaims(
+		&models.TokenClaims{
+			UserID:       user.ID,
+			Username:     user.Username,
+			SessionID:    session.ID,
+			TokenBinding: binding,
+		},
 		s.config.JWT.Secret,
-		s.config.JWT.AccessTokenTTL,
-		s.config.JWT.RefreshTokenTTL,
+		accessTTL,
+		session.ExpiresAt.Sub(now),
 	)
+}
+
+// sessionLifetime returns the idle timeout and maximum lifetime of a new
+// session for the user on the given client. An override configured for the
+// user's role replaces the defaults. The client ID is declared by the client
+// itself, so an override configured for it can only shorten the lifetime.
+func (s *AuthService) sessionLifetime(user *models.User, clientID string) config.SessionLifetime {
+	lifetime := config.SessionLifetime{
+		IdleTimeout: s.config.JWT.RefreshTokenTTL,
+		MaxLifetime: s.config.JWT.SessionMaxLifetime,
+	}
+	if override, ok := s.config.JWT.SessionOverrides["role:"+user.Role]; ok && user.Role != "" {
+		lifetime = override
+	}
+	if override, ok := s.config.JWT.SessionOverrides["client:"+clientID]; ok && clientID != "" {
+		lifetime.IdleTimeout = min(lifetime.IdleTimeout, override.IdleTimeout)
+		lifetime.MaxLifetime = min(lifetime.MaxLifetime, override.MaxLifetime)
+	}
+	return lifetime
+}
+
+// ChangePassword changes a user's password after verifying the current one.
+// All of the user's refresh tokens and personal access tokens are revoked so
+// other sessions must log in again.
+func (s *AuthService) ChangePassword(ctx context.Context, userID string, change *models.PasswordChange, client *models.ClientInfo) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ChangePassword")
+	defer func() { endSpan(span, err) }()
+
+	err = s.changePassword(ctx, userID, change, client)
+	s.record(audit.ActionPasswordChange, userID, userID, client, err)
+	return err
+}
+
+func (s *AuthService) changePassword(ctx context.Context, userID string, change *models.PasswordChange, client *models.ClientInfo) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	// Check current password
+	match, err := s.verifyPassword(ctx, change.CurrentPassword, user.PasswordHash)
+	if err != nil || !match {
+		return ErrInvalidCredentials
+	}
+
+	return s.setPassword(ctx, user, change.NewPassword, client, false)
+}
+
+// setPassword validates a new password against the policy, stores its hash
+// and revokes the user's refresh tokens and personal access tokens. reset is
+// set when the password is reset with an emailed token.
+func (s *AuthService) setPassword(ctx context.Context, user *models.User, password string, client *models.ClientInfo, reset bool) error {
+	err := s.policy.Validate(password, policy.UserInfo{Username: user.Username, Email: user.Email})
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hashPassword(ctx, password)
+	if err != nil {
+		return err
+	}
+
+	updated := *user
+	updated.PasswordHash = hashedPassword
+	updated.PasswordResetRequired = false
+	updated.PasswordResetTokenHash = ""
+	updated.PasswordResetExpiresAt = time.Time{}
+	updated.UpdatedAt = time.Now()
+	return s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		if err := tx.Users().Update(ctx, &updated); err != nil {
+			return err
+		}
+		if err := tx.Tokens().DeleteAllForUser(ctx, user.ID); err != nil {
+			return err
+		}
+		return tx.AccessTokens().DeleteAllForUser(ctx, user.ID)
+	}, events.PasswordChanged{Metadata: events.NewMetadata(client), User: events.UserOf(&updated), Reset: reset})
+}
+
+// RequirePasswordReset forces a user to reset their password. The user is
+// logged out of every session and emailed a single-use reset token; the
+// account cannot log in until the password is reset with it.
+func (s *AuthService) RequirePasswordReset(ctx context.Context, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RequirePasswordReset")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updated := *user
+	updated.PasswordResetRequired = true
+	updated.PasswordResetTokenHash = utils.HashAccessToken(token)
+	updated.PasswordResetExpiresAt = now.Add(s.config.Auth.PasswordResetTTL)
+	updated.UpdatedAt = now
+	err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		if err := tx.Users().Update(ctx, &updated); err != nil {
+			return err
+		}
+		return tx.Tokens().DeleteAllForUser(ctx, user.ID)
+	}, events.SessionRevoked{Metadata: events.NewMetadata(nil), UserID: user.ID, Others: true})
+	if err != nil {
+		return err
+	}
+
+	s.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Password reset required",
+		Body:    "An administrator has required you to reset the password of your account " + user.Username + ". Use this token to choose a new password: " + token + "\nThe token expires at " + updated.PasswordResetExpiresAt.UTC().Format(time.RFC1123) + ".",
+	})
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token sent by
+// RequirePasswordReset. It returns ErrInvalidToken if the account has no
+// pending reset or the token is wrong or expired.
+func (s *AuthService) ResetPassword(ctx context.Context, reset *models.PasswordReset, client *models.ClientInfo) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ResetPassword")
+	defer func() { endSpan(span, err) }()
+
+	user, err := s.resetPassword(ctx, reset, client)
+
+	event := s.newEvent(audit.ActionPasswordReset, "", client, err)
+	if user != nil {
+		event.ActorID = user.ID
+		event.TargetID = user.ID
 	}
+	audit.Write(s.auditLog, event)
 
-	// Store refresh token
-	expiresAt := time.Now().Add(s.config.JWT.RefreshTokenTTL)
-	err = s.tokenRepo.Store(user.ID, tokenPair.RefreshToken, expiresAt)
+	return err
+}
+
+// resetPassword resets a password, returning the user whenever the
+// identifier names an existing account
+func (s *AuthService) resetPassword(ctx context.Context, reset *models.PasswordReset, client *models.ClientInfo) (*models.User, error) {
+	var user *models.User
+	var err error
+	if utils.IsEmailIdentifier(reset.Identifier) {
+		user, err = s.userRepo.GetByEmail(ctx, reset.Identifier)
+	} else {
+		user, err = s.userRepo.GetByUsername(ctx, reset.Identifier)
+	}
 	if err != nil {
+		if err == repository.ErrUserNotFound {
+			return nil, ErrInvalidToken
+		}
 		return nil, err
 	}
 
-	return tokenPair, nil
+	tokenHash := utils.HashAccessToken(reset.Token)
+	if !user.PasswordResetRequired ||
+		subtle.ConstantTimeCompare([]byte(tokenHash), []byte(user.PasswordResetTokenHash)) != 1 ||
+		!time.Now().Before(user.PasswordResetExpiresAt) {
+		return user, ErrInvalidToken
+	}
+
+	return user, s.setPassword(ctx, user, reset.NewPassword, client, true)
 }
 
-// RefreshToken refreshes an access token using a refresh token
-func (s *AuthService) RefreshToken(refreshToken string) (*models.TokenPair, error) {
-	// Validate refresh token
-	claims, err := utils.ValidateJWT(refreshToken, s.config.JWT.Secret)
+// rehashPassword transparently upgrades a user's password hash to the
+// preferred algorithm and parameters. Failures are not fatal to the login,
+// since the existing hash is still valid.
+func (s *AuthService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	if !s.hasher.NeedsRehash(user.PasswordHash) {
+		return
+	}
+
+	hashedPassword, err := s.hashPassword(ctx, password)
 	if err != nil {
-		return nil, ErrInvalidToken
+		return
+	}
+
+	updated := *user
+	updated.PasswordHash = hashedPassword
+	updated.UpdatedAt = time.Now()
+	_ = s.userRepo.Update(ctx, &updated)
+}
+
+// RefreshToken refreshes an access token using a refresh token. The
+// session is kept and its refresh token rotated. Each refresh extends the
+// session by its idle timeout, bounded by its absolute lifetime.
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string, client *models.ClientInfo) (_ *models.TokenPair, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RefreshToken")
+	defer func() { endSpan(span, err) }()
+
+	tokens, session, err := s.refreshToken(ctx, refreshToken, client)
+
+	event := s.newEvent(audit.ActionRefresh, "", client, err)
+	if session != nil {
+		event.ActorID = session.UserID
+		event.TargetID = session.ID
+	}
+	audit.Write(s.auditLog, event)
+	s.observe(OperationRefresh, failureReason(err))
+
+	return tokens, err
+}
+
+// refreshToken refreshes a session's tokens, returning the session whenever
+// the refresh token belongs to one
+func (s *AuthService) refreshToken(ctx context.Context, refreshToken string, client *models.ClientInfo) (*models.TokenPair, *models.Session, error) {
+	// Validate refresh token
+	claims, err := utils.ValidateJWT(refreshToken, s.config.JWT.Secret, models.TokenTypeRefresh)
+	if err != nil || !boundTo(claims, client) {
+		return nil, nil, ErrInvalidToken
 	}
 
 	// Check if token exists in repository
-	userID, err := s.tokenRepo.GetUserIDByToken(refreshToken)
+	session, err := s.tokenRepo.GetSessionByToken(ctx, refreshToken)
 	if err != nil {
-		return nil, ErrInvalidToken
+		return nil, nil, ErrInvalidToken
 	}
 
 	// Verify user ID from token matches user ID from repository
-	if claims.UserID != userID {
-		return nil, ErrInvalidToken
+	if claims.UserID != session.UserID {
+		return nil, session, ErrInvalidToken
+	}
+
+	// Refreshing cannot extend a session past its absolute lifetime
+	now := time.Now()
+	if !now.Before(session.AbsoluteExpiresAt) {
+		_ = s.tokenRepo.DeleteByToken(ctx, refreshToken)
+		return nil, session, ErrInvalidToken
 	}
 
 	// Get user
-	user, err := s.userRepo.GetByID(userID)
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
 	if err != nil {
-		return nil, err
+		return nil, session, err
+	}
+	if err := checkAccountStatus(user, now); err != nil {
+		_ = s.tokenRepo.DeleteByToken(ctx, refreshToken)
+		return nil, session, err
+	}
+	if user.PasswordResetRequired {
+		_ = s.tokenRepo.DeleteByToken(ctx, refreshToken)
+		return nil, session, ErrInvalidToken
 	}
 
-	// Delete old refresh token
-	err = s.tokenRepo.DeleteByToken(refreshToken)
+	// Extend the session by its idle timeout and generate new tokens
+	session.LastUsedAt = now
+	session.ExpiresAt = session.NextExpiry(now)
+	tokenPair, err := s.generateTokenPair(ctx, user, session, claims.TokenBinding, now)
 	if err != nil {
-		return nil, err
+		return nil, session, err
 	}
 
-	// Generate new tokens
-	tokenPair, err := utils.GenerateTokenPair(
-		user.ID,
-		user.Username,
-		s.config.JWT.Secret,
-		s.config.JWT.AccessTokenTTL,
-		s.config.JWT.RefreshTokenTTL,
-	)
+	// Replace the old refresh token and record the session's use
+	if client.IPAddress != "" {
+		session.IPAddress = client.IPAddress
+	}
+	err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		return tx.Tokens().Rotate(ctx, refreshToken, tokenPair.RefreshToken, session)
+	}, events.TokenRefreshed{Metadata: events.NewMetadata(client), UserID: session.UserID, SessionID: session.ID})
 	if err != nil {
-		return nil, err
+		if err == repository.ErrTokenNotFound {
+			// The token was used concurrently or revoked in the meantime
+			return nil, session, ErrInvalidToken
+		}
+		return nil, session, err
 	}
 
-	// Store new refresh token
-	expiresAt := time.Now().Add(s.config.JWT.RefreshTokenTTL)
-	err = s.tokenRepo.Store(user.ID, tokenPair.RefreshToken, expiresAt)
+	return tokenPair, session, nil
+}
+
+// Logout invalidates a refresh token
+func (s *AuthService) Logout(ctx context.Context, refreshToken string, client *models.ClientInfo) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Logout")
+	defer func() { endSpan(span, err) }()
+
+	event := s.newEvent(audit.ActionLogout, "", client, nil)
+	var revoked []events.Event
+	if session, err := s.tokenRepo.GetSessionByToken(ctx, refreshToken); err == nil {
+		event.ActorID = session.UserID
+		event.TargetID = session.ID
+		revoked = append(revoked, events.SessionRevoked{
+			Metadata:  events.NewMetadata(client),
+			UserID:    session.UserID,
+			SessionID: session.ID,
+		})
+	}
+
+	err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		return tx.Tokens().DeleteByToken(ctx, refreshToken)
+	}, revoked...)
+	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event.Reason = err.Error()
+	}
+	audit.Write(s.auditLog, event)
+	s.observe(OperationLogout, failureReason(err))
+	return err
+}
+
+// LogoutSession invalidates the session an access token was issued for,
+// for clients that cannot present their refresh token
+func (s *AuthService) LogoutSession(ctx context.Context, accessToken string, client *models.ClientInfo) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.LogoutSession")
+	defer func() { endSpan(span, err) }()
+
+	claims, err := utils.ValidateJWT(accessToken, s.config.JWT.Secret, models.TokenTypeAccess)
+	if err != nil || claims.SessionID == "" || !boundTo(claims, client) {
+		s.record(audit.ActionLogout, "", "", client, ErrInvalidToken)
+		s.observe(OperationLogout, failureReason(ErrInvalidToken))
+		return ErrInvalidToken
+	}
+
+	err = s.revokeSession(ctx, claims.UserID, claims.SessionID, client)
+	s.record(audit.ActionLogout, claims.UserID, claims.SessionID, client, err)
+	s.observe(OperationLogout, failureReason(err))
+	return err
+}
+
+// LogoutAll invalidates all refresh tokens for a user
+func (s *AuthService) LogoutAll(ctx context.Context, userID string) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.LogoutAll")
+	defer func() { endSpan(span, err) }()
+
+	return s.tokenRepo.DeleteAllForUser(ctx, userID)
+}
+
+// ListSessions returns a user's active sessions, most recently used first,
+// marking the one with the given ID as current
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentSessionID string) (_ []*models.Session, err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ListSessions")
+	defer func() { endSpan(span, err) }()
+
+	sessions, err := s.tokenRepo.ListSessions(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	return tokenPair, nil
+	now := time.Now()
+	active := make([]*models.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if now.After(session.ExpiresAt) {
+			continue
+		}
+		session.Current = session.ID == currentSessionID
+		active = append(active, session)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].LastUsedAt.After(active[j].LastUsedAt)
+	})
+	return active, nil
 }
 
-// Logout invalidates a refresh token
-func (s *AuthService) Logout(refreshToken string) error {
-	return s.tokenRepo.DeleteByToken(refreshToken)
+// RevokeSession ends one of a user's sessions
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID string, client *models.ClientInfo) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokeSession")
+	defer func() { endSpan(span, err) }()
+
+	err = s.revokeSession(ctx, userID, sessionID, client)
+	s.record(audit.ActionRevokeSession, userID, sessionID, client, err)
+	return err
 }
 
-// LogoutAll invalidates all refresh tokens for a user
-func (s *AuthService) LogoutAll(userID string) error {
-	return s.tokenRepo.DeleteAllForUser(userID)
+func (s *AuthService) revokeSession(ctx context.Context, userID, sessionID string, client *models.ClientInfo) error {
+	err := s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		return tx.Tokens().DeleteSession(ctx, userID, sessionID)
+	}, events.SessionRevoked{Metadata: events.NewMetadata(client), UserID: userID, SessionID: sessionID})
+	if err == repository.ErrSessionNotFound {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
+// RevokeOtherSessions ends all of a user's sessions except the current one
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID string, client *models.ClientInfo) (err error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RevokeOtherSessions")
+	defer func() { endSpan(span, err) }()
+
+	err = s.events.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		return tx.Tokens().DeleteAllForUserExcept(ctx, userID, currentSessionID)
+	}, events.SessionRevoked{Metadata: events.NewMetadata(client), UserID: userID, SessionID: currentSessionID, Others: true})
+	s.record(audit.ActionRevokeOtherSessions, userID, "", client, err)
+	return err
+}
+
+// newEvent creates an audit event for an action by the client
+func (s *AuthService) newEvent(action, actorID string, client *models.ClientInfo, err error) *audit.Event {
+	actor := audit.Actor{ID: actorID}
+	if client != nil {
+		actor.IPAddress = client.IPAddress
+		actor.UserAgent = client.UserAgent
+	}
+	return audit.NewEvent(actor, action, "", err)
+}
+
+// record writes an audit event for an action by a user and its outcome
+func (s *AuthService) record(action, actorID, targetID string, client *models.ClientInfo, err error) {
+	event := s.newEvent(action, actorID, client, err)
+	event.TargetID = targetID
+	audit.Write(s.auditLog, event)
 }
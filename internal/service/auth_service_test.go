@@ -0,0 +1,668 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"learn/internal/audit"
+	"learn/internal/config"
+	"learn/internal/events"
+	"learn/internal/mailer"
+	"learn/internal/models"
+	"learn/internal/policy"
+	"learn/internal/repository"
+	"learn/internal/utils"
+	"learn/internal/webhook"
+	"learn/internal/worker"
+	"math"
+	"math/rand/v2"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMailer captures sent messages
+type recordingMailer struct {
+	sent chan mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// recordingAuditLogger captures audit events
+type recordingAuditLogger struct {
+	events []*audit.Event
+	mutex  sync.Mutex
+}
+
+func (l *recordingAuditLogger) Record(event *audit.Event) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.events = append(l.events, event)
+	return nil
+}
+
+func (l *recordingAuditLogger) last() *audit.Event {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.events[len(l.events)-1]
+}
+
+// recordingPublisher captures published webhook events
+type recordingPublisher struct {
+	events []*webhook.Event
+	mutex  sync.Mutex
+}
+
+func (p *recordingPublisher) Publish(event *webhook.Event) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+// types returns the types of the published events in order
+func (p *recordingPublisher) types() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	types := []string{}
+	for _, event := range p.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+// newTestAuthService creates an AuthService backed by in-memory repositories
+// and a deliberately cheap password hasher
+func newTestAuthService(t *testing.T, cfg *config.Config) (*AuthService, *recordingMailer) {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	if cfg.JWT.Secret == "" {
+		cfg.JWT = config.JWTConfig{
+			Secret:             "test-secret-key",
+			AccessTokenTTL:     time.Minute,
+			RefreshTokenTTL:    time.Hour,
+			SessionMaxLifetime: 24 * time.Hour,
+		}
+	}
+
+	hasher := utils.NewPreferredHasher(utils.NewArgon2idHasher(utils.Argon2idParams{
+		Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+	}))
+	mail := &recordingMailer{sent: make(chan mailer.Message, 10)}
+
+	svc, err := NewAuthService(
+		repository.NewInMemoryStore(),
+		hasher,
+		&policy.PasswordPolicy{MinLength: 8},
+		mail,
+		&recordingAuditLogger{},
+		events.NewBus(),
+		nil,
+		cfg,
+	)
+	require.NoError(t, err)
+	return svc, mail
+}
+
+// relayEvents dispatches the events in the service's outbox to
+// asynchronous subscribers, as the outbox relay does in the background
+func relayEvents(svc *AuthService) {
+	worker.NewOutboxRelay(svc.events.store.Outbox(), svc.events.bus, config.DatabaseConfig{OutboxMaxAttempts: 1}).Relay(context.Background())
+}
+
+// outboxTypes returns the types of the events in the service's outbox,
+// oldest first
+func outboxTypes(t *testing.T, svc *AuthService) []string {
+	t.Helper()
+	records, err := svc.events.store.Outbox().Pending(t.Context(), time.Now(), 100)
+	require.NoError(t, err)
+	types := []string{}
+	for _, record := range records {
+		types = append(types, record.EventType)
+	}
+	return types
+}
+
+func TestRegisterEnumerationSafe(t *testing.T) {
+	ctx := t.Context()
+	svc, mail := newTestAuthService(t, &config.Config{
+		Auth: config.AuthConfig{EnumerationSafeRegistration: true},
+	})
+
+	user, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	// The welcome mail is sent by an asynchronous subscriber
+	relayEvents(svc)
+	assert.Equal(t, "alice@example.com", (<-mail.sent).To)
+
+	tests := []struct {
+		name   string
+		reg    models.UserRegistration
+		wantTo string
+	}{
+		{
+			name:   "Email taken notifies the owner",
+			reg:    models.UserRegistration{Username: "mallory", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"},
+			wantTo: "alice@example.com",
+		},
+		{
+			name:   "Username taken notifies the requester",
+			reg:    models.UserRegistration{Username: "alice", Email: "bob@example.com", Password: "Tr0mb-Kettle-Vixen"},
+			wantTo: "bob@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := svc.Register(ctx, &tt.reg, testClient)
+			assert.NoError(t, err)
+			assert.Nil(t, user)
+
+			select {
+			case msg := <-mail.sent:
+				assert.Equal(t, tt.wantTo, msg.To)
+			case <-time.After(time.Second):
+				t.Fatal("no mail sent")
+			}
+		})
+	}
+}
+
+func TestRegisterConflict(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+
+	_, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	_, err = svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "bob@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	assert.ErrorIs(t, err, ErrUserExists)
+}
+
+// testClient is the client information passed to Login in tests
+var testClient = &models.ClientInfo{UserAgent: "Go-http-client/1.1", IPAddress: "127.0.0.1"}
+
+// timingLeakThreshold is the Welch t statistic above which two timing
+// distributions are considered distinguishable, as used by dudect
+const timingLeakThreshold = 4.5
+
+func TestLoginTimingParity(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	ctx := t.Context()
+
+	svc, _ := newTestAuthService(t, nil)
+	_, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	knownUser := func() {
+		_, err := svc.Login(ctx, &models.UserCredentials{Username: "alice", Password: "wrong-password"}, testClient)
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+	unknownUser := func() {
+		_, err := svc.Login(ctx, &models.UserCredentials{Username: "nobody", Password: "wrong-password"}, testClient)
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	known, unknown := measureTiming(400, knownUser, unknownUser)
+	tStat := welchT(known, unknown)
+	t.Logf("known user mean %.0fns, unknown user mean %.0fns, t = %.2f", mean(known), mean(unknown), tStat)
+	assert.Less(t, math.Abs(tStat), timingLeakThreshold, "login timing reveals whether a username exists")
+}
+
+// TestTimingHarnessDetectsLeak checks that the harness is sensitive enough
+// to notice a skipped hash comparison, which is what Login used to do
+func TestTimingHarnessDetectsLeak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+
+	svc, _ := newTestAuthService(t, nil)
+	withHash := func() { _, _ = svc.hasher.Verify("wrong-password", svc.dummyHash) }
+	withoutHash := func() {}
+
+	a, b := measureTiming(400, withHash, withoutHash)
+	assert.Greater(t, math.Abs(welchT(a, b)), timingLeakThreshold)
+}
+
+// failingHasher is a password hasher whose hashing always fails
+type failingHasher struct {
+	utils.PasswordHasher
+}
+
+func (failingHasher) Hash(string) (string, error) {
+	return "", errors.New("out of memory")
+}
+
+func TestNewAuthServiceRequiresDummyHash(t *testing.T) {
+	_, err := NewAuthService(repository.NewInMemoryStore(), failingHasher{}, &policy.PasswordPolicy{}, &recordingMailer{}, &recordingAuditLogger{}, events.NewBus(), nil, &config.Config{})
+	assert.ErrorContains(t, err, "out of memory")
+}
+
+// measureTiming runs a and b n times each, in pairs, and returns their
+// durations in nanoseconds with the slowest 10% of each discarded, since
+// outliers come from scheduling and GC rather than from the code measured.
+// Garbage is collected before each pair, outside the measurement, and the
+// order within a pair is random, so that neither function is favoured by
+// when collections run or by running first.
+func measureTiming(n int, a, b func()) ([]float64, []float64) {
+	// Warm up caches and the allocator
+	for i := 0; i < 10; i++ {
+		a()
+		b()
+	}
+
+	ta := make([]float64, 0, n)
+	tb := make([]float64, 0, n)
+	measure := func(f func(), samples []float64) []float64 {
+		start := time.Now()
+		f()
+		return append(samples, float64(time.Since(start)))
+	}
+	for i := 0; i < n; i++ {
+		runtime.GC()
+		if rand.IntN(2) == 0 {
+			ta = measure(a, ta)
+			tb = measure(b, tb)
+		} else {
+			tb = measure(b, tb)
+			ta = measure(a, ta)
+		}
+	}
+	return trimSlowest(ta, 0.1), trimSlowest(tb, 0.1)
+}
+
+func trimSlowest(samples []float64, fraction float64) []float64 {
+	sort.Float64s(samples)
+	return samples[:len(samples)-int(float64(len(samples))*fraction)]
+}
+
+// welchT returns Welch's t statistic for the difference in means of two samples
+func welchT(a, b []float64) float64 {
+	va, vb := variance(a)/float64(len(a)), variance(b)/float64(len(b))
+	if va+vb == 0 {
+		return 0
+	}
+	return (mean(a) - mean(b)) / math.Sqrt(va+vb)
+}
+
+func mean(samples []float64) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += s
+	}
+	return sum / float64(len(samples))
+}
+
+func variance(samples []float64) float64 {
+	m := mean(samples)
+	var sum float64
+	for _, s := range samples {
+		sum += (s - m) * (s - m)
+	}
+	return sum / float64(len(samples)-1)
+}
+
+func TestLoginIdentifier(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	_, err := svc.Register(ctx, &models.UserRegistration{Username: "Alice", Email: "Alice@Example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		creds models.UserCredentials
+	}{
+		{"Username", models.UserCredentials{Identifier: "Alice", Password: "Tr0mb-Kettle-Vixen"}},
+		{"Username in other case", models.UserCredentials{Identifier: "ALICE", Password: "Tr0mb-Kettle-Vixen"}},
+		{"Email in other case", models.UserCredentials{Identifier: "alice@EXAMPLE.com", Password: "Tr0mb-Kettle-Vixen"}},
+		{"Legacy username field", models.UserCredentials{Username: "alice", Password: "Tr0mb-Kettle-Vixen"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := svc.Login(ctx, &tt.creds, testClient)
+			assert.NoError(t, err)
+			assert.NotNil(t, tokens)
+		})
+	}
+}
+
+func TestLoginAudit(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	user, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	auditLog := svc.auditLog.(*recordingAuditLogger)
+
+	tests := []struct {
+		name    string
+		creds   models.UserCredentials
+		actorID string
+		outcome string
+		reason  string
+	}{
+		{"Success", models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, user.ID, audit.OutcomeSuccess, ""},
+		{"Wrong password", models.UserCredentials{Identifier: "alice", Password: "wrong-password"}, user.ID, audit.OutcomeFailure, "wrong password"},
+		{"Unknown user", models.UserCredentials{Identifier: "nobody", Password: "wrong-password"}, "", audit.OutcomeFailure, `unknown user "nobody"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _ = svc.Login(ctx, &tt.creds, testClient)
+			event := auditLog.last()
+			assert.Equal(t, audit.ActionLogin, event.Action)
+			assert.Equal(t, tt.actorID, event.ActorID)
+			assert.Equal(t, tt.outcome, event.Outcome)
+			assert.Equal(t, tt.reason, event.Reason)
+			assert.Equal(t, testClient.IPAddress, event.IPAddress)
+		})
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	svc, _ := newTestAuthService(t, nil)
+	_, err := svc.Register(t.Context(), &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err = svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = svc.Register(ctx, &models.UserRegistration{Username: "bob", Email: "bob@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The cancelled registration created no user
+	_, err = svc.userRepo.GetByUsername(t.Context(), "bob")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestFlushWaitsForMail(t *testing.T) {
+	svc, mail := newTestAuthService(t, nil)
+	// Sending blocks until the message is received
+	mail.sent = make(chan mailer.Message)
+	svc.sendMail(mailer.Message{To: "alice@example.com", Subject: "Hello"})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, svc.Flush(ctx), context.DeadlineExceeded)
+
+	msg := <-mail.sent
+	assert.Equal(t, "alice@example.com", msg.To)
+	assert.NoError(t, svc.Flush(t.Context()))
+}
+
+func TestRegisterNormalizesIdentifiers(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	user, err := svc.Register(ctx, &models.UserRegistration{Username: "Ａｌｉｃｅ", Email: "Alice@Example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", user.Username)
+	assert.Equal(t, "alice@example.com", user.Email)
+
+	tests := []struct {
+		name string
+		reg  models.UserRegistration
+	}{
+		{"Username in other case", models.UserRegistration{Username: "alice", Email: "a2@example.com", Password: "Tr0mb-Kettle-Vixen"}},
+		{"Email in other case", models.UserRegistration{Username: "alice2", Email: "ALICE@example.com", Password: "Tr0mb-Kettle-Vixen"}},
+		{"Confusable username", models.UserRegistration{Username: "A1ice", Email: "a3@example.com", Password: "Tr0mb-Kettle-Vixen"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Register(ctx, &tt.reg, testClient)
+			assert.ErrorIs(t, err, ErrUserExists)
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	user, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	login := func(userAgent, deviceName string) *models.TokenClaims {
+		tokens, err := svc.Login(ctx,
+			&models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"},
+			&models.ClientInfo{UserAgent: userAgent, IPAddress: "127.0.0.1", DeviceName: deviceName},
+		)
+		require.NoError(t, err)
+		return claimsOf(t, svc, tokens.AccessToken, models.TokenTypeAccess)
+	}
+
+	laptop := login("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0", "")
+	phone := login("Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 Chrome/124.0 Mobile Safari/537.36", "")
+	script := login("curl/8.5.0", "Backup script")
+
+	sessions, err := svc.ListSessions(ctx, user.ID, laptop.SessionID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 3)
+	names := map[string]bool{}
+	for _, session := range sessions {
+		names[session.Name] = true
+		assert.Equal(t, session.ID == laptop.SessionID, session.Current)
+	}
+	assert.Equal(t, map[string]bool{"Firefox on Windows": true, "Chrome on Android": true, "Backup script": true}, names)
+
+	require.NoError(t, svc.RevokeSession(ctx, user.ID, phone.SessionID, testClient))
+	assert.ErrorIs(t, svc.RevokeSession(ctx, user.ID, phone.SessionID, testClient), ErrSessionNotFound)
+	assert.ErrorIs(t, svc.RevokeSession(ctx, "someone-else", script.SessionID, testClient), ErrSessionNotFound)
+
+	require.NoError(t, svc.RevokeOtherSessions(ctx, user.ID, laptop.SessionID, testClient))
+	sessions, err = svc.ListSessions(ctx, user.ID, laptop.SessionID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, laptop.SessionID, sessions[0].ID)
+}
+
+func TestRefreshTokenKeepsSession(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	_, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	tokens, err := svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	// An access token cannot be used to refresh the session
+	_, err = svc.RefreshToken(ctx, tokens.AccessToken, testClient)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	refreshed, err := svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	require.NoError(t, err)
+	assert.Equal(t, claimsOf(t, svc, tokens.RefreshToken, models.TokenTypeRefresh).SessionID, claimsOf(t, svc, refreshed.RefreshToken, models.TokenTypeRefresh).SessionID)
+
+	// The old refresh token has been rotated out
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestChangePasswordRevokesTokens(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	user, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	tokens, err := svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	accessTokens := NewAccessTokenService(svc.events.store.AccessTokens(), svc.userRepo)
+	created, err := accessTokens.Create(ctx, user.ID, &models.AccessTokenCreation{Name: "deploy script", Scopes: []string{models.ScopeProfileRead}})
+	require.NoError(t, err)
+
+	err = svc.ChangePassword(ctx, user.ID, &models.PasswordChange{CurrentPassword: "Tr0mb-Kettle-Vixen", NewPassword: "Gravel-Otter-Pylon9"}, testClient)
+	require.NoError(t, err)
+
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, _, err = accessTokens.Authenticate(ctx, created.Token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+// claimsOf returns the claims of an access or refresh token issued by the
+// service
+func claimsOf(t *testing.T, svc *AuthService, token, tokenType string) *models.TokenClaims {
+	t.Helper()
+	claims, err := utils.ValidateJWT(token, svc.config.JWT.Secret, tokenType)
+	require.NoError(t, err)
+	return claims
+}
+
+func TestCertificateBoundTokens(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	_, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	mtlsClient := &models.ClientInfo{IPAddress: "10.0.0.2", TokenBinding: models.TokenBinding{CertificateThumbprint: "A9Zt0Ig1wco_EozOrNHzGslBYwlrIPRFroQoW8CDLXI"}}
+	otherClient := &models.ClientInfo{IPAddress: "10.0.0.3", TokenBinding: models.TokenBinding{CertificateThumbprint: "47DEQpj8HBSa-_TImW-5JCeuQeRkm5NMpJWZG3hSuFU"}}
+	tokens, err := svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, mtlsClient)
+	require.NoError(t, err)
+	assert.Equal(t, mtlsClient.CertificateThumbprint, claimsOf(t, svc, tokens.AccessToken, models.TokenTypeAccess).CertificateThumbprint)
+	assert.Equal(t, mtlsClient.CertificateThumbprint, claimsOf(t, svc, tokens.RefreshToken, models.TokenTypeRefresh).CertificateThumbprint)
+
+	// Only the client holding the certificate can refresh or log out
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, otherClient)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.ErrorIs(t, svc.LogoutSession(ctx, tokens.AccessToken, testClient), ErrInvalidToken)
+
+	refreshed, err := svc.RefreshToken(ctx, tokens.RefreshToken, mtlsClient)
+	require.NoError(t, err)
+	assert.Equal(t, mtlsClient.CertificateThumbprint, claimsOf(t, svc, refreshed.AccessToken, models.TokenTypeAccess).CertificateThumbprint)
+
+	// Tokens issued without a certificate stay unbound
+	tokens, err = svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	refreshed, err = svc.RefreshToken(ctx, tokens.RefreshToken, mtlsClient)
+	require.NoError(t, err)
+	assert.Empty(t, claimsOf(t, svc, refreshed.AccessToken, models.TokenTypeAccess).CertificateThumbprint)
+}
+
+func TestSessionLifetime(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, &config.Config{
+		JWT: config.JWTConfig{
+			Secret:             "test-secret-key",
+			AccessTokenTTL:     time.Hour,
+			RefreshTokenTTL:    time.Hour,
+			SessionMaxLifetime: 24 * time.Hour,
+			SessionOverrides: map[string]config.SessionLifetime{
+				"client:mobile": {IdleTimeout: 48 * time.Hour, MaxLifetime: 90 * 24 * time.Hour},
+				"client:kiosk":  {IdleTimeout: 10 * time.Minute, MaxLifetime: 30 * time.Minute},
+				"role:admin":    {IdleTimeout: 15 * time.Minute, MaxLifetime: 8 * time.Hour},
+			},
+		},
+	})
+	user, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	admin := *user
+	admin.Role = models.RoleAdmin
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		clientID string
+		want     config.SessionLifetime
+	}{
+		{"Defaults", user, "", config.SessionLifetime{IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour}},
+		{"Unknown client", user, "web", config.SessionLifetime{IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour}},
+		{"Client override", user, "kiosk", config.SessionLifetime{IdleTimeout: 10 * time.Minute, MaxLifetime: 30 * time.Minute}},
+		{"Client override cannot extend the defaults", user, "mobile", config.SessionLifetime{IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour}},
+		{"Role override", &admin, "", config.SessionLifetime{IdleTimeout: 15 * time.Minute, MaxLifetime: 8 * time.Hour}},
+		{"Client shortens a role override", &admin, "kiosk", config.SessionLifetime{IdleTimeout: 10 * time.Minute, MaxLifetime: 30 * time.Minute}},
+		{"Client cannot extend a role override", &admin, "mobile", config.SessionLifetime{IdleTimeout: 15 * time.Minute, MaxLifetime: 8 * time.Hour}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, svc.sessionLifetime(tt.user, tt.clientID))
+		})
+	}
+
+	t.Run("Refresh is bounded by the absolute lifetime", func(t *testing.T) {
+		client := &models.ClientInfo{ClientID: "kiosk"}
+		tokens, err := svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, client)
+		require.NoError(t, err)
+		session, err := svc.tokenRepo.GetSessionByToken(ctx, tokens.RefreshToken)
+		require.NoError(t, err)
+		assert.WithinDuration(t, session.CreatedAt.Add(10*time.Minute), session.ExpiresAt, time.Second)
+
+		refreshed, err := svc.RefreshToken(ctx, tokens.RefreshToken, client)
+		require.NoError(t, err)
+		after, err := svc.tokenRepo.GetSessionByToken(ctx, refreshed.RefreshToken)
+		require.NoError(t, err)
+		assert.Equal(t, session.CreatedAt, after.CreatedAt)
+		assert.Equal(t, session.AbsoluteExpiresAt, after.AbsoluteExpiresAt)
+		assert.False(t, after.ExpiresAt.After(after.AbsoluteExpiresAt))
+	})
+}
+
+func TestRefreshTokenAfterAbsoluteLifetime(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	_, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	tokens, err := svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	claims := claimsOf(t, svc, tokens.AccessToken, models.TokenTypeAccess)
+	assert.NotEmpty(t, claims.SessionID)
+
+	// Store the session again as if it had reached its absolute lifetime
+	// while its refresh token is still within the idle timeout
+	session, err := svc.tokenRepo.GetSessionByToken(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+	session.AbsoluteExpiresAt = time.Now().Add(-time.Second)
+	require.NoError(t, svc.tokenRepo.DeleteByToken(ctx, tokens.RefreshToken))
+	require.NoError(t, svc.tokenRepo.Store(ctx, tokens.RefreshToken, session))
+
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = svc.tokenRepo.GetSessionByToken(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, repository.ErrTokenNotFound)
+}
+
+func TestDPoPBoundTokens(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	_, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+
+	dpopClient := &models.ClientInfo{IPAddress: "10.0.0.2", TokenBinding: models.TokenBinding{KeyThumbprint: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"}}
+	otherClient := &models.ClientInfo{IPAddress: "10.0.0.3", TokenBinding: models.TokenBinding{KeyThumbprint: "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"}}
+	tokens, err := svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, dpopClient)
+	require.NoError(t, err)
+	assert.Equal(t, "DPoP", tokens.TokenType)
+	assert.Equal(t, dpopClient.KeyThumbprint, claimsOf(t, svc, tokens.AccessToken, models.TokenTypeAccess).KeyThumbprint)
+	assert.Equal(t, dpopClient.KeyThumbprint, claimsOf(t, svc, tokens.RefreshToken, models.TokenTypeRefresh).KeyThumbprint)
+
+	// Only a client proving possession of the key can refresh or log out
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = svc.RefreshToken(ctx, tokens.RefreshToken, otherClient)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.ErrorIs(t, svc.LogoutSession(ctx, tokens.AccessToken, otherClient), ErrInvalidToken)
+
+	refreshed, err := svc.RefreshToken(ctx, tokens.RefreshToken, dpopClient)
+	require.NoError(t, err)
+	assert.Equal(t, "DPoP", refreshed.TokenType)
+	assert.Equal(t, dpopClient.KeyThumbprint, claimsOf(t, svc, refreshed.AccessToken, models.TokenTypeAccess).KeyThumbprint)
+}
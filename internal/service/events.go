@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"learn/internal/events"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/webhook"
+	"log/slog"
+)
+
+// eventPublisher records domain events in the outbox, in the same
+// transaction as the changes they describe, and passes them to synchronous
+// subscribers once the transaction commits
+type eventPublisher struct {
+	store repository.Store
+	bus   *events.Bus
+}
+
+// atomic runs fn in a transaction together with storing the events in the
+// outbox. The events are published only if the transaction commits.
+//
+// fn is given a context that is never cancelled, so once the transaction
+// has started its writes run to completion: the in-memory store cannot roll
+// back, and stopping part way would leave a change half applied. A SQL
+// transaction is still rolled back as a whole if ctx is cancelled before it
+// commits.
+func (p eventPublisher) atomic(ctx context.Context, fn func(ctx context.Context, tx repository.Store) error, published ...events.Event) error {
+	err := p.store.Atomic(ctx, func(tx repository.Store) error {
+		ctx := context.WithoutCancel(ctx)
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+		for _, event := range published {
+			record, err := events.NewOutboxRecord(event)
+			if err != nil {
+				return err
+			}
+			if err := tx.Outbox().Add(ctx, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(published) > 0 {
+		p.bus.Notify()
+	}
+	p.publish(published...)
+	return nil
+}
+
+// publish passes events that do not accompany a change, such as failed
+// logins, to synchronous subscribers. They are not stored in the outbox, so
+// that a flood of failures cannot fill it.
+func (p eventPublisher) publish(published ...events.Event) {
+	for _, event := range published {
+		if err := p.bus.Publish(event); err != nil {
+			slog.Error("Failed to handle event", "event_id", event.EventMetadata().ID, "event_type", event.EventType(), "error", err)
+		}
+	}
+}
+
+// SubscribeWebhooks forwards domain events to webhook subscriptions. It
+// subscribes asynchronously, so a slow or failing webhook store never
+// delays or fails the operation, and the webhook event keeps the ID of the
+// domain event, so receivers can recognise events relayed twice.
+func SubscribeWebhooks(bus *events.Bus, publisher webhook.Publisher) {
+	forward := func(eventType string, metadata events.Metadata, user events.User) error {
+		return publisher.Publish(&webhook.Event{
+			ID:        metadata.ID,
+			Type:      eventType,
+			CreatedAt: metadata.OccurredAt,
+			Data: webhook.UserData{
+				UserID:    user.UserID,
+				Username:  user.Username,
+				Email:     user.Email,
+				IPAddress: metadata.IPAddress,
+				UserAgent: metadata.UserAgent,
+			},
+		})
+	}
+
+	events.SubscribeAsync(bus, "webhooks", func(event events.UserRegistered) error {
+		return forward(webhook.EventUserRegistered, event.Metadata, event.User)
+	})
+	events.SubscribeAsync(bus, "webhooks", func(event events.LoginSucceeded) error {
+		return forward(webhook.EventUserLogin, event.Metadata, event.User)
+	})
+	events.SubscribeAsync(bus, "webhooks", func(event events.PasswordChanged) error {
+		return forward(webhook.EventPasswordChanged, event.Metadata, event.User)
+	})
+	events.SubscribeAsync(bus, "webhooks", func(event events.UserDeleted) error {
+		return forward(webhook.EventUserDeleted, event.Metadata, event.User)
+	})
+}
+
+// loginFailureReason classifies why a login failed. user is the account
+// the identifier names, if any.
+func loginFailureReason(user *models.User, err error) string {
+	switch err.(type) {
+	case *AccountStatusError:
+		return events.LoginFailureAccountInactive
+	}
+	switch {
+	case err == ErrInvalidCredentials && user == nil:
+		return events.LoginFailureUnknownUser
+	case err == ErrInvalidCredentials:
+		return events.LoginFailureWrongPassword
+	case err == ErrPasswordResetRequired:
+		return events.LoginFailurePasswordReset
+	}
+	return events.LoginFailureInternalError
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"learn/internal/events"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/webhook"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthServicePublishesEvents(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+
+	var failures []events.LoginFailed
+	events.Subscribe(svc.events.bus, func(event events.LoginFailed) error {
+		failures = append(failures, event)
+		return nil
+	})
+
+	user, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	_, err = svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "wrong-password"}, testClient)
+	require.Error(t, err)
+	_, err = svc.Login(ctx, &models.UserCredentials{Identifier: "nobody", Password: "wrong-password"}, testClient)
+	require.Error(t, err)
+	tokens, err := svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	tokens, err = svc.RefreshToken(ctx, tokens.RefreshToken, testClient)
+	require.NoError(t, err)
+	require.NoError(t, svc.Logout(ctx, tokens.RefreshToken, testClient))
+	err = svc.ChangePassword(ctx, user.ID, &models.PasswordChange{CurrentPassword: "Tr0mb-Kettle-Vixen", NewPassword: "Gravel-Otter-Pylon9"}, testClient)
+	require.NoError(t, err)
+	// Failed changes publish nothing
+	err = svc.ChangePassword(ctx, user.ID, &models.PasswordChange{CurrentPassword: "Tr0mb-Kettle-Vixen", NewPassword: "Gravel-Otter-Pylon9"}, testClient)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		events.TypeUserRegistered,
+		events.TypeLoginSucceeded,
+		events.TypeTokenRefreshed,
+		events.TypeSessionRevoked,
+		events.TypePasswordChanged,
+	}, outboxTypes(t, svc))
+
+	// Failed logins are not stored, but synchronous subscribers receive them
+	require.Len(t, failures, 2)
+	assert.Equal(t, events.LoginFailureWrongPassword, failures[0].Reason)
+	assert.Equal(t, user.ID, failures[0].UserID)
+	assert.Equal(t, events.LoginFailureUnknownUser, failures[1].Reason)
+	assert.Equal(t, "nobody", failures[1].Identifier)
+	assert.Equal(t, testClient.IPAddress, failures[1].IPAddress)
+
+	// Dispatched events leave the outbox
+	relayEvents(svc)
+	assert.Empty(t, outboxTypes(t, svc))
+}
+
+func TestSubscribeWebhooks(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	publisher := &recordingPublisher{}
+	SubscribeWebhooks(svc.events.bus, publisher)
+
+	user, err := svc.Register(ctx, &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	_, err = svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "wrong-password"}, testClient)
+	require.Error(t, err)
+	_, err = svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	err = svc.ChangePassword(ctx, user.ID, &models.PasswordChange{CurrentPassword: "Tr0mb-Kettle-Vixen", NewPassword: "Gravel-Otter-Pylon9"}, testClient)
+	require.NoError(t, err)
+
+	// Webhooks are published asynchronously, once events are relayed
+	assert.Empty(t, publisher.types())
+	relayEvents(svc)
+
+	assert.Equal(t, []string{
+		webhook.EventUserRegistered,
+		webhook.EventUserLogin,
+		webhook.EventPasswordChanged,
+	}, publisher.types())
+	registered := publisher.events[0]
+	assert.Equal(t, "alice", registered.Data.Username)
+	assert.Equal(t, user.ID, registered.Data.UserID)
+	assert.Equal(t, testClient.IPAddress, registered.Data.IPAddress)
+}
+
+func TestAtomicCompletesWhenCancelled(t *testing.T) {
+	store := repository.NewInMemoryStore()
+	publisher := eventPublisher{store: store, bus: events.NewBus()}
+	user := &models.User{ID: "1", Username: "alice", Email: "alice@example.com"}
+	require.NoError(t, store.Users().Create(t.Context(), user))
+	session := &models.Session{ID: "s1", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, store.Tokens().Store(t.Context(), "refresh", session))
+
+	// The in-memory store cannot roll back, so a request cancelled between
+	// two writes must not leave the first applied without the second
+	ctx, cancel := context.WithCancel(t.Context())
+	err := publisher.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		updated := *user
+		updated.Username = "alicia"
+		if err := tx.Users().Update(ctx, &updated); err != nil {
+			return err
+		}
+		cancel()
+		return tx.Tokens().DeleteAllForUser(ctx, user.ID)
+	})
+	require.NoError(t, err)
+
+	stored, err := store.Users().GetByID(t.Context(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alicia", stored.Username)
+	_, err = store.Tokens().GetSession(t.Context(), session.ID)
+	assert.Equal(t, repository.ErrSessionNotFound, err)
+
+	// A transaction that has not started yet is not run
+	err = publisher.atomic(ctx, func(ctx context.Context, tx repository.Store) error {
+		t.Fatal("fn ran with a cancelled context")
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
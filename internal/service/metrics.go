@@ -0,0 +1,70 @@
+package service
+
+import (
+	"errors"
+	"learn/internal/events"
+	"learn/internal/metrics"
+	"learn/internal/policy"
+	"learn/internal/repository"
+	"learn/internal/utils"
+)
+
+// Authentication operations recorded in metrics
+const (
+	OperationRegister = "register"
+	OperationLogin    = "login"
+	OperationRefresh  = "refresh"
+	OperationLogout   = "logout"
+)
+
+// Reasons an authentication operation failed, in addition to the login
+// failure reasons of the events package. Logins with an unknown user or a
+// wrong password both fail with FailureInvalidCredentials.
+const (
+	FailureInvalidCredentials = "invalid_credentials"
+	FailureUserExists         = "user_exists"
+	FailureInvalidUsername    = "invalid_username"
+	FailureWeakPassword       = "weak_password"
+	FailureInvalidToken       = "invalid_token"
+	FailureSessionNotFound    = "session_not_found"
+)
+
+// observe records the outcome of an authentication operation. An empty
+// reason means the operation succeeded.
+func (s *AuthService) observe(operation, reason string) {
+	if reason == "" {
+		s.metrics.AuthOperation(operation, metrics.OutcomeSuccess, "")
+		return
+	}
+	s.metrics.AuthOperation(operation, metrics.OutcomeFailure, reason)
+}
+
+// failureReason classifies the error an operation failed with, returning
+// an empty reason for success. Unexpected errors are internal errors, so
+// the number of reasons stays bounded.
+func failureReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	var statusErr *AccountStatusError
+	var policyErr *policy.ValidationError
+	switch {
+	case errors.As(err, &statusErr):
+		return events.LoginFailureAccountInactive
+	case errors.As(err, &policyErr):
+		return FailureWeakPassword
+	case err == ErrInvalidCredentials:
+		return FailureInvalidCredentials
+	case err == ErrUserExists:
+		return FailureUserExists
+	case err == utils.ErrInvalidUsername, err == utils.ErrMixedScriptUsername:
+		return FailureInvalidUsername
+	case err == ErrInvalidToken, err == repository.ErrTokenNotFound:
+		return FailureInvalidToken
+	case err == ErrSessionNotFound:
+		return FailureSessionNotFound
+	case err == ErrPasswordResetRequired:
+		return events.LoginFailurePasswordReset
+	}
+	return events.LoginFailureInternalError
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"learn/internal/metrics"
+	"learn/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMetrics(t *testing.T) {
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	svc.metrics = metrics.New(svc.events.store)
+
+	reg := &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}
+	_, err := svc.Register(ctx, reg, testClient)
+	require.NoError(t, err)
+	_, err = svc.Register(ctx, reg, testClient)
+	require.ErrorIs(t, err, ErrUserExists)
+
+	tokens, err := svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "Tr0mb-Kettle-Vixen"}, testClient)
+	require.NoError(t, err)
+	_, _ = svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "wrong-password"}, testClient)
+	_, _ = svc.Login(ctx, &models.UserCredentials{Identifier: "nobody", Password: "wrong-password"}, testClient)
+	_, _ = svc.RefreshToken(ctx, "not-a-token", testClient)
+	require.NoError(t, svc.Logout(ctx, tokens.RefreshToken, testClient))
+
+	w := httptest.NewRecorder()
+	svc.metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, line := range []string{
+		`auth_operations_total{operation="register",outcome="success",reason=""} 1`,
+		`auth_operations_total{operation="register",outcome="failure",reason="user_exists"} 1`,
+		`auth_operations_total{operation="login",outcome="success",reason=""} 1`,
+		`auth_operations_total{operation="login",outcome="failure",reason="invalid_credentials"} 2`,
+		`auth_operations_total{operation="refresh",outcome="failure",reason="invalid_token"} 1`,
+		`auth_operations_total{operation="logout",outcome="success",reason=""} 1`,
+		`auth_users 1`,
+		`auth_active_refresh_tokens 0`,
+	} {
+		assert.Contains(t, body, line)
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"learn/internal/repository"
+	"sync"
+	"time"
+)
+
+// maxCachedSessions bounds the number of entries a SessionCache holds
+const maxCachedSessions = 100000
+
+// SessionCache looks up whether sessions are still active, caching each
+// answer for a short time so that checking the session of every request
+// stays cheap while logouts and revocations still take effect within the
+// cache TTL
+type SessionCache struct {
+	tokenRepo repository.TokenRepository
+	ttl       time.Duration
+	entries   map[string]cachedSession
+	mutex     sync.Mutex
+}
+
+type cachedSession struct {
+	active    bool
+	expiresAt time.Time
+}
+
+// NewSessionCache creates a new session cache
+func NewSessionCache(tokenRepo repository.TokenRepository, ttl time.Duration) *SessionCache {
+	return &SessionCache{
+		tokenRepo: tokenRepo,
+		ttl:       ttl,
+		entries:   make(map[string]cachedSession),
+	}
+}
+
+// SessionActive reports whether a session exists and has not expired
+func (c *SessionCache) SessionActive(ctx context.Context, sessionID string) (bool, error) {
+	now := time.Now()
+	c.mutex.Lock()
+	entry, exists := c.entries[sessionID]
+	c.mutex.Unlock()
+	if exists && now.Before(entry.expiresAt) {
+		return entry.active, nil
+	}
+
+	_, err := c.tokenRepo.GetSession(ctx, sessionID)
+	if err != nil && err != repository.ErrSessionNotFound && err != repository.ErrTokenExpired {
+		return false, err
+	}
+	entry = cachedSession{active: err == nil, expiresAt: now.Add(c.ttl)}
+
+	c.mutex.Lock()
+	if len(c.entries) >= maxCachedSessions {
+		c.evictExpired(now)
+	}
+	c.entries[sessionID] = entry
+	c.mutex.Unlock()
+
+	return entry.active, nil
+}
+
+// evictExpired removes expired entries, or every entry if none have
+// expired; the caller must hold the lock
+func (c *SessionCache) evictExpired(now time.Time) {
+	for sessionID, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, sessionID)
+		}
+	}
+	if len(c.entries) >= maxCachedSessions {
+		c.entries = make(map[string]cachedSession)
+	}
+}
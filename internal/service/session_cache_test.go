@@ -0,0 +1,38 @@
+package service
+
+import (
+	"learn/internal/models"
+	"learn/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCache(t *testing.T) {
+	ctx := t.Context()
+	tokenRepo := repository.NewInMemoryTokenRepository()
+	now := time.Now()
+	require.NoError(t, tokenRepo.Store(ctx, "token", &models.Session{ID: "s1", UserID: "1", CreatedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)}))
+
+	cache := NewSessionCache(tokenRepo, 50*time.Millisecond)
+	active, err := cache.SessionActive(ctx, "s1")
+	require.NoError(t, err)
+	assert.True(t, active)
+
+	// A logout is only seen once the cached answer expires
+	require.NoError(t, tokenRepo.DeleteByToken(ctx, "token"))
+	active, err = cache.SessionActive(ctx, "s1")
+	require.NoError(t, err)
+	assert.True(t, active)
+
+	assert.Eventually(t, func() bool {
+		active, err := cache.SessionActive(ctx, "s1")
+		return err == nil && !active
+	}, time.Second, 10*time.Millisecond)
+
+	active, err = cache.SessionActive(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, active)
+}
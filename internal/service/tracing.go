@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"learn/internal/events"
+	"learn/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of service operations. It uses the global
+// tracer provider, which records nothing unless tracing is configured.
+var tracer = otel.Tracer("learn/internal/service")
+
+// endSpan ends the span of an operation. Expected failures, such as a wrong
+// password, are recorded as the failure reason; only unexpected errors mark
+// the span as failed.
+func endSpan(span trace.Span, err error) {
+	if reason := failureReason(err); reason != "" && reason != events.LoginFailureInternalError {
+		span.SetAttributes(attribute.String("auth.failure_reason", reason))
+		err = nil
+	}
+	tracing.End(span, err)
+}
+
+// hashPassword hashes a password in a span of its own, as hashing is
+// deliberately slow and often dominates the latency of a request
+func (s *AuthService) hashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracer.Start(ctx, "PasswordHasher.Hash", trace.WithAttributes(
+		attribute.String("password.algorithm", s.hasher.Algorithm()),
+	))
+	defer span.End()
+	return s.hasher.Hash(password)
+}
+
+// verifyPassword verifies a password against an encoded hash in a span of
+// its own
+func (s *AuthService) verifyPassword(ctx context.Context, password, encodedHash string) (bool, error) {
+	_, span := tracer.Start(ctx, "PasswordHasher.Verify")
+	defer span.End()
+	return s.hasher.Verify(password, encodedHash)
+}
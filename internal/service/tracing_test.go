@@ -0,0 +1,40 @@
+package service
+
+import (
+	"learn/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAuthTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	ctx := t.Context()
+	svc, _ := newTestAuthService(t, nil)
+	reg := &models.UserRegistration{Username: "alice", Email: "alice@example.com", Password: "Tr0mb-Kettle-Vixen"}
+	_, err := svc.Register(ctx, reg, testClient)
+	require.NoError(t, err)
+
+	exporter.Reset()
+	_, err = svc.Login(ctx, &models.UserCredentials{Identifier: "alice", Password: "wrong-password"}, testClient)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	verify, login := spans[0], spans[1]
+	assert.Equal(t, "PasswordHasher.Verify", verify.Name)
+	assert.Equal(t, login.SpanContext.SpanID(), verify.Parent.SpanID())
+
+	// A wrong password is an expected failure, not an error of the service
+	assert.Equal(t, "AuthService.Login", login.Name)
+	assert.Equal(t, codes.Unset, login.Status.Code)
+	assert.Contains(t, login.Attributes, attribute.String("auth.failure_reason", FailureInvalidCredentials))
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"learn/internal/audit"
+	"learn/internal/config"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/utils"
+	"learn/internal/webhook"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidEventType        = errors.New("invalid webhook event type")
+)
+
+const (
+	// DeliveryBatchSize is the most deliveries DeliverDue attempts at once
+	DeliveryBatchSize = 100
+	// deliveryConcurrency bounds how many deliveries are sent in parallel,
+	// so that one slow receiver does not hold up the others
+	deliveryConcurrency = 8
+	// maxDeliveriesListed caps the number of deliveries returned by a listing
+	maxDeliveriesListed = 100
+)
+
+// WebhookService manages webhook subscriptions and delivers events to them.
+// Publishing an event only stores a delivery per subscriber in the outbox;
+// DeliverDue sends them, retrying failures with exponential backoff until
+// they succeed or run out of attempts and are dead-lettered.
+type WebhookService struct {
+	repo     repository.WebhookRepository
+	client   *http.Client
+	auditLog audit.Logger
+	config   config.WebhookConfig
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(repo repository.WebhookRepository, auditLog audit.Logger, config config.WebhookConfig) *WebhookService {
+	return &WebhookService{
+		repo: repo,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// A redirect is treated as a failed delivery rather than followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		auditLog: auditLog,
+		config:   config,
+	}
+}
+
+// Publish queues an event for every subscription that receives its type
+func (s *WebhookService) Publish(event *webhook.Event) error {
+	subscriptions, err := s.repo.ListSubscriptions()
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var deliveries []*models.WebhookDelivery
+	for _, subscription := range subscriptions {
+		if !subscription.Subscribes(event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, &models.WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.repo.CreateDeliveries(deliveries)
+}
+
+// CreateSubscription subscribes a URL to events. The returned secret signs
+// every payload sent to the URL and cannot be retrieved again.
+func (s *WebhookService) CreateSubscription(actor audit.Actor, creation *models.WebhookSubscriptionCreation) (*models.CreatedWebhookSubscription, error) {
+	created, err := s.createSubscription(creation)
+	targetID := ""
+	if created != nil {
+		targetID = created.ID
+	}
+	s.record(actor, audit.ActionAdminCreateWebhook, targetID, err)
+	return created, err
+}
+
+func (s *WebhookService) createSubscription(creation *models.WebhookSubscriptionCreation) (*models.CreatedWebhookSubscription, error) {
+	for _, eventType := range creation.Events {
+		if !webhook.ValidEventType(eventType) {
+			return nil, ErrInvalidEventType
+		}
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	subscription := &models.WebhookSubscription{
+		ID:          uuid.New().String(),
+		URL:         creation.URL,
+		Events:      creation.Events,
+		Description: creation.Description,
+		Secret:      "whsec_" + secret,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.CreateSubscription(subscription); err != nil {
+		return nil, err
+	}
+
+	return &models.CreatedWebhookSubscription{
+		WebhookSubscription: *subscription,
+		Secret:              subscription.Secret,
+	}, nil
+}
+
+// ListSubscriptions returns every subscription, oldest first
+func (s *WebhookService) ListSubscriptions(actor audit.Actor) ([]*models.WebhookSubscription, error) {
+	subscriptions, err := s.repo.ListSubscriptions()
+	s.record(actor, audit.ActionAdminListWebhooks, "", err)
+	return subscriptions, err
+}
+
+// DeleteSubscription removes a subscription. Deliveries still queued for
+// it are dead-lettered when they come due.
+func (s *WebhookService) DeleteSubscription(actor audit.Actor, id string) error {
+	err := s.repo.DeleteSubscription(id)
+	if err == repository.ErrWebhookNotFound {
+		err = ErrWebhookNotFound
+	}
+	s.record(actor, audit.ActionAdminDeleteWebhook, id, err)
+	return err
+}
+
+// ListDeliveries returns the most recent deliveries matching a filter,
+// newest first
+func (s *WebhookService) ListDeliveries(actor audit.Actor, filter repository.DeliveryFilter) ([]*models.WebhookDelivery, error) {
+	if filter.Limit < 1 || filter.Limit > maxDeliveriesListed {
+		filter.Limit = maxDeliveriesListed
+	}
+	deliveries, err := s.repo.ListDeliveries(filter)
+	s.record(actor, audit.ActionAdminListDeliveries, filter.SubscriptionID, err)
+	return deliveries, err
+}
+
+// ReplayDelivery queues a delivery to be sent again as soon as possible,
+// with a fresh set of attempts, whatever its status
+func (s *WebhookService) ReplayDelivery(actor audit.Actor, id string) (*models.WebhookDelivery, error) {
+	delivery, err := s.replayDelivery(id)
+	s.record(actor, audit.ActionAdminReplayDelivery, id, err)
+	return delivery, err
+}
+
+func (s *WebhookService) replayDelivery(id string) (*models.WebhookDelivery, error) {
+	delivery, err := s.repo.GetDelivery(id)
+	if err != nil {
+		if err == repository.ErrWebhookDeliveryNotFound {
+			return nil, ErrWebhookDeliveryNotFound
+		}
+		return nil, err
+	}
+	if err := s.replay(delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// ReplayDeadDeliveries queues every dead-lettered delivery of a
+// subscription to be sent again, returning how many were queued
+func (s *WebhookService) ReplayDeadDeliveries(actor audit.Actor, subscriptionID string) (int, error) {
+	replayed, err := s.replayDeadDeliveries(subscriptionID)
+	event := audit.NewEvent(actor, audit.ActionAdminReplayDeadDeliveries, subscriptionID, err)
+	if err == nil {
+		event.Reason = fmt.Sprintf("%d deliveries", replayed)
+	}
+	audit.Write(s.auditLog, event)
+	return replayed, err
+}
+
+func (s *WebhookService) replayDeadDeliveries(subscriptionID string) (int, error) {
+	if _, err := s.repo.GetSubscription(subscriptionID); err != nil {
+		if err == repository.ErrWebhookNotFound {
+			return 0, ErrWebhookNotFound
+		}
+		return 0, err
+	}
+	deliveries, err := s.repo.ListDeliveries(repository.DeliveryFilter{
+		SubscriptionID: subscriptionID,
+		Status:         models.DeliveryDead,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, delivery := range deliveries {
+		if err := s.replay(delivery); err != nil {
+			return i, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// replay resets a delivery so that it is due immediately
+func (s *WebhookService) replay(delivery *models.WebhookDelivery) error {
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	delivery.LastError = ""
+	delivery.DeliveredAt = nil
+	return s.repo.UpdateDelivery(delivery)
+}
+
+// DeliverDue attempts up to DeliveryBatchSize deliveries that are due and
+// returns how many were attempted
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := s.repo.DueDeliveries(time.Now(), DeliveryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs []error
+	slots := make(chan struct{}, deliveryConcurrency)
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := s.deliver(ctx, delivery); err != nil {
+				mutex.Lock()
+				errs = append(errs, err)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return len(deliveries), errors.Join(errs...)
+}
+
+// deliver makes one attempt at a delivery and stores the outcome. The
+// returned error is only for failing to store it; a failed attempt is
+// recorded on the delivery itself.
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) error {
+	subscription, err := s.repo.GetSubscription(delivery.SubscriptionID)
+	if err != nil && err != repository.ErrWebhookNotFound {
+		return err
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	if subscription == nil {
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = "subscription deleted"
+		return s.repo.UpdateDelivery(delivery)
+	}
+
+	status, err := s.send(ctx, subscription, delivery)
+	delivery.ResponseStatus = status
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case ctx.Err() != nil:
+		// Shutting down; the attempt does not count against the receiver
+		delivery.Attempts--
+		delivery.LastError = err.Error()
+	case delivery.Attempts >= s.config.MaxAttempts:
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(utils.Backoff(s.config.RetryBaseDelay, s.config.RetryMaxDelay, delivery.Attempts))
+	}
+	return s.repo.UpdateDelivery(delivery)
+}
+
+// send posts a delivery's signed payload to the subscription URL and
+// returns the response status. Any status other than 2xx is an error.
+func (s *WebhookService) send(ctx context.Context, subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.EventIDHeader, delivery.EventID)
+	req.Header.Set(webhook.EventTypeHeader, delivery.EventType)
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(subscription.Secret, time.Now(), delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// record writes an audit event for an action and its outcome
+func (s *WebhookService) record(actor audit.Actor, action, targetID string, err error) {
+	audit.Write(s.auditLog, audit.NewEvent(actor, action, targetID, err))
+}
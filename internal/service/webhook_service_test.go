@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"learn/internal/audit"
+	"learn/internal/config"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/webhook"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAdmin = audit.Actor{ID: "admin"}
+
+// newTestWebhookService creates a WebhookService that retries failed
+// deliveries immediately
+func newTestWebhookService(maxAttempts int) (*WebhookService, *repository.InMemoryWebhookRepository) {
+	repo := repository.NewInMemoryWebhookRepository()
+	svc := NewWebhookService(repo, &recordingAuditLogger{}, config.WebhookConfig{
+		MaxAttempts: maxAttempts,
+		Timeout:     time.Second,
+	})
+	return svc, repo
+}
+
+// newTestReceiver starts a server that verifies signatures with the secret
+// set in it and answers with the status returned by respond
+func newTestReceiver(t *testing.T, respond func() int) (*httptest.Server, *string, chan *webhook.Event) {
+	t.Helper()
+	secret := new(string)
+	received := make(chan *webhook.Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify(*secret, r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		status := respond()
+		if status == http.StatusOK {
+			var event webhook.Event
+			_ = json.Unmarshal(body, &event)
+			received <- &event
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, secret, received
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	svc, repo := newTestWebhookService(3)
+	server, secret, received := newTestReceiver(t, func() int { return http.StatusOK })
+
+	subscription, err := svc.CreateSubscription(testAdmin, &models.WebhookSubscriptionCreation{
+		URL:    server.URL,
+		Events: []string{webhook.EventUserRegistered},
+	})
+	require.NoError(t, err)
+	*secret = subscription.Secret
+
+	user := &models.User{ID: "user1", Username: "alice", Email: "alice@example.com"}
+	require.NoError(t, svc.Publish(webhook.NewUserEvent(webhook.EventUserRegistered, user, testClient)))
+	// Not subscribed, so not queued
+	require.NoError(t, svc.Publish(webhook.NewUserEvent(webhook.EventUserLogin, user, testClient)))
+
+	attempted, err := svc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	event := <-received
+	assert.Equal(t, webhook.EventUserRegistered, event.Type)
+	assert.Equal(t, "alice", event.Data.Username)
+	assert.Equal(t, testClient.IPAddress, event.Data.IPAddress)
+
+	deliveries, err := repo.ListDeliveries(repository.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, http.StatusOK, deliveries[0].ResponseStatus)
+	assert.Equal(t, event.ID, deliveries[0].EventID)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+}
+
+func TestWebhookRetryAndReplay(t *testing.T) {
+	svc, repo := newTestWebhookService(3)
+	var down atomic.Bool
+	down.Store(true)
+	server, secret, received := newTestReceiver(t, func() int {
+		if down.Load() {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+
+	subscription, err := svc.CreateSubscription(testAdmin, &models.WebhookSubscriptionCreation{
+		URL:    server.URL,
+		Events: webhook.EventTypes,
+	})
+	require.NoError(t, err)
+	*secret = subscription.Secret
+
+	user := &models.User{ID: "user1", Username: "alice", Email: "alice@example.com"}
+	require.NoError(t, svc.Publish(webhook.NewUserEvent(webhook.EventUserLogin, user, nil)))
+
+	// Each attempt fails until the delivery runs out of attempts
+	for attempt := 1; attempt <= 3; attempt++ {
+		attempted, err := svc.DeliverDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, attempted)
+	}
+	attempted, err := svc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempted, "dead-lettered delivery was retried")
+
+	dead, err := repo.ListDeliveries(repository.DeliveryFilter{Status: models.DeliveryDead})
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, dead[0].ResponseStatus)
+	assert.Contains(t, dead[0].LastError, "503")
+
+	// Once the receiver is back, replaying sends the same event again
+	down.Store(false)
+	replayed, err := svc.ReplayDeadDeliveries(testAdmin, subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	_, err = svc.DeliverDue(context.Background())
+	require.NoError(t, err)
+
+	event := <-received
+	assert.Equal(t, dead[0].EventID, event.ID)
+	delivery, err := repo.GetDelivery(dead[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+}
+
+func TestWebhookDeliveryToDeletedSubscription(t *testing.T) {
+	svc, repo := newTestWebhookService(3)
+	subscription, err := svc.CreateSubscription(testAdmin, &models.WebhookSubscriptionCreation{
+		URL:    "http://127.0.0.1:1",
+		Events: []string{webhook.EventUserDeleted},
+	})
+	require.NoError(t, err)
+
+	user := &models.User{ID: "user1"}
+	require.NoError(t, svc.Publish(webhook.NewUserEvent(webhook.EventUserDeleted, user, nil)))
+	require.NoError(t, svc.DeleteSubscription(testAdmin, subscription.ID))
+	assert.ErrorIs(t, svc.DeleteSubscription(testAdmin, subscription.ID), ErrWebhookNotFound)
+
+	_, err = svc.DeliverDue(context.Background())
+	require.NoError(t, err)
+	deliveries, err := repo.ListDeliveries(repository.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.DeliveryDead, deliveries[0].Status)
+}
+
+func TestCreateSubscriptionRejectsUnknownEvent(t *testing.T) {
+	svc, _ := newTestWebhookService(3)
+	_, err := svc.CreateSubscription(testAdmin, &models.WebhookSubscriptionCreation{
+		URL:    "https://example.com/hook",
+		Events: []string{webhook.EventUserLogin, "user.exploded"},
+	})
+	assert.ErrorIs(t, err, ErrInvalidEventType)
+}
@@ -0,0 +1,240 @@
+// Package tlsconfig builds the server's TLS configuration. The certificate,
+// key and client CA bundle are read again whenever their files change, so
+// certificates can be rotated without restarting the server.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"learn/internal/config"
+	"learn/internal/models"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reloader serves the current certificate and client CAs to TLS handshakes,
+// reloading them in the background when their files change
+type Reloader struct {
+	cfg     config.TLSConfig
+	base    *tls.Config
+	current atomic.Pointer[loaded]
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// loaded holds the configuration built from one version of the files
+type loaded struct {
+	config *tls.Config
+	stamps []fileStamp
+}
+
+// fileStamp identifies a version of a file by its size and modification time
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewReloader validates the TLS settings and loads the certificate, key and
+// client CA bundle
+func NewReloader(cfg config.TLSConfig) (*Reloader, error) {
+	base := &tls.Config{
+		// Offered explicitly, as the configuration returned for each
+		// handshake replaces the one net/http sets up for HTTP/2
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	switch cfg.MinVersion {
+	case "1.2":
+		base.MinVersion = tls.VersionTLS12
+	case "1.3":
+		base.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS version %q", cfg.MinVersion)
+	}
+
+	for _, name := range cfg.CipherSuites {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS cipher suite %q", name)
+		}
+		base.CipherSuites = append(base.CipherSuites, id)
+	}
+
+	switch cfg.ClientAuth {
+	case "none":
+		base.ClientAuth = tls.NoClientCert
+	case "optional":
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unsupported TLS client auth %q", cfg.ClientAuth)
+	}
+	if base.ClientAuth != tls.NoClientCert && cfg.ClientCAFile == "" {
+		return nil, errors.New("client certificates cannot be verified without a CA bundle")
+	}
+
+	r := &Reloader{cfg: cfg, base: base}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Config returns the configuration for the server. Each handshake uses the
+// most recently loaded certificate and client CAs.
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: r.base.MinVersion,
+		NextProtos: r.base.NextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load().config, nil
+		},
+	}
+}
+
+// Start checks the files for changes at the configured interval until Stop
+// is called or the context is cancelled
+func (r *Reloader) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.cfg.ReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// The files are tried again on the next tick, in case they
+				// were caught halfway through being replaced
+				if err := r.Reload(); err != nil {
+					slog.Warn("Failed to reload TLS certificate", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops checking the files for changes
+func (r *Reloader) Stop() {
+	r.once.Do(func() {
+		if r.cancel == nil {
+			return
+		}
+		r.cancel()
+		<-r.done
+	})
+}
+
+// Reload loads the files again if any has changed since they were last
+// loaded. The previous certificate stays in use if loading fails.
+func (r *Reloader) Reload() error {
+	stamps, err := r.stamps()
+	if err != nil {
+		return err
+	}
+	current := r.current.Load()
+	if current != nil && slices.EqualFunc(current.stamps, stamps, fileStamp.equal) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	config := r.base.Clone()
+	config.Certificates = []tls.Certificate{cert}
+	if r.cfg.ClientCAFile != "" {
+		bundle, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(bundle) {
+			return fmt.Errorf("no certificates found in %s", r.cfg.ClientCAFile)
+		}
+	}
+
+	r.current.Store(&loaded{config: config, stamps: stamps})
+	if current != nil {
+		slog.Info("Reloaded TLS certificate", "subject", cert.Leaf.Subject.String(), "not_after", cert.Leaf.NotAfter)
+	}
+	return nil
+}
+
+// Certificate returns the certificate currently served
+func (r *Reloader) Certificate() *x509.Certificate {
+	return r.current.Load().config.Certificates[0].Leaf
+}
+
+// stamps returns the current versions of the files
+func (r *Reloader) stamps() ([]fileStamp, error) {
+	var stamps []fileStamp
+	for _, path := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		stamps = append(stamps, fileStamp{size: info.Size(), modTime: info.ModTime()})
+	}
+	return stamps, nil
+}
+
+func (s fileStamp) equal(other fileStamp) bool {
+	return s.size == other.size && s.modTime.Equal(other.modTime)
+}
+
+// cipherSuite looks up a cipher suite by name. Suites with known weaknesses
+// are not accepted.
+func cipherSuite(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// Identity describes a verified client certificate
+func Identity(cert *x509.Certificate) *models.ClientIdentity {
+	identity := &models.ClientIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		Issuer:         cert.Issuer.String(),
+		SerialNumber:   cert.SerialNumber.Text(16),
+		NotAfter:       cert.NotAfter,
+		Thumbprint:     Thumbprint(cert),
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	return identity
+}
+
+// Thumbprint returns the base64url-encoded SHA-256 hash of a certificate's
+// DER encoding, as in the x5t#S256 JWT header and confirmation claim
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
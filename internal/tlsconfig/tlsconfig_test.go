@@ -0,0 +1,184 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"learn/internal/config"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for a server or client
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes a file and moves its modification time forward, so a
+// rewrite within the file system's timestamp resolution is still noticed
+func writeFile(t *testing.T, path string, data []byte, age time.Duration) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	modTime := time.Now().Add(age)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	cfg := config.TLSConfig{
+		CertFile:       filepath.Join(dir, "server.crt"),
+		KeyFile:        filepath.Join(dir, "server.key"),
+		MinVersion:     "1.2",
+		ClientAuth:     "require",
+		ClientCAFile:   filepath.Join(dir, "ca.crt"),
+		ReloadInterval: time.Hour,
+	}
+	certPEM, keyPEM := ca.issue(t, "localhost", 10, x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM, -time.Minute)
+	writeFile(t, cfg.KeyFile, keyPEM, -time.Minute)
+	writeFile(t, cfg.ClientCAFile, ca.pem, -time.Minute)
+
+	reloader, err := NewReloader(cfg)
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, Identity(r.TLS.VerifiedChains[0][0]).CommonName)
+	}))
+	server.TLS = reloader.Config()
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCertPEM, clientKeyPEM := ca.issue(t, "billing", 20, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	require.NoError(t, err)
+	// connect makes a request on a new connection, returning the serial
+	// number of the server certificate and the response body
+	connect := func(certificates ...tls.Certificate) (int64, string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "localhost",
+			Certificates: certificates,
+		}}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), string(body), err
+	}
+
+	t.Run("Requires a client certificate", func(t *testing.T) {
+		_, _, err := connect()
+		assert.Error(t, err)
+
+		serial, body, err := connect(clientCert)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), serial)
+		assert.Equal(t, "billing", body)
+	})
+
+	t.Run("Serves a replaced certificate", func(t *testing.T) {
+		certPEM, keyPEM := ca.issue(t, "localhost", 11, x509.ExtKeyUsageServerAuth)
+		writeFile(t, cfg.CertFile, certPEM, 0)
+		writeFile(t, cfg.KeyFile, keyPEM, 0)
+		require.NoError(t, reloader.Reload())
+
+		serial, _, err := connect(clientCert)
+		require.NoError(t, err)
+		assert.Equal(t, int64(11), serial)
+		assert.Equal(t, int64(11), reloader.Certificate().SerialNumber.Int64())
+	})
+
+	t.Run("Keeps the certificate if the new one is invalid", func(t *testing.T) {
+		writeFile(t, cfg.CertFile, []byte("not a certificate"), time.Minute)
+		assert.Error(t, reloader.Reload())
+
+		serial, _, err := connect(clientCert)
+		require.NoError(t, err)
+		assert.Equal(t, int64(11), serial)
+	})
+}
+
+func TestNewReloaderRejectsInvalidSettings(t *testing.T) {
+	valid := config.TLSConfig{MinVersion: "1.2", ClientAuth: "none"}
+	tests := []struct {
+		name   string
+		modify func(cfg *config.TLSConfig)
+		err    string
+	}{
+		{"Unknown version", func(cfg *config.TLSConfig) { cfg.MinVersion = "1.1" }, `unsupported TLS version "1.1"`},
+		{"Unknown cipher suite", func(cfg *config.TLSConfig) { cfg.CipherSuites = []string{"TLS_NULL"} }, `unsupported TLS cipher suite "TLS_NULL"`},
+		{"Insecure cipher suite", func(cfg *config.TLSConfig) { cfg.CipherSuites = []string{"TLS_RSA_WITH_RC4_128_SHA"} }, `unsupported TLS cipher suite "TLS_RSA_WITH_RC4_128_SHA"`},
+		{"Client auth without CAs", func(cfg *config.TLSConfig) { cfg.ClientAuth = "require" }, "client certificates cannot be verified without a CA bundle"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			_, err := NewReloader(cfg)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
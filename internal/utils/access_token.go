@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// AccessTokenPrefix marks personal access tokens so they can be told apart
+// from JWTs and recognised by secret scanners
+const AccessTokenPrefix = "pat_"
+
+// accessTokenDisplayLength is how many leading characters of a token are
+// kept to identify it in listings
+const accessTokenDisplayLength = len(AccessTokenPrefix) + 6
+
+// GenerateAccessToken creates a random personal access token
+func GenerateAccessToken() (string, error) {
+	token, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + token, nil
+}
+
+// IsAccessToken reports whether a bearer token is a personal access token
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
+
+// HashAccessToken returns the hash a personal access token, or another
+// random secret token, is stored and looked up by. The token has enough
+// entropy that an unsalted fast hash is sufficient.
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AccessTokenDisplayPrefix returns the leading characters of a token shown
+// when listing tokens
+func AccessTokenDisplayPrefix(token string) string {
+	if len(token) < accessTokenDisplayLength {
+		return token
+	}
+	return token[:accessTokenDisplayLength]
+}
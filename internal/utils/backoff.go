@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"time"
+)
+
+// Backoff returns the delay after the nth failed attempt of a retried
+// operation: the base delay doubled for each attempt after the first,
+// capped at the maximum delay
+func Backoff(base, max time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	return min(delay, max)
+}
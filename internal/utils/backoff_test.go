@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Backoff(30*time.Second, 5*time.Minute, tt.attempts), "attempts = %d", tt.attempts)
+	}
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"strings"
+)
+
+// userAgentBrowsers maps user agent tokens to browser names. Order matters:
+// several browsers include the tokens of the browsers they derive from.
+var userAgentBrowsers = []struct {
+	token string
+	name  string
+}{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+	{"okhttp/", "OkHttp"},
+	{"Go-http-client/", "Go HTTP client"},
+}
+
+// userAgentPlatforms maps user agent tokens to operating system names
+var userAgentPlatforms = []struct {
+	token string
+	name  string
+}{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// DeviceName derives a friendly device name such as "Firefox on Windows"
+// from a user agent string
+func DeviceName(userAgent string) string {
+	var browser, platform string
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range userAgentPlatforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrMixedScriptUsername = errors.New("username mixes characters from different scripts")
+	ErrInvalidUsername     = errors.New("username contains invalid characters")
+)
+
+// CanonicalizeUsername returns the form of a username that is stored: NFKC
+// normalized with surrounding whitespace removed, preserving case for display
+func CanonicalizeUsername(username string) string {
+	return norm.NFKC.String(strings.TrimSpace(username))
+}
+
+// CanonicalizeEmail returns the form of an email address that is stored:
+// NFKC normalized and case folded
+func CanonicalizeEmail(email string) string {
+	return NormalizeIdentifier(email)
+}
+
+// NormalizeIdentifier returns the key used to compare usernames and emails:
+// NFKC normalized and case folded, so "Alice", "ALICE" and the fullwidth
+// "Ａｌｉｃｅ" are the same identifier
+func NormalizeIdentifier(identifier string) string {
+	// A cases.Caser is not safe for concurrent use, so create one per call.
+	// Folding can produce characters that are not NFKC normalized, so
+	// normalize again afterwards, as NFKC_Casefold does.
+	caser := cases.Fold()
+	return norm.NFKC.String(caser.String(norm.NFKC.String(strings.TrimSpace(identifier))))
+}
+
+// IsEmailIdentifier reports whether a login identifier is an email address
+// rather than a username
+func IsEmailIdentifier(identifier string) bool {
+	return strings.Contains(identifier, "@")
+}
+
+// ValidateUsername checks that a username only contains letters, digits,
+// underscores, hyphens and dots, and does not mix letters from scripts whose
+// characters are easily confused with one another
+func ValidateUsername(username string) error {
+	scripts := make(map[string]bool)
+	for _, r := range username {
+		switch {
+		case unicode.IsLetter(r):
+			for name, table := range confusableScripts {
+				if unicode.Is(table, r) {
+					scripts[name] = true
+				}
+			}
+		case unicode.IsDigit(r), r == '_', r == '-', r == '.':
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks belong to the preceding letter
+		default:
+			return ErrInvalidUsername
+		}
+	}
+	if len(scripts) > 1 {
+		return ErrMixedScriptUsername
+	}
+	return nil
+}
+
+// confusableScripts are scripts with many letters that look like letters of
+// another script in this set
+var confusableScripts = map[string]*unicode.RangeTable{
+	"Latin":    unicode.Latin,
+	"Cyrillic": unicode.Cyrillic,
+	"Greek":    unicode.Greek,
+	"Armenian": unicode.Armenian,
+	"Cherokee": unicode.Cherokee,
+}
+
+// UsernameSkeleton returns the skeleton of a username in the sense of
+// Unicode Technical Standard #39: look-alike characters are mapped to a
+// common prototype, so two usernames with the same skeleton are visually
+// confusable, e.g. "paypal" and "pаypаl" with Cyrillic "а", or "rn" and "m".
+func UsernameSkeleton(username string) string {
+	folded := NormalizeIdentifier(username)
+
+	var b strings.Builder
+	for _, r := range norm.NFD.String(folded) {
+		if unicode.Is(unicode.Mn, r) {
+			// Drop accents so "é" and "e" share a skeleton
+			continue
+		}
+		if proto, ok := confusables[r]; ok {
+			b.WriteRune(proto)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return multiCharConfusables.Replace(b.String())
+}
+
+// confusables maps characters to the Latin prototype they are commonly
+// mistaken for. Input has already been case folded.
+var confusables = map[rune]rune{
+	// Digits and Latin look-alikes
+	'0': 'o', '1': 'l', 'i': 'l', '|': 'l', '5': 's', 'ı': 'l', 'ɩ': 'l', 'ɡ': 'g', 'ƅ': 'b',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'l', 'ї': 'l',
+	'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's',
+	'т': 't', 'ц': 'u', 'ս': 'u', 'ѵ': 'v', 'ԝ': 'w', 'х': 'x', 'у': 'y', 'ү': 'y', 'ʐ': 'z',
+	// Greek
+	'α': 'a', 'β': 'b', 'ϲ': 'c', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y', 'ζ': 'z',
+	// Armenian
+	'օ': 'o', 'ց': 'g', 'հ': 'h', 'ո': 'n', 'ք': 'p',
+}
+
+// multiCharConfusables maps character sequences that look like a single
+// character, applied after single-character mapping
+var multiCharConfusables = strings.NewReplacer(
+	"rn", "m",
+	"vv", "w",
+	"cl", "d",
+)
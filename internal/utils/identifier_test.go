@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestNormalizeIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"Case", "Alice", "alice", true},
+		{"Fullwidth", "Ａｌｉｃｅ", "alice", true},
+		{"Eszett folds to ss", "straße", "STRASSE", true},
+		{"Email case", "Alice@Example.COM", "alice@example.com", true},
+		{"Surrounding whitespace", " alice ", "alice", true},
+		{"Different names", "alice", "alicia", false},
+		{"Cyrillic look-alike is a different identifier", "аlice", "alice", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeIdentifier(tt.a) == NormalizeIdentifier(tt.b)
+			if got != tt.same {
+				t.Errorf("NormalizeIdentifier(%q) == NormalizeIdentifier(%q) is %v, want %v", tt.a, tt.b, got, tt.same)
+			}
+		})
+	}
+}
+
+func TestUsernameSkeleton(t *testing.T) {
+	tests := []struct {
+		name       string
+		a, b       string
+		confusable bool
+	}{
+		{"Cyrillic a", "pаypаl", "paypal", true},
+		{"Greek omicron", "gοogle", "google", true},
+		{"Digit zero", "g00gle", "google", true},
+		{"Capital I and lowercase l", "biII", "bill", true},
+		{"rn and m", "modern", "rnodern", true},
+		{"Accent", "josé", "jose", true},
+		{"Different names", "alice", "bob", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UsernameSkeleton(tt.a) == UsernameSkeleton(tt.b)
+			if got != tt.confusable {
+				t.Errorf("UsernameSkeleton(%q) = %q, UsernameSkeleton(%q) = %q, confusable %v, want %v",
+					tt.a, UsernameSkeleton(tt.a), tt.b, UsernameSkeleton(tt.b), got, tt.confusable)
+			}
+		})
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		wantErr  error
+	}{
+		{"alice_smith-1.0", nil},
+		{"josé", nil},
+		{"иван", nil},
+		{"pаypal", ErrMixedScriptUsername},
+		{"alice smith", ErrInvalidUsername},
+		{"alice@example", ErrInvalidUsername},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			if err := ValidateUsername(tt.username); err != tt.wantErr {
+				t.Errorf("ValidateUsername(%q) error = %v, want %v", tt.username, err, tt.wantErr)
+			}
+		})
+	}
+}
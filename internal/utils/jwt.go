@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 var (
@@ -13,15 +14,29 @@ var (
 	ErrExpiredToken = errors.New("token has expired")
 )
 
-// GenerateJWT generates a new JWT token
+// GenerateJWT generates a new access token
 func GenerateJWT(userID, username, secret string, expiresIn time.Duration) (string, time.Time, error) {
+	return GenerateJWTForClaims(&models.TokenClaims{UserID: userID, Username: username, Type: models.TokenTypeAccess}, secret, expiresIn)
+}
+
+// GenerateJWTForClaims generates a new JWT token carrying the given claims
+func GenerateJWTForClaims(tokenClaims *models.TokenClaims, secret string, expiresIn time.Duration) (string, time.Time, error) {
 	expirationTime := time.Now().Add(expiresIn)
 	
 	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
+		"user_id":  tokenClaims.UserID,
+		"username": tokenClaims.Username,
 		"exp":      expirationTime.Unix(),
 		"iat":      time.Now().Unix(),
+		// A unique ID keeps tokens issued within the same second distinct
+		"jti": uuid.New().String(),
+		"typ": tokenClaims.Type,
+	}
+	if tokenClaims.SessionID != "" {
+		claims["sid"] = tokenClaims.SessionID
+	}
+	if cnf := confirmation(tokenClaims.TokenBinding); len(cnf) > 0 {
+		claims["cnf"] = cnf
 	}
 	
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -34,8 +49,9 @@ func GenerateJWT(userID, username, secret string, expiresIn time.Duration) (stri
 	return tokenString, expirationTime, nil
 }
 
-// ValidateJWT validates a JWT token and returns the claims
-func ValidateJWT(tokenString, secret string) (*models.TokenClaims, error) {
+// ValidateJWT validates a JWT token of the given type, models.TokenTypeAccess
+// or models.TokenTypeRefresh, and returns the claims
+func ValidateJWT(tokenString, secret, tokenType string) (*models.TokenClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Validate the signing method
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -69,30 +85,99 @@ func ValidateJWT(tokenString, secret string) (*models.TokenClaims, error) {
 	if !ok {
 		return nil, ErrInvalidToken
 	}
+
+	// A refresh token must not authenticate requests, nor an access token
+	// refresh a session
+	if typ, _ := claims["typ"].(string); typ != tokenType {
+		return nil, ErrInvalidToken
+	}
+	
+	// The session ID is optional
+	sessionID, _ := claims["sid"].(string)
+
+	// So is the confirmation of a bound token, but a malformed one must not
+	// leave the token unbound
+	var binding models.TokenBinding
+	if cnf, present := claims["cnf"]; present {
+		confirmation, ok := cnf.(map[string]interface{})
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		if binding.CertificateThumbprint, ok = confirmationMember(confirmation, "x5t#S256"); !ok {
+			return nil, ErrInvalidToken
+		}
+		if binding.KeyThumbprint, ok = confirmationMember(confirmation, "jkt"); !ok {
+			return nil, ErrInvalidToken
+		}
+	}
 	
 	return &models.TokenClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:       userID,
+		Username:     username,
+		SessionID:    sessionID,
+		Type:         tokenType,
+		TokenBinding: binding,
 	}, nil
 }
 
+// confirmation returns the cnf claim of a token with the given binding
+func confirmation(binding models.TokenBinding) map[string]string {
+	cnf := map[string]string{}
+	if binding.CertificateThumbprint != "" {
+		// Client certificate thumbprint (RFC 8705)
+		cnf["x5t#S256"] = binding.CertificateThumbprint
+	}
+	if binding.KeyThumbprint != "" {
+		// DPoP key thumbprint (RFC 9449)
+		cnf["jkt"] = binding.KeyThumbprint
+	}
+	return cnf
+}
+
+// confirmationMember reads an optional member of a cnf claim. It returns
+// false if the member is present but not a non-empty string.
+func confirmationMember(cnf map[string]interface{}, name string) (string, bool) {
+	value, present := cnf[name]
+	if !present {
+		return "", true
+	}
+	s, ok := value.(string)
+	return s, ok && s != ""
+}
+
 // GenerateTokenPair generates both access and refresh tokens
 func GenerateTokenPair(userID, username, secret string, accessTTL, refreshTTL time.Duration) (*models.TokenPair, error) {
+	return GenerateTokenPairForClaims(&models.TokenClaims{UserID: userID, Username: username}, secret, accessTTL, refreshTTL)
+}
+
+// GenerateTokenPairForClaims generates both access and refresh tokens carrying the given claims
+func GenerateTokenPairForClaims(claims *models.TokenClaims, secret string, accessTTL, refreshTTL time.Duration) (*models.TokenPair, error) {
 	// Generate access token
-	accessToken, expiresAt, err := GenerateJWT(userID, username, secret, accessTTL)
+	accessClaims := *claims
+	accessClaims.Type = models.TokenTypeAccess
+	accessToken, expiresAt, err := GenerateJWTForClaims(&accessClaims, secret, accessTTL)
 	if err != nil {
 		return nil, err
 	}
 	
 	// Generate refresh token
-	refreshToken, _, err := GenerateJWT(userID, username, secret, refreshTTL)
+	refreshClaims := *claims
+	refreshClaims.Type = models.TokenTypeRefresh
+	refreshToken, refreshExpiresAt, err := GenerateJWTForClaims(&refreshClaims, secret, refreshTTL)
 	if err != nil {
 		return nil, err
 	}
 	
+	tokenType := "Bearer"
+	if claims.KeyThumbprint != "" {
+		tokenType = "DPoP"
+	}
+
 	return &models.TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresAt:    expiresAt.Unix(),
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        expiresAt.Unix(),
+		RefreshExpiresAt: refreshExpiresAt.Unix(),
+		TokenType:        tokenType,
 	}, nil
 }
\ No newline at end of file
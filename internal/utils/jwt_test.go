@@ -7,6 +7,7 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGenerateJWT(t *testing.T) {
@@ -107,7 +108,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			claims, err := ValidateJWT(tt.tokenString, tt.secret)
+			claims, err := ValidateJWT(tt.tokenString, tt.secret, models.TokenTypeAccess)
 			
 			if tt.wantErr != nil {
 				assert.Error(t, err)
@@ -149,13 +150,13 @@ func TestGenerateTokenPair(t *testing.T) {
 	assert.InDelta(t, expectedExpiration, tokenPair.ExpiresAt, 1)
 
 	// Validate access token
-	accessClaims, err := ValidateJWT(tokenPair.AccessToken, secret)
+	accessClaims, err := ValidateJWT(tokenPair.AccessToken, secret, models.TokenTypeAccess)
 	assert.NoError(t, err)
 	assert.Equal(t, userID, accessClaims.UserID)
 	assert.Equal(t, username, accessClaims.Username)
 
 	// Validate refresh token
-	refreshClaims, err := ValidateJWT(tokenPair.RefreshToken, secret)
+	refreshClaims, err := ValidateJWT(tokenPair.RefreshToken, secret, models.TokenTypeRefresh)
 	assert.NoError(t, err)
 	assert.Equal(t, userID, refreshClaims.UserID)
 	assert.Equal(t, username, refreshClaims.Username)
@@ -173,9 +174,72 @@ func TestInvalidSigningMethod(t *testing.T) {
 	assert.NoError(t, err)
 	
 	// Try to validate the token
-	claims, err := ValidateJWT(tokenString, "test-secret")
+	claims, err := ValidateJWT(tokenString, "test-secret", models.TokenTypeAccess)
 	
 	// Should fail with invalid token error
 	assert.Error(t, err)
 	assert.Nil(t, claims)
-}
\ No newline at end of file
+}
+func TestCertificateBoundJWT(t *testing.T) {
+	claims := &models.TokenClaims{UserID: "user123", Username: "testuser", Type: models.TokenTypeAccess, TokenBinding: models.TokenBinding{CertificateThumbprint: "A9Zt0Ig1wco_EozOrNHzGslBYwlrIPRFroQoW8CDLXI"}}
+	tokenString, _, err := GenerateJWTForClaims(claims, "test-secret", time.Hour)
+	require.NoError(t, err)
+
+	parsed, err := ValidateJWT(tokenString, "test-secret", models.TokenTypeAccess)
+	require.NoError(t, err)
+	assert.Equal(t, claims.CertificateThumbprint, parsed.CertificateThumbprint)
+
+	// A confirmation claim that cannot be read must not leave the token unbound
+	for _, cnf := range []interface{}{"thumbprint", map[string]interface{}{"x5t#S256": 42}, map[string]interface{}{"x5t#S256": ""}} {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id":  "user123",
+			"username": "testuser",
+			"exp":      time.Now().Add(time.Hour).Unix(),
+			"typ":      models.TokenTypeAccess,
+			"cnf":      cnf,
+		})
+		tokenString, err := token.SignedString([]byte("test-secret"))
+		require.NoError(t, err)
+		_, err = ValidateJWT(tokenString, "test-secret", models.TokenTypeAccess)
+		assert.ErrorIs(t, err, ErrInvalidToken, "cnf %v", cnf)
+	}
+}
+
+func TestDPoPBoundTokenPair(t *testing.T) {
+	claims := &models.TokenClaims{UserID: "user123", Username: "testuser", TokenBinding: models.TokenBinding{KeyThumbprint: "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"}}
+	tokens, err := GenerateTokenPairForClaims(claims, "test-secret", time.Hour, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "DPoP", tokens.TokenType)
+
+	for tokenString, tokenType := range map[string]string{tokens.AccessToken: models.TokenTypeAccess, tokens.RefreshToken: models.TokenTypeRefresh} {
+		parsed, err := ValidateJWT(tokenString, "test-secret", tokenType)
+		require.NoError(t, err)
+		assert.Equal(t, claims.KeyThumbprint, parsed.KeyThumbprint)
+		assert.Empty(t, parsed.CertificateThumbprint)
+	}
+
+	tokens, err = GenerateTokenPair("user123", "testuser", "test-secret", time.Hour, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+}
+
+func TestValidateJWTRequiresTokenType(t *testing.T) {
+	tokens, err := GenerateTokenPair("user123", "testuser", "test-secret", time.Hour, 24*time.Hour)
+	require.NoError(t, err)
+
+	_, err = ValidateJWT(tokens.RefreshToken, "test-secret", models.TokenTypeAccess)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = ValidateJWT(tokens.AccessToken, "test-secret", models.TokenTypeRefresh)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Tokens issued before the typ claim was added are no longer accepted
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":  "user123",
+		"username": "testuser",
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte("test-secret"))
+	require.NoError(t, err)
+	_, err = ValidateJWT(tokenString, "test-secret", models.TokenTypeAccess)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
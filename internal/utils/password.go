@@ -1,9 +1,38 @@
 package utils
 
 import (
+	"errors"
+	"learn/internal/config"
+	"strings"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Supported password hashing algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmScrypt   = "scrypt"
+)
+
+var (
+	ErrUnknownHashAlgorithm = errors.New("unknown password hash algorithm")
+	ErrMalformedHash        = errors.New("malformed password hash")
+)
+
+// PasswordHasher hashes and verifies passwords for a single algorithm
+type PasswordHasher interface {
+	// Algorithm returns the algorithm identifier used in encoded hashes
+	Algorithm() string
+	// Hash returns the encoded hash of the password
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the encoded hash
+	Verify(password, encodedHash string) (bool, error)
+	// NeedsRehash reports whether the encoded hash was made with weaker
+	// parameters than the hasher is configured with
+	NeedsRehash(encodedHash string) bool
+}
+
 // HashPassword creates a bcrypt hash of the password
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -14,4 +43,96 @@ func HashPassword(password string) (string, error) {
 func CheckPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
-}
\ No newline at end of file
+}
+
+// DetectAlgorithm returns the algorithm an encoded hash was made with
+func DetectAlgorithm(encodedHash string) (string, error) {
+	switch {
+	case strings.HasPrefix(encodedHash, "$2a$"),
+		strings.HasPrefix(encodedHash, "$2b$"),
+		strings.HasPrefix(encodedHash, "$2y$"):
+		return AlgorithmBcrypt, nil
+	case strings.HasPrefix(encodedHash, "$"+AlgorithmArgon2id+"$"):
+		return AlgorithmArgon2id, nil
+	case strings.HasPrefix(encodedHash, "$"+AlgorithmScrypt+"$"):
+		return AlgorithmScrypt, nil
+	}
+	return "", ErrUnknownHashAlgorithm
+}
+
+// NewPasswordHasher creates the password hasher described by the configuration
+func NewPasswordHasher(cfg config.PasswordConfig) (*PreferredHasher, error) {
+	var preferred PasswordHasher
+	switch cfg.Algorithm {
+	case AlgorithmBcrypt:
+		preferred = NewBcryptHasher(cfg.BcryptCost)
+	case AlgorithmArgon2id:
+		params := DefaultArgon2idParams
+		params.Memory = cfg.Argon2Memory
+		params.Iterations = cfg.Argon2Iterations
+		params.Parallelism = cfg.Argon2Parallelism
+		preferred = NewArgon2idHasher(params)
+	case AlgorithmScrypt:
+		params := DefaultScryptParams
+		params.LogN = cfg.ScryptLogN
+		params.R = cfg.ScryptR
+		params.P = cfg.ScryptP
+		preferred = NewScryptHasher(params)
+	default:
+		return nil, ErrUnknownHashAlgorithm
+	}
+	return NewPreferredHasher(preferred), nil
+}
+
+// PreferredHasher hashes new passwords with a preferred hasher while still
+// verifying hashes produced by any supported algorithm
+type PreferredHasher struct {
+	preferred PasswordHasher
+	verifiers map[string]PasswordHasher
+}
+
+// NewPreferredHasher creates a hasher that prefers the given hasher. Hashes
+// made with other algorithms are verified with their default parameters,
+// which are read back from the encoded hash itself.
+func NewPreferredHasher(preferred PasswordHasher) *PreferredHasher {
+	verifiers := map[string]PasswordHasher{
+		AlgorithmBcrypt:   NewBcryptHasher(bcrypt.DefaultCost),
+		AlgorithmArgon2id: NewArgon2idHasher(DefaultArgon2idParams),
+		AlgorithmScrypt:   NewScryptHasher(DefaultScryptParams),
+	}
+	verifiers[preferred.Algorithm()] = preferred
+
+	return &PreferredHasher{
+		preferred: preferred,
+		verifiers: verifiers,
+	}
+}
+
+// Algorithm returns the preferred algorithm
+func (h *PreferredHasher) Algorithm() string {
+	return h.preferred.Algorithm()
+}
+
+// Hash hashes the password with the preferred hasher
+func (h *PreferredHasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify checks the password with the hasher matching the encoded hash
+func (h *PreferredHasher) Verify(password, encodedHash string) (bool, error) {
+	algorithm, err := DetectAlgorithm(encodedHash)
+	if err != nil {
+		return false, err
+	}
+	return h.verifiers[algorithm].Verify(password, encodedHash)
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or
+// with weaker parameters than the preferred hasher
+func (h *PreferredHasher) NeedsRehash(encodedHash string) bool {
+	algorithm, err := DetectAlgorithm(encodedHash)
+	if err != nil || algorithm != h.preferred.Algorithm() {
+		return true
+	}
+	return h.preferred.NeedsRehash(encodedHash)
+}
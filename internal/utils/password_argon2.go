@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idParams holds the Argon2id cost parameters
+type Argon2idParams struct {
+	Memory      uint32 // Memory in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the second recommended option of RFC 9106
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher implements PasswordHasher using Argon2id with PHC-format hashes
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher creates an Argon2id hasher with the given parameters
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+// Algorithm returns the Argon2id algorithm identifier
+func (h *Argon2idHasher) Algorithm() string {
+	return AlgorithmArgon2id
+}
+
+// Hash creates an Argon2id hash of the password in PHC format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id,
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify compares a password with an Argon2id hash
+func (h *Argon2idHasher) Verify(password, encodedHash string) (bool, error) {
+	params, salt, key, err := decodeArgon2idHash(encodedHash)
+	if err != nil {
+		return false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+// NeedsRehash reports whether the hash parameters are weaker than the configured ones
+func (h *Argon2idHasher) NeedsRehash(encodedHash string) bool {
+	params, _, _, err := decodeArgon2idHash(encodedHash)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.Parallelism < h.params.Parallelism ||
+		params.SaltLength < h.params.SaltLength ||
+		params.KeyLength < h.params.KeyLength
+}
+
+// decodeArgon2idHash parses a PHC-format Argon2id hash
+func decodeArgon2idHash(encodedHash string) (*Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, ErrMalformedHash
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	params := &Argon2idParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, ErrMalformedHash
+	}
+	if params.Iterations == 0 || params.Parallelism == 0 {
+		return nil, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrMalformedHash
+	}
+	params.SaltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrMalformedHash
+	}
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptHasher implements PasswordHasher using bcrypt
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher creates a bcrypt hasher with the given cost
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+// Algorithm returns the bcrypt algorithm identifier
+func (h *BcryptHasher) Algorithm() string {
+	return AlgorithmBcrypt
+}
+
+// Hash creates a bcrypt hash of the password
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(bytes), err
+}
+
+// Verify compares a password with a bcrypt hash
+func (h *BcryptHasher) Verify(password, encodedHash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return false, ErrMalformedHash
+}
+
+// NeedsRehash reports whether the hash cost is lower than the configured cost
+func (h *BcryptHasher) NeedsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	if err != nil {
+		return true
+	}
+	return cost < h.cost
+}
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"errors"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestHashPassword(t *testing.T) {
@@ -130,3 +133,110 @@ func TestHashAndCheckIntegration(t *testing.T) {
 		})
 	}
 }
+
+// testArgon2idParams and testScryptParams keep the hashers fast in tests
+var (
+	testArgon2idParams = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	testScryptParams   = ScryptParams{LogN: 10, R: 8, P: 1, SaltLength: 16, KeyLength: 32}
+)
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := []PasswordHasher{
+		NewBcryptHasher(bcrypt.MinCost),
+		NewArgon2idHasher(testArgon2idParams),
+		NewScryptHasher(testScryptParams),
+	}
+
+	for _, hasher := range hashers {
+		t.Run(hasher.Algorithm(), func(t *testing.T) {
+			hash, err := hasher.Hash("securePassword123")
+			if err != nil {
+				t.Fatalf("Hash() error = %v", err)
+			}
+
+			algorithm, err := DetectAlgorithm(hash)
+			if err != nil || algorithm != hasher.Algorithm() {
+				t.Errorf("DetectAlgorithm() = %v, %v, want %v", algorithm, err, hasher.Algorithm())
+			}
+
+			if ok, err := hasher.Verify("securePassword123", hash); err != nil || !ok {
+				t.Errorf("Verify() = %v, %v for correct password", ok, err)
+			}
+			if ok, err := hasher.Verify("differentPassword456", hash); err != nil || ok {
+				t.Errorf("Verify() = %v, %v for incorrect password", ok, err)
+			}
+			if hasher.NeedsRehash(hash) {
+				t.Errorf("NeedsRehash() = true for a hash made with the same parameters")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherMalformedHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+	}{
+		{"bcrypt", NewBcryptHasher(bcrypt.MinCost), "$2a$invalid"},
+		{"argon2id wrong version", NewArgon2idHasher(testArgon2idParams), "$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5"},
+		{"argon2id missing params", NewArgon2idHasher(testArgon2idParams), "$argon2id$v=19$c2FsdA$a2V5"},
+		{"scrypt bad salt", NewScryptHasher(testScryptParams), "$scrypt$ln=10,r=8,p=1$!!!$a2V5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := tt.hasher.Verify("password", tt.hash)
+			if ok || !errors.Is(err, ErrMalformedHash) {
+				t.Errorf("Verify() = %v, %v, want ErrMalformedHash", ok, err)
+			}
+			if !tt.hasher.NeedsRehash(tt.hash) {
+				t.Errorf("NeedsRehash() = false for a malformed hash")
+			}
+		})
+	}
+}
+
+func TestPreferredHasherRehash(t *testing.T) {
+	hasher := NewPreferredHasher(NewArgon2idHasher(testArgon2idParams))
+
+	legacyHash, err := HashPassword("securePassword123")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+	weakParams := testArgon2idParams
+	weakParams.Memory = 512
+	weakHash, err := NewArgon2idHasher(weakParams).Hash("securePassword123")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	currentHash, err := hasher.Hash("securePassword123")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		hash        string
+		needsRehash bool
+	}{
+		{"Legacy bcrypt hash", legacyHash, true},
+		{"Weaker argon2id parameters", weakHash, true},
+		{"Current parameters", currentHash, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, err := hasher.Verify("securePassword123", tt.hash); err != nil || !ok {
+				t.Errorf("Verify() = %v, %v for correct password", ok, err)
+			}
+			if got := hasher.NeedsRehash(tt.hash); got != tt.needsRehash {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.needsRehash)
+			}
+		})
+	}
+
+	if _, err := hasher.Verify("securePassword123", "plaintext"); !errors.Is(err, ErrUnknownHashAlgorithm) {
+		t.Errorf("Verify() error = %v, want ErrUnknownHashAlgorithm", err)
+	}
+}
@@ -0,0 +1,148 @@
+// Package webhook defines the events sent to webhook subscribers and how
+// their payloads are signed.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"learn/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types a subscription can receive
+const (
+	EventUserRegistered  = "user.registered"
+	EventUserLogin       = "user.login"
+	EventPasswordChanged = "user.password_changed"
+	EventUserDeleted     = "user.deleted"
+)
+
+// EventTypes lists every event type a subscription can receive
+var EventTypes = []string{
+	EventUserRegistered,
+	EventUserLogin,
+	EventPasswordChanged,
+	EventUserDeleted,
+}
+
+// ValidEventType reports whether eventType is a known event type
+func ValidEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers sent with every delivery
+const (
+	// SignatureHeader holds "t=<unix time>,v1=<hex HMAC-SHA256>", where the
+	// HMAC is computed over "<unix time>.<body>" with the subscription secret
+	SignatureHeader = "Webhook-Signature"
+	EventIDHeader   = "Webhook-Id"
+	EventTypeHeader = "Webhook-Event"
+)
+
+// Event is the JSON payload posted to subscribers
+type Event struct {
+	// ID is the same on every delivery of the event, so receivers can
+	// ignore an event they have already processed
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      UserData  `json:"data"`
+}
+
+// UserData describes the user an event is about
+type UserData struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// NewUserEvent creates an event about a user. The client, if given, is the
+// one that caused the event.
+func NewUserEvent(eventType string, user *models.User, client *models.ClientInfo) *Event {
+	event := &Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data: UserData{
+			UserID:   user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+		},
+	}
+	if client != nil {
+		event.Data.IPAddress = client.IPAddress
+		event.Data.UserAgent = client.UserAgent
+	}
+	return event
+}
+
+// Publisher accepts events for delivery to subscribers
+type Publisher interface {
+	Publish(event *Event) error
+}
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature timestamp outside tolerance")
+)
+
+// Sign returns the signature header value for a body sent at the given time
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", unix, computeMAC(secret, unix, body))
+}
+
+// Verify checks a signature header against a received body, as a receiver
+// would. Signatures older or newer than tolerance are rejected so that a
+// captured request cannot be replayed later.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var unix string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	expected := computeMAC(secret, unix, body)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func computeMAC(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,40 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	secret := "whsec_test"
+	body := []byte(`{"id":"1","type":"user.login"}`)
+	sentAt := time.Unix(1700000000, 0)
+	signature := Sign(secret, sentAt, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		receiveAt time.Time
+		want      error
+	}{
+		{"Valid", secret, signature, body, sentAt.Add(time.Minute), nil},
+		{"Wrong secret", "whsec_other", signature, body, sentAt, ErrInvalidSignature},
+		{"Modified body", secret, signature, []byte(`{"id":"1","type":"user.deleted"}`), sentAt, ErrInvalidSignature},
+		{"Too old", secret, signature, body, sentAt.Add(10 * time.Minute), ErrSignatureExpired},
+		{"From the future", secret, signature, body, sentAt.Add(-10 * time.Minute), ErrSignatureExpired},
+		{"Missing signature", secret, "t=1700000000", body, sentAt, ErrInvalidSignature},
+		{"Malformed", secret, "garbage", body, sentAt, ErrInvalidSignature},
+		{"One of several signatures", secret, signature + ",v1=deadbeef", body, sentAt, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute, tt.receiveAt)
+			assert.Equal(t, tt.want, err)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"context"
+	"learn/internal/config"
+	"learn/internal/events"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"learn/internal/utils"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// OutboxBatchSize is how many outbox records the relay reads at a time
+const OutboxBatchSize = 100
+
+// OutboxRelay dispatches events from the outbox to asynchronous
+// subscribers. A record is deleted only after its subscribers have all
+// succeeded, so an event is dispatched again if the process stops in
+// between. A failed dispatch is retried with exponential backoff, running
+// only the subscribers that have not yet succeeded, until the record runs
+// out of attempts and is dead-lettered.
+type OutboxRelay struct {
+	outbox repository.OutboxRepository
+	bus    *events.Bus
+	config config.DatabaseConfig
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewOutboxRelay creates a relay that checks the outbox at the configured
+// poll interval, and as soon as the bus is notified of stored events
+func NewOutboxRelay(outbox repository.OutboxRepository, bus *events.Bus, cfg config.DatabaseConfig) *OutboxRelay {
+	return &OutboxRelay{
+		outbox: outbox,
+		bus:    bus,
+		config: cfg,
+	}
+}
+
+// Start runs the relay in the background until Stop is called or the
+// context is cancelled
+func (r *OutboxRelay) Start(ctx context.Context) {
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.config.OutboxPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-r.bus.Pending():
+			}
+			r.Relay(ctx)
+		}
+	}()
+}
+
+// Stop stops the relay and waits for subscribers in progress to finish
+func (r *OutboxRelay) Stop() {
+	r.once.Do(func() {
+		if r.cancel == nil {
+			return
+		}
+		r.cancel()
+		<-r.done
+	})
+}
+
+// Relay dispatches due outbox records until none are left
+func (r *OutboxRelay) Relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		records, err := r.outbox.Pending(ctx, time.Now(), OutboxBatchSize)
+		if err != nil {
+			slog.Error("Failed to read outbox", "error", err)
+			return
+		}
+
+		for _, record := range records {
+			if ctx.Err() != nil {
+				return
+			}
+			// A dispatched record is still deleted if the relay is stopped
+			// meanwhile
+			if err := r.relay(context.WithoutCancel(ctx), record); err != nil {
+				slog.Error("Failed to update outbox record", "event_id", record.ID, "error", err)
+				return
+			}
+		}
+		if len(records) < OutboxBatchSize {
+			return
+		}
+	}
+}
+
+// relay dispatches one record and deletes it, or stores the failed attempt.
+// The returned error is only for failing to update the outbox.
+func (r *OutboxRelay) relay(ctx context.Context, record *models.OutboxRecord) error {
+	// A record that cannot be decoded never will be, so it is dropped
+	// rather than retried
+	event, err := events.FromOutboxRecord(record)
+	if err != nil {
+		slog.Error("Dropping outbox record", "event_id", record.ID, "error", err)
+		return r.outbox.Delete(ctx, record.ID)
+	}
+	record.Handled, err = r.bus.Dispatch(event, record.Handled)
+	if err == nil {
+		return r.outbox.Delete(ctx, record.ID)
+	}
+
+	now := time.Now()
+	record.Attempts++
+	record.LastError = err.Error()
+	if record.Attempts >= r.config.OutboxMaxAttempts {
+		record.DeadAt = &now
+		slog.Error("Dead-lettering outbox record", "event_id", record.ID, "event_type", record.EventType, "attempts", record.Attempts, "error", err)
+	} else {
+		record.NextAttemptAt = now.Add(utils.Backoff(r.config.OutboxRetryBaseDelay, r.config.OutboxRetryMaxDelay, record.Attempts))
+		slog.Error("Failed to handle event", "event_id", record.ID, "event_type", record.EventType, "attempts", record.Attempts, "error", err)
+	}
+	return r.outbox.Update(ctx, record)
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"errors"
+	"learn/internal/config"
+	"learn/internal/events"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	ctx := t.Context()
+	outbox := repository.NewInMemoryOutboxRepository()
+	bus := events.NewBus()
+
+	var received []string
+	events.SubscribeAsync(bus, "received", func(event events.UserRegistered) error {
+		received = append(received, event.Username)
+		return nil
+	})
+
+	for _, username := range []string{"alice", "bob"} {
+		event := events.UserRegistered{
+			Metadata: events.NewMetadata(nil),
+			User:     events.User{UserID: username, Username: username},
+		}
+		record, err := events.NewOutboxRecord(event)
+		require.NoError(t, err)
+		require.NoError(t, outbox.Add(ctx, record))
+	}
+	require.NoError(t, outbox.Add(ctx, &models.OutboxRecord{ID: "unknown", EventType: "user.exploded", CreatedAt: time.Now()}))
+
+	relay := NewOutboxRelay(outbox, bus, config.DatabaseConfig{OutboxMaxAttempts: 3, OutboxRetryBaseDelay: time.Minute, OutboxRetryMaxDelay: time.Hour})
+	relay.Relay(ctx)
+
+	assert.ElementsMatch(t, []string{"alice", "bob"}, received)
+	pending, err := outbox.Pending(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending, "dispatched and undecodable records are removed")
+
+	// Already dispatched records are not dispatched again
+	relay.Relay(ctx)
+	assert.Len(t, received, 2)
+}
+
+func TestOutboxRelayRetriesFailedEvents(t *testing.T) {
+	ctx := t.Context()
+	outbox := repository.NewInMemoryOutboxRepository()
+	bus := events.NewBus()
+
+	calls := 0
+	events.SubscribeAsync(bus, "mailer", func(event events.UserRegistered) error {
+		calls++
+		return errors.New("mailer unavailable")
+	})
+
+	record, err := events.NewOutboxRecord(events.UserRegistered{
+		Metadata: events.NewMetadata(nil),
+		User:     events.User{UserID: "1", Username: "alice"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, outbox.Add(ctx, record))
+
+	relay := NewOutboxRelay(outbox, bus, config.DatabaseConfig{OutboxMaxAttempts: 3, OutboxRetryBaseDelay: time.Minute, OutboxRetryMaxDelay: time.Hour})
+	relay.Relay(ctx)
+	assert.Equal(t, 1, calls)
+
+	// The failed record is kept, but not retried before its backoff ends
+	now := time.Now()
+	pending, err := outbox.Pending(ctx, now.Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, "user.registered subscriber mailer: mailer unavailable", pending[0].LastError)
+	assert.WithinDuration(t, now.Add(time.Minute), pending[0].NextAttemptAt, 5*time.Second)
+	relay.Relay(ctx)
+	assert.Equal(t, 1, calls)
+
+	// Each retry doubles the delay until the record is dead-lettered
+	for attempt := 2; attempt <= 3; attempt++ {
+		pending[0].NextAttemptAt = time.Time{}
+		require.NoError(t, outbox.Update(ctx, pending[0]))
+		relay.Relay(ctx)
+		assert.Equal(t, attempt, calls)
+
+		pending, err = outbox.Pending(ctx, time.Now().Add(time.Hour), 10)
+		require.NoError(t, err)
+		if attempt < 3 {
+			require.Len(t, pending, 1)
+			assert.WithinDuration(t, time.Now().Add(2*time.Minute), pending[0].NextAttemptAt, 5*time.Second)
+		}
+	}
+	assert.Empty(t, pending, "dead-lettered records are not dispatched")
+	relay.Relay(ctx)
+	assert.Equal(t, 3, calls)
+}
+
+func TestOutboxRelayRetriesOnlyFailedSubscribers(t *testing.T) {
+	ctx := t.Context()
+	outbox := repository.NewInMemoryOutboxRepository()
+	bus := events.NewBus()
+
+	calls := map[string]int{}
+	for _, name := range []string{"mailer", "webhooks"} {
+		events.SubscribeAsync(bus, name, func(event events.UserRegistered) error {
+			calls[name]++
+			return nil
+		})
+	}
+	failing := true
+	events.SubscribeAsync(bus, "audit", func(event events.UserRegistered) error {
+		calls["audit"]++
+		if failing {
+			return errors.New("audit unavailable")
+		}
+		return nil
+	})
+
+	record, err := events.NewOutboxRecord(events.UserRegistered{
+		Metadata: events.NewMetadata(nil),
+		User:     events.User{UserID: "1", Username: "alice"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, outbox.Add(ctx, record))
+
+	relay := NewOutboxRelay(outbox, bus, config.DatabaseConfig{OutboxMaxAttempts: 3, OutboxRetryBaseDelay: time.Minute, OutboxRetryMaxDelay: time.Hour})
+	relay.Relay(ctx)
+
+	pending, err := outbox.Pending(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, []string{"mailer", "webhooks"}, pending[0].Handled)
+
+	// The retry runs the failed subscriber, but not those that succeeded
+	failing = false
+	pending[0].NextAttemptAt = time.Time{}
+	require.NoError(t, outbox.Update(ctx, pending[0]))
+	relay.Relay(ctx)
+	assert.Equal(t, map[string]int{"mailer": 1, "webhooks": 1, "audit": 2}, calls)
+
+	pending, err = outbox.Pending(ctx, time.Now().Add(time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
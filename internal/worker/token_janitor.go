@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"learn/internal/metrics"
+	"learn/internal/repository"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// TokenJanitor periodically purges expired refresh tokens, which would
+// otherwise stay in the repository until they are presented again
+type TokenJanitor struct {
+	tokenRepo repository.TokenRepository
+	interval  time.Duration
+	metrics   *metrics.Metrics
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewTokenJanitor creates a janitor that sweeps at the given interval. The
+// result of each sweep is recorded in metrics, which may be nil.
+func NewTokenJanitor(tokenRepo repository.TokenRepository, interval time.Duration, metrics *metrics.Metrics) *TokenJanitor {
+	return &TokenJanitor{
+		tokenRepo: tokenRepo,
+		interval:  interval,
+		metrics:   metrics,
+	}
+}
+
+// Start runs the janitor in the background until Stop is called or the
+// context is cancelled
+func (j *TokenJanitor) Start(ctx context.Context) {
+	ctx, j.cancel = context.WithCancel(ctx)
+	j.done = make(chan struct{})
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				j.Sweep(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the janitor and waits for a sweep in progress to finish
+func (j *TokenJanitor) Stop() {
+	j.once.Do(func() {
+		if j.cancel == nil {
+			return
+		}
+		j.cancel()
+		<-j.done
+	})
+}
+
+// Sweep purges expired tokens once and records the result
+func (j *TokenJanitor) Sweep(ctx context.Context) {
+	purged, err := j.tokenRepo.PurgeExpired(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			j.metrics.ObserveTokenPurge(purged, err)
+			slog.Error("Failed to purge expired tokens", "error", err)
+		}
+		return
+	}
+	j.metrics.ObserveTokenPurge(purged, nil)
+	if purged > 0 {
+		slog.Info("Purged expired refresh tokens", "count", purged)
+	}
+}
@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"context"
+	"learn/internal/metrics"
+	"learn/internal/models"
+	"learn/internal/repository"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrape returns the metrics in the Prometheus text format
+func scrape(appMetrics *metrics.Metrics) string {
+	w := httptest.NewRecorder()
+	appMetrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return w.Body.String()
+}
+
+// purgeRuns returns the line counting successful purges
+func purgeRuns(appMetrics *metrics.Metrics) string {
+	return regexp.MustCompile(`auth_refresh_token_purge_runs_total\{outcome="success"\} \d+`).FindString(scrape(appMetrics))
+}
+
+// newTestSession creates a session for user1 expiring at the given time
+func newTestSession(id string, expiresAt time.Time) *models.Session {
+	return &models.Session{ID: id, UserID: "user1", ExpiresAt: expiresAt}
+}
+
+func TestTokenJanitorSweep(t *testing.T) {
+	ctx := t.Context()
+	tokenRepo := repository.NewInMemoryTokenRepository()
+	require.NoError(t, tokenRepo.Store(ctx, "expired1", newTestSession("expired1", time.Now().Add(-time.Minute))))
+	require.NoError(t, tokenRepo.Store(ctx, "expired2", newTestSession("expired2", time.Now().Add(-time.Hour))))
+	require.NoError(t, tokenRepo.Store(ctx, "valid", newTestSession("valid", time.Now().Add(time.Hour))))
+
+	appMetrics := metrics.New(repository.NewInMemoryStore())
+	janitor := NewTokenJanitor(tokenRepo, time.Hour, appMetrics)
+	janitor.Sweep(context.Background())
+
+	body := scrape(appMetrics)
+	assert.Contains(t, body, "auth_refresh_tokens_purged_total 2\n")
+	assert.Contains(t, body, `auth_refresh_token_purge_runs_total{outcome="success"} 1`)
+	assert.NotContains(t, body, "auth_refresh_token_purge_last_success_timestamp_seconds 0\n")
+
+	_, err := tokenRepo.GetUserIDByToken(ctx, "expired1")
+	assert.ErrorIs(t, err, repository.ErrTokenNotFound)
+	userID, err := tokenRepo.GetUserIDByToken(ctx, "valid")
+	require.NoError(t, err)
+	assert.Equal(t, "user1", userID)
+}
+
+func TestTokenJanitorStartStop(t *testing.T) {
+	ctx := t.Context()
+	tokenRepo := repository.NewInMemoryTokenRepository()
+	require.NoError(t, tokenRepo.Store(ctx, "expired", newTestSession("expired", time.Now().Add(-time.Minute))))
+
+	appMetrics := metrics.New(repository.NewInMemoryStore())
+	janitor := NewTokenJanitor(tokenRepo, 10*time.Millisecond, appMetrics)
+	janitor.Start(context.Background())
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(scrape(appMetrics), "auth_refresh_tokens_purged_total 1\n")
+	}, time.Second, 10*time.Millisecond)
+
+	janitor.Stop()
+	runs := purgeRuns(appMetrics)
+	require.NotEmpty(t, runs)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, runs, purgeRuns(appMetrics), "janitor kept running after Stop")
+
+	// Stopping twice is harmless
+	janitor.Stop()
+}
@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// WebhookDeliverer attempts the webhook deliveries that are due, returning
+// how many were attempted
+type WebhookDeliverer interface {
+	DeliverDue(ctx context.Context) (int, error)
+}
+
+// WebhookDispatcher periodically sends due webhook deliveries from the outbox
+type WebhookDispatcher struct {
+	deliverer WebhookDeliverer
+	interval  time.Duration
+	// batchSize is the most deliveries one DeliverDue call attempts; a full
+	// batch means more may be waiting, so the dispatcher goes again at once
+	batchSize int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewWebhookDispatcher creates a dispatcher that checks the outbox at the
+// given interval
+func NewWebhookDispatcher(deliverer WebhookDeliverer, interval time.Duration, batchSize int) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		deliverer: deliverer,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Start runs the dispatcher in the background until Stop is called or the
+// context is cancelled
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.done = make(chan struct{})
+
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				d.Dispatch(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the dispatcher and waits for deliveries in progress to finish
+func (d *WebhookDispatcher) Stop() {
+	d.once.Do(func() {
+		if d.cancel == nil {
+			return
+		}
+		d.cancel()
+		<-d.done
+	})
+}
+
+// Dispatch sends due deliveries until none are left
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		attempted, err := d.deliverer.DeliverDue(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Error("Failed to deliver webhooks", "error", err)
+			}
+			return
+		}
+		if attempted < d.batchSize {
+			return
+		}
+	}
+}
@@ -1,19 +1,44 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
 	"learn/docs"
+	"learn/internal/audit"
 	"learn/internal/config"
+	"learn/internal/dpop"
+	"learn/internal/events"
 	"learn/internal/handlers"
+	"learn/internal/health"
+	"learn/internal/logging"
+	"learn/internal/mailer"
+	"learn/internal/metrics"
 	"learn/internal/middleware"
+	"learn/internal/models"
+	"learn/internal/policy"
 	"learn/internal/repository"
 	"learn/internal/service"
-	"log"
+	"learn/internal/tlsconfig"
+	"learn/internal/tracing"
+	"learn/internal/utils"
+	"learn/internal/worker"
+	"log/slog"
 	"net/http"
 	_ "net/http/pprof" // Import pprof for profiling
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	_ "modernc.org/sqlite" // SQLite driver for the SQL store, audit sink and webhook store
 )
 
 // @title           Learn API
@@ -37,32 +62,211 @@ import (
 // @description Type "Bearer" followed by a space and JWT token.
 
 func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig()
+	configFile := flag.String("config", "", "YAML or TOML config file, overridden by environment variables (default $CONFIG_FILE)")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration, with secrets redacted, and exit")
+	promoteAdmin := flag.String("promote-admin", "", "give the admin role to the existing account with this username or email, and exit")
+	flag.Parse()
+
+	// Load configuration. Every problem is listed, one per line, so that
+	// they can all be fixed at once.
+	cfg, err := config.LoadConfig(*configFile)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		if err := cfg.PrintSettings(os.Stdout); err != nil {
+			fatal("Failed to print config", err)
+		}
+		return
+	}
+	// The in-memory store starts empty, so there would be no account to promote
+	if *promoteAdmin != "" && cfg.Database.Backend != "sql" {
+		fmt.Fprintln(os.Stderr, "-promote-admin requires DATABASE_BACKEND=sql")
+		os.Exit(2)
 	}
 
+	// Configure logging. The standard library logger writes through slog
+	// once it is the default, so every log line is structured.
+	slog.SetDefault(logging.New(os.Stdout, cfg.Log))
+	gin.DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, handlers int) {
+		slog.Debug("Route registered", "method", httpMethod, "path", absolutePath, "handler", handlerName)
+	}
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)))
+	}
+
+	// Configure tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, os.Stdout)
+	if err != nil {
+		fatal("Failed to configure tracing", err)
+	}
+	defer shutdownStep("Failed to flush traces", cfg.Server.ShutdownTimeout, shutdownTracing)
+
 	// Create repositories
-	userRepo := repository.NewInMemoryUserRepository()
-	tokenRepo := repository.NewInMemoryTokenRepository()
+	var store repository.Store = repository.NewInMemoryStore()
+	if cfg.Database.Backend == "sql" {
+		db, err := sql.Open(cfg.Database.SQLDriver, cfg.Database.SQLDSN)
+		if err != nil {
+			fatal("Failed to open database", err)
+		}
+		sqlStore, err := repository.NewSQLStore(db)
+		if err != nil {
+			fatal("Failed to create database store", err)
+		}
+		defer closeLogged("Failed to close database", sqlStore)
+		store = sqlStore
+	}
+
+	// Create metrics. They stay nil when disabled, which instrumented code
+	// treats as recording nothing. They read the store before it is traced,
+	// so scrapes do not record traces of their own.
+	var appMetrics *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		appMetrics = metrics.New(store)
+	}
+	if cfg.Tracing.Exporter != "none" {
+		store = repository.NewTracedStore(store)
+	}
+	userRepo := store.Users()
+	tokenRepo := store.Tokens()
+	accessTokenRepo := store.AccessTokens()
+
+	// Create password hasher
+	hasher, err := utils.NewPasswordHasher(cfg.Password)
+	if err != nil {
+		fatal("Failed to create password hasher", err)
+	}
+
+	// Create password policy
+	passwordPolicy, err := policy.NewPasswordPolicy(cfg.Password)
+	if err != nil {
+		fatal("Failed to create password policy", err)
+	}
+
+	// Create mailer
+	mail := mailer.NewMailer(cfg.Mail)
+
+	// Create audit log
+	auditLog, err := audit.NewLogger(cfg.Audit)
+	if err != nil {
+		fatal("Failed to create audit log", err)
+	}
+	defer closeLogged("Failed to close audit log", auditLog)
+
+	// Create readiness checks of the dependencies
+	checker := health.NewChecker(cfg.Health.CheckTimeout)
+	checker.Register("store", store.Ping)
+	checker.Register("signing_key", health.SigningKey(cfg.JWT.Secret))
+	checker.Register("mailer", health.Mailer(cfg.Mail))
+
+	// Create webhook subscription and outbox store
+	var webhookRepo repository.WebhookRepository = repository.NewInMemoryWebhookRepository()
+	if cfg.Webhook.Store == "sql" {
+		db, err := sql.Open(cfg.Webhook.SQLDriver, cfg.Webhook.SQLDSN)
+		if err != nil {
+			fatal("Failed to open webhook database", err)
+		}
+		sqlWebhookRepo, err := repository.NewSQLWebhookRepository(db)
+		if err != nil {
+			fatal("Failed to create webhook store", err)
+		}
+		defer closeLogged("Failed to close webhook database", sqlWebhookRepo)
+		webhookRepo = sqlWebhookRepo
+		checker.Register("webhook_store", sqlWebhookRepo.Ping)
+	}
+
+	// Create the domain event bus
+	bus := events.NewBus()
 
 	// Create services
-	authService := service.NewAuthService(userRepo, tokenRepo, cfg)
+	webhookService := service.NewWebhookService(webhookRepo, auditLog, cfg.Webhook)
+	service.SubscribeWebhooks(bus, webhookService)
+	authService, err := service.NewAuthService(store, appMetrics.InstrumentHasher(hasher), passwordPolicy, mail, auditLog, bus, appMetrics, cfg)
+	if err != nil {
+		fatal("Failed to create auth service", err)
+	}
+	defer shutdownStep("Failed to send pending mail", cfg.Server.ShutdownTimeout, authService.Flush)
+	accessTokenService := service.NewAccessTokenService(accessTokenRepo, userRepo)
+	var statusCache *service.AccountStatusCache
+	if cfg.Auth.StatusCheck {
+		statusCache = service.NewAccountStatusCache(userRepo, cfg.Auth.StatusCacheTTL)
+		service.SubscribeAccountStatusCache(bus, statusCache)
+	}
+	adminService := service.NewAdminService(store, authService, statusCache, auditLog, bus)
+	if *promoteAdmin != "" {
+		user, err := adminService.PromoteAdmin(context.Background(), *promoteAdmin)
+		if err != nil {
+			fatal("Failed to promote administrator", err)
+		}
+		fmt.Printf("%s is now an administrator\n", user.Username)
+		return
+	}
+
+	// Start background workers. On shutdown they are stopped once the
+	// server has drained, letting work in progress finish, before the
+	// sinks and stores above are closed.
+	tokenJanitor := worker.NewTokenJanitor(tokenRepo, cfg.JWT.PurgeInterval, appMetrics)
+	tokenJanitor.Start(context.Background())
+	defer tokenJanitor.Stop()
+	webhookDispatcher := worker.NewWebhookDispatcher(webhookService, cfg.Webhook.PollInterval, service.DeliveryBatchSize)
+	webhookDispatcher.Start(context.Background())
+	defer webhookDispatcher.Stop()
+	outboxRelay := worker.NewOutboxRelay(store.Outbox(), bus, cfg.Database)
+	outboxRelay.Start(context.Background())
+	defer outboxRelay.Stop()
 
 	// Create handlers
-	authHandler := handlers.NewAuthHandler(authService)
-	userHandler := handlers.NewUserHandler(userRepo)
+	authHandler := handlers.NewAuthHandler(authService, cfg.Cookie)
+	userHandler := handlers.NewUserHandler(userRepo, authService)
+	accessTokenHandler := handlers.NewAccessTokenHandler(accessTokenService, auditLog)
+	adminHandler := handlers.NewAdminHandler(adminService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	healthHandler := handlers.NewHealthHandler(checker)
+
+	// Load the TLS certificate, reloading it when the files change
+	var tlsReloader *tlsconfig.Reloader
+	if cfg.Server.TLS.CertFile != "" {
+		tlsReloader, err = tlsconfig.NewReloader(cfg.Server.TLS)
+		if err != nil {
+			fatal("Failed to load TLS certificate", err)
+		}
+		tlsReloader.Start(context.Background())
+		defer tlsReloader.Stop()
+		checker.Register("tls_certificate", health.Certificate(tlsReloader.Certificate))
+	}
 
 	// Create router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(middleware.RequestIDMiddleware(), middleware.TracingMiddleware(), middleware.LoggingMiddleware(), middleware.RecoveryMiddleware())
+	if cfg.Server.TLS.ClientAuth != "none" {
+		router.Use(middleware.ClientCertMiddleware())
+	}
+	if appMetrics != nil {
+		router.Use(middleware.MetricsMiddleware(appMetrics))
+	}
 
-	// Create JWT middleware
-	jwtMiddleware := middleware.JWTMiddleware(cfg)
+	// Create JWT, DPoP and CSRF middleware. DPoP proofs are only verified
+	// where they are needed: on the token endpoints, and on protected
+	// routes for tokens presented with the DPoP scheme.
+	jwtMiddleware := middleware.JWTMiddleware(cfg, accessTokenService)
+	csrfMiddleware := middleware.CSRFMiddleware()
+	dpopVerifier := dpop.NewVerifier(cfg.Auth.DPoPProofLifetime)
+	dpopMiddleware := middleware.DPoPMiddleware(dpopVerifier, cfg.Server.PublicURL)
+	sessionCache := service.NewSessionCache(tokenRepo, cfg.Auth.SessionCacheTTL)
+	authenticated := []gin.HandlerFunc{middleware.DPoPSchemeMiddleware(dpopVerifier, cfg.Server.PublicURL), jwtMiddleware, middleware.SessionMiddleware(sessionCache), csrfMiddleware}
+	if statusCache != nil {
+		authenticated = append(authenticated, middleware.AccountStatusMiddleware(statusCache))
+	}
+	adminOnly := slices.Concat(authenticated, []gin.HandlerFunc{middleware.RequireSession(), middleware.RequireRole(userRepo, models.RoleAdmin)})
 
 	// Register routes
-	authHandler.RegisterRoutes(router)
-	userHandler.RegisterRoutes(router, jwtMiddleware)
+	authHandler.RegisterRoutes(router, csrfMiddleware, dpopMiddleware)
+	userHandler.RegisterRoutes(router, authenticated...)
+	accessTokenHandler.RegisterRoutes(router, authenticated...)
+	adminHandler.RegisterRoutes(router, adminOnly...)
+	webhookHandler.RegisterRoutes(router, adminOnly...)
+	healthHandler.RegisterRoutes(router)
 
 	// Swagger documentation
 	docs.SwaggerInfo.BasePath = "/"
@@ -70,13 +274,91 @@ func main() {
 
 	// Start pprof server on a separate port (6060 is the conventional port for pprof)
 	go func() {
-		log.Println("Starting pprof server on :6060")
-		log.Println(http.ListenAndServe("localhost:6060", nil))
+		slog.Info("Starting pprof server", "addr", "localhost:6060")
+		slog.Error("pprof server stopped", "error", http.ListenAndServe("localhost:6060", nil))
 	}()
 
+	// Start the metrics server on a separate address, since the metrics are
+	// not authenticated
+	if appMetrics != nil {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(cfg.Metrics.Path, appMetrics.Handler())
+		metricsServer := &http.Server{
+			Addr:              cfg.Metrics.Addr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		}
+		go func() {
+			slog.Info("Starting metrics server", "addr", cfg.Metrics.Addr)
+			if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				slog.Error("Metrics server stopped", "error", err)
+			}
+		}()
+		defer shutdownStep("Failed to stop metrics server", cfg.Server.ShutdownTimeout, metricsServer.Shutdown)
+	}
+
 	// Start server
-	log.Printf("Starting server on port %s", cfg.Server.Port)
-	if err := router.Run(":" + cfg.Server.Port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           router,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	if tlsReloader != nil {
+		server.TLSConfig = tlsReloader.Config()
+	}
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "port", cfg.Server.Port, "tls", tlsReloader != nil)
+		if server.TLSConfig != nil {
+			serverErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		serverErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
+		fatal("Failed to start server", err)
+	case <-signals.Done():
+	}
+	// A second signal stops the server immediately
+	stopSignals()
+
+	// Fail readiness first so load balancers stop sending requests, then
+	// stop accepting connections and wait for in-flight requests
+	slog.Info("Shutting down", "drain_delay", cfg.Server.DrainDelay.String(), "timeout", cfg.Server.ShutdownTimeout.String())
+	checker.Drain()
+	time.Sleep(cfg.Server.DrainDelay)
+	shutdownStep("Failed to drain requests", cfg.Server.ShutdownTimeout, server.Shutdown)
+	slog.Info("Server stopped")
+}
+
+// fatal logs an error that prevents the server from running and exits
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
+}
+
+// shutdownStep runs a step of the shutdown, giving it at most timeout and
+// logging its failure
+func shutdownStep(message string, timeout time.Duration, step func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := step(ctx); err != nil {
+		slog.Error(message, "error", err)
+	}
+}
+
+// closeLogged closes a resource on shutdown, logging its failure
+func closeLogged(message string, closer io.Closer) {
+	if err := closer.Close(); err != nil {
+		slog.Error(message, "error", err)
 	}
 }